@@ -0,0 +1,89 @@
+package auth_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supabase-community/auth-go/authtest"
+	"github.com/supabase-community/auth-go/types"
+)
+
+func TestAdminListUsersFilterAndSort(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := authtest.NewServer(authtest.DefaultConfig())
+	defer srv.Close()
+	client := srv.AdminClient()
+
+	for _, req := range []types.AdminCreateUserRequest{
+		{Email: "alice@example.com"},
+		{Email: "bob@example.com", UserMetadata: map[string]interface{}{"full_name": "Bob Alison"}},
+		{Email: "carol@example.org"},
+	} {
+		_, err := client.AdminCreateUser(req)
+		require.NoError(err)
+	}
+
+	resp, err := client.AdminListUsers(types.AdminListUsersRequest{
+		Filter: "ALI",
+		Sort:   []types.UserSort{{Field: types.UserSortFieldCreatedAt, Direction: types.SortAscending}},
+	})
+	require.NoError(err)
+	require.Len(resp.Users, 2)
+	assert.Equal("alice@example.com", resp.Users[0].Email)
+	assert.Equal("bob@example.com", resp.Users[1].Email)
+	assert.Equal(2, resp.TotalCount)
+
+	_, err = client.AdminListUsers(types.AdminListUsersRequest{
+		Sort: []types.UserSort{{Field: "email"}},
+	})
+	assert.ErrorIs(err, types.ErrInvalidAdminListUsersRequest)
+	_, err = client.AdminListUsers(types.AdminListUsersRequest{
+		Sort: []types.UserSort{{Field: types.UserSortFieldCreatedAt, Direction: "up"}},
+	})
+	assert.ErrorIs(err, types.ErrInvalidAdminListUsersRequest)
+}
+
+func TestAdminGetUserByEmailAndPhone(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := authtest.NewServer(authtest.DefaultConfig())
+	defer srv.Close()
+	client := srv.AdminClient()
+
+	_, err := client.AdminCreateUser(types.AdminCreateUserRequest{Email: "someone@example.com"})
+	require.NoError(err)
+	created, err := client.AdminCreateUser(types.AdminCreateUserRequest{Email: "one@example.com", Phone: "+44 7700 900123"})
+	require.NoError(err)
+
+	user, err := client.AdminGetUserByEmail(types.AdminGetUserByEmailRequest{Email: "  ONE@example.com "})
+	require.NoError(err)
+	assert.Equal(created.ID, user.ID)
+
+	user, err = client.AdminGetUserByPhone(types.AdminGetUserByPhoneRequest{Phone: "+44 (7700) 900-123"})
+	require.NoError(err)
+	assert.Equal(created.ID, user.ID)
+
+	// The filter matches substrings, but only exact matches are returned.
+	_, err = client.AdminGetUserByEmail(types.AdminGetUserByEmailRequest{Email: "one@example"})
+	var notFound *types.ErrUserNotFound
+	require.True(errors.As(err, &notFound))
+	assert.Equal("one@example", notFound.Email)
+
+	_, err = client.AdminGetUserByPhone(types.AdminGetUserByPhoneRequest{Phone: "447700900124"})
+	require.True(errors.As(err, &notFound))
+	assert.Equal("447700900124", notFound.Phone)
+
+	// Other failures are returned as APIErrors with the status and error code.
+	_, err = client.AdminCreateUser(types.AdminCreateUserRequest{Email: "one@example.com"})
+	var apiErr *types.APIError
+	require.True(errors.As(err, &apiErr))
+	assert.Equal(422, apiErr.StatusCode)
+	assert.Equal("email_exists", apiErr.ErrorCode)
+	assert.Contains(err.Error(), "response status code 422: ")
+}
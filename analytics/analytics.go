@@ -0,0 +1,254 @@
+// Package analytics computes aggregate numbers about a project's users, such
+// as signups per day, confirmation rate and MFA adoption.
+//
+// Users are streamed from AdminListUsers one page at a time and folded into
+// fixed-size aggregates, so memory use does not grow with the number of
+// users: only the per-day signup counts grow, with the length of a window.
+package analytics
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/types"
+)
+
+// Window selects the users created in [From, To). A zero From or To leaves
+// that end open.
+type Window struct {
+	Name string    `json:"name"`
+	From time.Time `json:"from,omitempty"`
+	To   time.Time `json:"to,omitempty"`
+}
+
+// AllTime is a window over every user.
+var AllTime = Window{Name: "all"}
+
+// LastDays returns a window over the users created in the n days before now.
+func LastDays(now time.Time, n int) Window {
+	return Window{
+		Name: "last_" + strconv.Itoa(n) + "d",
+		From: now.AddDate(0, 0, -n),
+		To:   now,
+	}
+}
+
+func (w Window) contains(t time.Time) bool {
+	if !w.From.IsZero() && t.Before(w.From) {
+		return false
+	}
+	if !w.To.IsZero() && !t.Before(w.To) {
+		return false
+	}
+	return true
+}
+
+// DayCount is the number of users created on a day.
+type DayCount struct {
+	Day   string `json:"day"`
+	Count int    `json:"count"`
+}
+
+// Stats are the aggregates for the users created in a window. Soft deleted
+// users are only counted in Deleted.
+type Stats struct {
+	Window Window `json:"window"`
+
+	Users   int `json:"users"`
+	Deleted int `json:"deleted"`
+	// Signups is the number of users created on each day with at least one
+	// signup, oldest first.
+	Signups []DayCount `json:"signups"`
+
+	// Confirmed is the number of users with a confirmed email or phone.
+	Confirmed        int     `json:"confirmed"`
+	ConfirmationRate float64 `json:"confirmation_rate"`
+
+	// Providers is the number of users with an identity of each provider. A
+	// user with several identities is counted for each provider.
+	Providers map[string]int `json:"providers"`
+
+	// MFA is the number of users with at least one verified factor.
+	MFA     int     `json:"mfa"`
+	MFARate float64 `json:"mfa_rate"`
+
+	Anonymous     int     `json:"anonymous"`
+	AnonymousRate float64 `json:"anonymous_rate"`
+
+	// Banned is the number of users banned at the time of the report.
+	Banned int `json:"banned"`
+
+	// SignedIn is the number of users who have signed in, and
+	// TimeToFirstSignIn the time from signup to first sign-in for them.
+	//
+	// Auth does not keep a user's first sign-in, so it is taken from the
+	// earliest sign-in it does keep: the last sign-in of the user and of
+	// each identity, and the creation of OAuth and SSO identities, which
+	// are created by signing in. It is exact for users who signed in once
+	// or who signed up with an OAuth or SSO provider.
+	SignedIn          int          `json:"signed_in"`
+	TimeToFirstSignIn DurationHist `json:"time_to_first_sign_in"`
+
+	signups map[string]int
+}
+
+// Report is the result of a run, with one Stats per window.
+type Report struct {
+	At      time.Time `json:"at"`
+	Windows []*Stats  `json:"windows"`
+}
+
+// Analyzer computes Reports.
+type Analyzer struct {
+	client auth.Client
+
+	// Windows are the windows to compute stats for. Defaults to AllTime.
+	Windows []Window
+	// Location is the time zone that signup days are counted in. Defaults
+	// to UTC.
+	Location *time.Location
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+	// PerPage is the page size used to list users. Defaults to 100.
+	PerPage int
+}
+
+// NewAnalyzer returns an Analyzer. The client must have an admin token set.
+func NewAnalyzer(client auth.Client, windows ...Window) *Analyzer {
+	return &Analyzer{
+		client:  client,
+		Windows: windows,
+		PerPage: 100,
+	}
+}
+
+// Run streams every user and returns the stats for each window.
+func (a *Analyzer) Run(ctx context.Context) (*Report, error) {
+	now := a.now()
+	windows := a.Windows
+	if len(windows) == 0 {
+		windows = []Window{AllTime}
+	}
+	report := &Report{At: now}
+	for _, w := range windows {
+		report.Windows = append(report.Windows, &Stats{
+			Window:            w,
+			Providers:         map[string]int{},
+			TimeToFirstSignIn: newDurationHist(),
+			signups:           map[string]int{},
+		})
+	}
+
+	err := auth.NewAdminUsersPaginator(a.client, a.PerPage).Walk(func(u types.User) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, s := range report.Windows {
+			if s.Window.contains(u.CreatedAt) {
+				a.add(s, &u, now)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range report.Windows {
+		s.finish()
+	}
+	return report, nil
+}
+
+func (a *Analyzer) add(s *Stats, u *types.User, now time.Time) {
+	if u.DeletedAt != nil {
+		s.Deleted++
+		return
+	}
+	s.Users++
+	s.signups[u.CreatedAt.In(a.location()).Format("2006-01-02")]++
+
+	if u.EmailConfirmedAt != nil || u.PhoneConfirmedAt != nil {
+		s.Confirmed++
+	}
+	seen := map[string]bool{}
+	for _, id := range u.Identities {
+		if !seen[id.Provider] {
+			seen[id.Provider] = true
+			s.Providers[id.Provider]++
+		}
+	}
+	for _, f := range u.Factors {
+		if f.Status == types.FactorStatusVerified {
+			s.MFA++
+			break
+		}
+	}
+	if u.IsAnonymous {
+		s.Anonymous++
+	}
+	if u.BannedUntil != nil && u.BannedUntil.After(now) {
+		s.Banned++
+	}
+	if first := firstSignIn(u); first != nil {
+		s.SignedIn++
+		s.TimeToFirstSignIn.add(first.Sub(u.CreatedAt))
+	}
+}
+
+// firstSignIn returns the earliest sign-in recorded for the user, or nil if
+// they never signed in.
+func firstSignIn(u *types.User) *time.Time {
+	var first *time.Time
+	earliest := func(t *time.Time) {
+		if t != nil && (first == nil || t.Before(*first)) {
+			first = t
+		}
+	}
+	earliest(u.LastSignInAt)
+	for i := range u.Identities {
+		id := &u.Identities[i]
+		earliest(id.LastSignInAt)
+		// Email and phone identities are created at signup, before the
+		// user can sign in.
+		if id.Provider != "email" && id.Provider != "phone" {
+			earliest(&id.CreatedAt)
+		}
+	}
+	return first
+}
+
+func (s *Stats) finish() {
+	s.Signups = make([]DayCount, 0, len(s.signups))
+	for day, n := range s.signups {
+		s.Signups = append(s.Signups, DayCount{Day: day, Count: n})
+	}
+	sort.Slice(s.Signups, func(i, j int) bool { return s.Signups[i].Day < s.Signups[j].Day })
+	s.ConfirmationRate = rate(s.Confirmed, s.Users)
+	s.MFARate = rate(s.MFA, s.Users)
+	s.AnonymousRate = rate(s.Anonymous, s.Users)
+}
+
+func rate(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+func (a *Analyzer) location() *time.Location {
+	if a.Location != nil {
+		return a.Location
+	}
+	return time.UTC
+}
+
+func (a *Analyzer) now() time.Time {
+	if a.Now != nil {
+		return a.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,140 @@
+package analytics_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supabase-community/auth-go/analytics"
+	"github.com/supabase-community/auth-go/authmock"
+	"github.com/supabase-community/auth-go/authtest"
+	"github.com/supabase-community/auth-go/types"
+)
+
+func TestAnalyzer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	now := start
+	cfg := authtest.DefaultConfig()
+	cfg.Now = func() time.Time { return now }
+	srv := authtest.NewServer(cfg)
+	defer srv.Close()
+	client := srv.AdminClient()
+	password := "password"
+
+	// ada signs up on day 1, signs in half an hour later and enrolls TOTP.
+	_, err := client.AdminCreateUser(types.AdminCreateUserRequest{Email: "ada@example.com", Password: &password, EmailConfirm: true})
+	require.NoError(err)
+	now = start.Add(30 * time.Minute)
+	token, err := srv.Client().SignInWithEmailPassword("ada@example.com", password)
+	require.NoError(err)
+	user := srv.Client().WithToken(token.AccessToken)
+	enrolled, err := user.EnrollFactor(types.EnrollFactorRequest{FactorType: types.FactorTypeTOTP})
+	require.NoError(err)
+	challenge, err := user.ChallengeFactor(types.ChallengeFactorRequest{FactorID: enrolled.ID})
+	require.NoError(err)
+	code, err := authtest.TOTP(enrolled.TOTP.Secret, now)
+	require.NoError(err)
+	_, err = user.VerifyFactor(types.VerifyFactorRequest{FactorID: enrolled.ID, ChallengeID: challenge.ID, Code: code})
+	require.NoError(err)
+
+	// bob signs up by phone on day 1, never confirms and is banned.
+	ban := types.BanDurationTime(30 * 24 * time.Hour)
+	now = start.Add(time.Hour)
+	bob, err := client.AdminCreateUser(types.AdminCreateUserRequest{Phone: "15550100"})
+	require.NoError(err)
+	_, err = client.AdminUpdateUser(types.AdminUpdateUserRequest{UserID: bob.ID, BanDuration: &ban})
+	require.NoError(err)
+
+	// carol and dan sign up on day 3; carol is soft deleted.
+	now = start.Add(2 * 24 * time.Hour)
+	carol, err := client.AdminCreateUser(types.AdminCreateUserRequest{Email: "carol@example.com", EmailConfirm: true})
+	require.NoError(err)
+	require.NoError(client.AdminDeleteUser(types.AdminDeleteUserRequest{UserID: carol.ID, ShouldSoftDelete: true}))
+	_, err = client.AdminCreateUser(types.AdminCreateUserRequest{Email: "dan@example.com"})
+	require.NoError(err)
+
+	now = start.Add(9 * 24 * time.Hour)
+	analyzer := analytics.NewAnalyzer(client, analytics.AllTime, analytics.LastDays(now, 8))
+	analyzer.Now = func() time.Time { return now }
+	analyzer.PerPage = 1
+	report, err := analyzer.Run(context.Background())
+	require.NoError(err)
+	require.Len(report.Windows, 2)
+
+	all := report.Windows[0]
+	assert.Equal(3, all.Users)
+	assert.Equal(1, all.Deleted)
+	assert.Equal([]analytics.DayCount{{Day: "2024-01-01", Count: 2}, {Day: "2024-01-03", Count: 1}}, all.Signups)
+	assert.Equal(1, all.Confirmed)
+	assert.InDelta(1.0/3, all.ConfirmationRate, 1e-9)
+	assert.Equal(map[string]int{"email": 2, "phone": 1}, all.Providers)
+	assert.Equal(1, all.MFA)
+	assert.Equal(0, all.Anonymous)
+	assert.Equal(1, all.Banned)
+	assert.Equal(1, all.SignedIn)
+	assert.Equal(1, all.TimeToFirstSignIn.Count)
+	assert.Equal(1800.0, all.TimeToFirstSignIn.MeanSeconds)
+	require.NotNil(all.TimeToFirstSignIn.MedianSeconds)
+	assert.Equal(3600.0, *all.TimeToFirstSignIn.MedianSeconds)
+
+	recent := report.Windows[1]
+	assert.Equal("last_8d", recent.Window.Name)
+	assert.Equal(1, recent.Users)
+	assert.Equal(1, recent.Deleted)
+	assert.Equal(0, recent.Confirmed)
+	assert.Equal(0, recent.SignedIn)
+
+	var out bytes.Buffer
+	require.NoError(report.WriteJSON(&out))
+	var decoded analytics.Report
+	require.NoError(json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(all.Providers, decoded.Windows[0].Providers)
+
+	out.Reset()
+	require.NoError(report.WriteCSV(&out))
+	rows, err := csv.NewReader(&out).ReadAll()
+	require.NoError(err)
+	assert.Equal([]string{"window", "metric", "key", "value"}, rows[0])
+	assert.Contains(rows, []string{"all", "signups", "2024-01-01", "2"})
+	assert.Contains(rows, []string{"all", "provider", "phone", "1"})
+	assert.Contains(rows, []string{"last_8d", "users", "", "1"})
+	assert.Contains(rows, []string{"all", "time_to_first_sign_in_bucket", "+Inf", "0"})
+}
+
+func TestTimeToFirstSignIn(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		v := created.Add(d)
+		return &v
+	}
+	// The user signed up with an email, first signed in with Google ten
+	// minutes later and has since signed in with their password again.
+	user := types.User{
+		CreatedAt:    created,
+		LastSignInAt: at(100 * 24 * time.Hour),
+		Identities: []types.Identity{
+			{Provider: "email", CreatedAt: created, LastSignInAt: at(100 * 24 * time.Hour)},
+			{Provider: "google", CreatedAt: *at(10 * time.Minute), LastSignInAt: at(30 * 24 * time.Hour)},
+		},
+	}
+	m := authmock.New()
+	m.On("AdminListUsers").Return(&types.AdminListUsersResponse{Users: []types.User{user}}, nil)
+
+	report, err := analytics.NewAnalyzer(m).Run(context.Background())
+	require.NoError(err)
+	stats := report.Windows[0]
+	assert.Equal(1, stats.SignedIn)
+	assert.Equal(600.0, stats.TimeToFirstSignIn.MeanSeconds)
+}
@@ -0,0 +1,78 @@
+package analytics
+
+import (
+	"math"
+	"time"
+)
+
+// bucketBounds are the upper bounds of the DurationHist buckets, with a final
+// unbounded bucket after them.
+var bucketBounds = []time.Duration{
+	time.Minute,
+	10 * time.Minute,
+	time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+	3 * 24 * time.Hour,
+	7 * 24 * time.Hour,
+	30 * 24 * time.Hour,
+	90 * 24 * time.Hour,
+	365 * 24 * time.Hour,
+}
+
+// Bucket counts the durations up to UpToSeconds, and above the previous
+// bucket's bound. The last bucket has no bound and an UpToSeconds of +Inf,
+// encoded as null in JSON.
+type Bucket struct {
+	UpToSeconds *float64 `json:"up_to_seconds"`
+	Count       int      `json:"count"`
+}
+
+// DurationHist is a fixed-size histogram of durations.
+type DurationHist struct {
+	Count       int     `json:"count"`
+	MeanSeconds float64 `json:"mean_seconds"`
+	MaxSeconds  float64 `json:"max_seconds"`
+	// MedianSeconds is the upper bound of the bucket holding the median, or
+	// +Inf (encoded as null) if that is the last bucket.
+	MedianSeconds *float64 `json:"median_seconds"`
+	Buckets       []Bucket `json:"buckets"`
+
+	// totalSeconds is a float64 rather than a time.Duration, which
+	// overflows after about 292 years of summed durations.
+	totalSeconds float64
+}
+
+func newDurationHist() DurationHist {
+	h := DurationHist{Buckets: make([]Bucket, len(bucketBounds)+1)}
+	for i, b := range bucketBounds {
+		s := b.Seconds()
+		h.Buckets[i].UpToSeconds = &s
+	}
+	return h
+}
+
+func (h *DurationHist) add(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	i := 0
+	for i < len(bucketBounds) && d > bucketBounds[i] {
+		i++
+	}
+	h.Buckets[i].Count++
+	h.Count++
+	h.totalSeconds += d.Seconds()
+	h.MeanSeconds = h.totalSeconds / float64(h.Count)
+	h.MaxSeconds = math.Max(h.MaxSeconds, d.Seconds())
+
+	h.MedianSeconds = nil
+	seen := 0
+	for _, b := range h.Buckets {
+		seen += b.Count
+		if 2*seen >= h.Count {
+			h.MedianSeconds = b.UpToSeconds
+			break
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes the report with one row per value, in the columns window,
+// metric, key and value. Key is the day, provider or histogram bucket for
+// the metrics that have one, and empty otherwise.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"window", "metric", "key", "value"}); err != nil {
+		return err
+	}
+	for _, s := range r.Windows {
+		for _, row := range s.rows() {
+			if err := cw.Write(append([]string{s.Window.Name}, row...)); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (s *Stats) rows() [][]string {
+	itoa := strconv.Itoa
+	ftoa := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+	rows := [][]string{
+		{"users", "", itoa(s.Users)},
+		{"deleted", "", itoa(s.Deleted)},
+		{"confirmed", "", itoa(s.Confirmed)},
+		{"confirmation_rate", "", ftoa(s.ConfirmationRate)},
+		{"mfa", "", itoa(s.MFA)},
+		{"mfa_rate", "", ftoa(s.MFARate)},
+		{"anonymous", "", itoa(s.Anonymous)},
+		{"anonymous_rate", "", ftoa(s.AnonymousRate)},
+		{"banned", "", itoa(s.Banned)},
+		{"signed_in", "", itoa(s.SignedIn)},
+	}
+	for _, d := range s.Signups {
+		rows = append(rows, []string{"signups", d.Day, itoa(d.Count)})
+	}
+
+	providers := make([]string, 0, len(s.Providers))
+	for p := range s.Providers {
+		providers = append(providers, p)
+	}
+	sort.Strings(providers)
+	for _, p := range providers {
+		rows = append(rows, []string{"provider", p, itoa(s.Providers[p])})
+	}
+
+	h := s.TimeToFirstSignIn
+	bound := func(b *float64) string {
+		if b == nil {
+			return "+Inf"
+		}
+		return ftoa(*b)
+	}
+	rows = append(rows,
+		[]string{"time_to_first_sign_in_mean_seconds", "", ftoa(h.MeanSeconds)},
+		[]string{"time_to_first_sign_in_max_seconds", "", ftoa(h.MaxSeconds)},
+	)
+	if h.Count > 0 {
+		rows = append(rows, []string{"time_to_first_sign_in_median_seconds", "", bound(h.MedianSeconds)})
+	}
+	for _, b := range h.Buckets {
+		rows = append(rows, []string{"time_to_first_sign_in_bucket", bound(b.UpToSeconds), itoa(b.Count)})
+	}
+	return rows
+}
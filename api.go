@@ -98,19 +98,43 @@ type Client interface {
 	//
 	// Get a list of users.
 	//
+	// The result may be paginated with Page and PerPage in the request. The
+	// response will include the total number of users, as well as the total
+	// number of pages and, if not already on the last page, the next page number.
+	//
+	// Users can be filtered by email or full name, and sorted by creation time.
+	//
 	// Requires admin token.
 	AdminListUsers(req types.AdminListUsersRequest) (*types.AdminListUsersResponse, error)
 	// GET /admin/users/{user_id}
 	//
 	// Get a user by their user_id.
 	AdminGetUser(req types.AdminGetUserRequest) (*types.AdminGetUserResponse, error)
+	// GET /admin/users?filter={email}
+	//
+	// Get a user by their email address. The email is compared case
+	// insensitively, ignoring surrounding whitespace.
+	//
+	// Returns *types.ErrUserNotFound if there is no user with the email.
+	AdminGetUserByEmail(req types.AdminGetUserByEmailRequest) (*types.AdminGetUserResponse, error)
+	// GET /admin/users
+	//
+	// Get a user by their phone number. Formatting such as spaces, dashes,
+	// brackets and a leading + is ignored when comparing numbers.
+	//
+	// Auth cannot filter users by phone number, so this pages through every
+	// user. Prefer AdminGetUser or AdminGetUserByEmail where possible.
+	//
+	// Returns *types.ErrUserNotFound if there is no user with the phone number.
+	AdminGetUserByPhone(req types.AdminGetUserByPhoneRequest) (*types.AdminGetUserResponse, error)
 	// PUT /admin/users/{user_id}
 	//
 	// Update a user by their user_id.
 	AdminUpdateUser(req types.AdminUpdateUserRequest) (*types.AdminUpdateUserResponse, error)
 	// DELETE /admin/users/{user_id}
 	//
-	// Delete a user by their user_id.
+	// Delete a user by their user_id. Set ShouldSoftDelete to soft delete the
+	// user instead.
 	AdminDeleteUser(req types.AdminDeleteUserRequest) error
 
 	// GET /admin/users/{user_id}/factors
@@ -0,0 +1,378 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/supabase-community/auth-go/types"
+)
+
+// FindingKind identifies the detector that produced a Finding.
+type FindingKind string
+
+const (
+	FindingSharedIPLogin          FindingKind = "shared_ip_login"
+	FindingRefreshStorm           FindingKind = "refresh_storm"
+	FindingIPSpread               FindingKind = "ip_spread"
+	FindingRecoveryFlood          FindingKind = "recovery_flood"
+	FindingFactorRemovedThenLogin FindingKind = "factor_removed_then_login"
+)
+
+// Severity rates how urgently a Finding should be looked at.
+type Severity string
+
+const (
+	SeverityLow    Severity = "low"
+	SeverityMedium Severity = "medium"
+	SeverityHigh   Severity = "high"
+)
+
+// Finding is suspicious activity flagged by a Detector.
+type Finding struct {
+	Kind     FindingKind
+	Severity Severity
+	// Key is the IP address or user ID the finding is about.
+	Key         string
+	Description string
+	// Start and End are the creation times of the first and last evidence
+	// entries.
+	Start time.Time
+	End   time.Time
+	// Evidence holds the entries that triggered the finding, oldest first.
+	Evidence []types.AuditLogEntry
+}
+
+func newFinding(kind FindingKind, severity Severity, key, description string, evidence []types.AuditLogEntry) Finding {
+	return Finding{
+		Kind:        kind,
+		Severity:    severity,
+		Key:         key,
+		Description: description,
+		Start:       evidence[0].CreatedAt,
+		End:         evidence[len(evidence)-1].CreatedAt,
+		Evidence:    evidence,
+	}
+}
+
+// Detector looks for one kind of suspicious activity. Entries are observed
+// oldest first, and a Detector keeps whatever state it needs between them.
+type Detector interface {
+	Observe(e types.AuditLogEntry) []Finding
+}
+
+// Analyzer runs audit log entries through a set of detectors. It is not safe
+// for concurrent use.
+type Analyzer struct {
+	detectors []Detector
+}
+
+// NewAnalyzer returns an Analyzer using detectors, or DefaultDetectors if
+// none are given.
+func NewAnalyzer(detectors ...Detector) *Analyzer {
+	if len(detectors) == 0 {
+		detectors = DefaultDetectors()
+	}
+	return &Analyzer{detectors: detectors}
+}
+
+// DefaultDetectors returns each detector in this package with its default
+// threshold and window.
+func DefaultDetectors() []Detector {
+	return []Detector{
+		NewSharedIPLoginDetector(10, 5*time.Minute),
+		NewRefreshStormDetector(30, time.Minute),
+		NewIPSpreadDetector(5, time.Hour),
+		NewRecoveryFloodDetector(3, time.Hour),
+		NewFactorRemovedThenLoginDetector(time.Hour),
+	}
+}
+
+// Observe passes the entry to each detector and returns their findings.
+// Entries must be observed in order of CreatedAt.
+func (a *Analyzer) Observe(e types.AuditLogEntry) []Finding {
+	var findings []Finding
+	for _, d := range a.detectors {
+		findings = append(findings, d.Observe(e)...)
+	}
+	return findings
+}
+
+// Analyze observes a batch of entries, in any order, and returns the
+// findings.
+func (a *Analyzer) Analyze(entries []types.AuditLogEntry) []Finding {
+	sorted := append([]types.AuditLogEntry(nil), entries...)
+	sortEntries(sorted)
+
+	var findings []Finding
+	for _, e := range sorted {
+		findings = append(findings, a.Observe(e)...)
+	}
+	return findings
+}
+
+// Run observes entries as they arrive, such as from Follower.Stream, and
+// calls fn with each finding. It returns nil once entries is closed, or
+// ctx.Err() if ctx is cancelled first.
+func (a *Analyzer) Run(ctx context.Context, entries <-chan types.AuditLogEntry, fn func(Finding)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e, ok := <-entries:
+			if !ok {
+				return nil
+			}
+			for _, f := range a.Observe(e) {
+				fn(f)
+			}
+		}
+	}
+}
+
+// ThresholdDetector flags a key once Threshold matching entries for it are
+// seen within Window. If Distinct is set, entries are only counted if they
+// have a different Distinct value from those already in the window.
+//
+// After a finding the key's window is cleared, so ongoing activity is
+// reported once per Threshold entries rather than once per entry.
+type ThresholdDetector struct {
+	Kind        FindingKind
+	Severity    Severity
+	Description string
+	Threshold   int
+	Window      time.Duration
+
+	Match    func(e types.AuditLogEntry) bool
+	Key      func(e types.AuditLogEntry) string
+	Distinct func(e types.AuditLogEntry) string
+
+	windows   map[string][]types.AuditLogEntry
+	lastSweep time.Time
+}
+
+func (d *ThresholdDetector) Observe(e types.AuditLogEntry) []Finding {
+	if !d.Match(e) {
+		return nil
+	}
+	key := d.Key(e)
+	if key == "" {
+		return nil
+	}
+	if d.windows == nil {
+		d.windows = make(map[string][]types.AuditLogEntry)
+	}
+	d.sweep(e.CreatedAt)
+
+	window := expire(d.windows[key], e.CreatedAt.Add(-d.Window))
+	window = append(window, e)
+
+	count := len(window)
+	if d.Distinct != nil {
+		values := make(map[string]bool)
+		for _, w := range window {
+			values[d.Distinct(w)] = true
+		}
+		count = len(values)
+	}
+	if count < d.Threshold {
+		d.windows[key] = window
+		return nil
+	}
+
+	delete(d.windows, key)
+	description := fmt.Sprintf("%s: %d within %s", d.Description, count, d.Window)
+	return []Finding{newFinding(d.Kind, d.Severity, key, description, window)}
+}
+
+// sweep drops expired entries for every key, so keys that are not seen again
+// don't hold on to memory.
+func (d *ThresholdDetector) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < d.Window {
+		return
+	}
+	d.lastSweep = now
+	for key, window := range d.windows {
+		if window = expire(window, now.Add(-d.Window)); len(window) == 0 {
+			delete(d.windows, key)
+		} else {
+			d.windows[key] = window
+		}
+	}
+}
+
+// expire drops entries created before cutoff from an ordered window.
+func expire(window []types.AuditLogEntry, cutoff time.Time) []types.AuditLogEntry {
+	i := 0
+	for i < len(window) && window[i].CreatedAt.Before(cutoff) {
+		i++
+	}
+	return window[i:]
+}
+
+// NewSharedIPLoginDetector flags an IP address that logs in to threshold
+// different accounts within window, as a successful credential stuffing
+// attack does.
+//
+// Auth only records successful logins in the audit log, so failed logins per
+// IP address, the usual sign of brute force and credential stuffing, cannot
+// be counted from it. This detector only sees the attempts that worked. The
+// verification attempt hooks in package hooks see failed attempts, but not
+// the IP address they came from.
+func NewSharedIPLoginDetector(threshold int, window time.Duration) *ThresholdDetector {
+	return &ThresholdDetector{
+		Kind:        FindingSharedIPLogin,
+		Severity:    SeverityHigh,
+		Description: "logins to different accounts from one IP address",
+		Threshold:   threshold,
+		Window:      window,
+		Match:       isLogin,
+		Key:         ipAddress,
+		Distinct:    subjectID,
+	}
+}
+
+// NewRefreshStormDetector flags a user whose sessions are refreshed
+// threshold times within window, which points to a broken client or a leaked
+// refresh token.
+func NewRefreshStormDetector(threshold int, window time.Duration) *ThresholdDetector {
+	return &ThresholdDetector{
+		Kind:        FindingRefreshStorm,
+		Severity:    SeverityMedium,
+		Description: "token refreshes",
+		Threshold:   threshold,
+		Window:      window,
+		Match:       isAction(types.AuditActionTokenRefreshed),
+		Key:         subjectID,
+	}
+}
+
+// NewIPSpreadDetector flags a user who logs in from threshold different IP
+// addresses within window.
+func NewIPSpreadDetector(threshold int, window time.Duration) *ThresholdDetector {
+	return &ThresholdDetector{
+		Kind:        FindingIPSpread,
+		Severity:    SeverityMedium,
+		Description: "logins from different IP addresses",
+		Threshold:   threshold,
+		Window:      window,
+		Match:       isLogin,
+		Key:         subjectID,
+		Distinct:    ipAddress,
+	}
+}
+
+// NewRecoveryFloodDetector flags a user who has threshold password recovery
+// requests within window.
+func NewRecoveryFloodDetector(threshold int, window time.Duration) *ThresholdDetector {
+	return &ThresholdDetector{
+		Kind:        FindingRecoveryFlood,
+		Severity:    SeverityMedium,
+		Description: "password recovery requests",
+		Threshold:   threshold,
+		Window:      window,
+		Match:       isAction(types.AuditActionUserRecoveryRequested),
+		Key:         subjectID,
+	}
+}
+
+// SequenceDetector flags a key when an entry matching Then follows an entry
+// matching First within Window.
+type SequenceDetector struct {
+	Kind        FindingKind
+	Severity    Severity
+	Description string
+	Window      time.Duration
+
+	First func(e types.AuditLogEntry) bool
+	Then  func(e types.AuditLogEntry) bool
+	Key   func(e types.AuditLogEntry) string
+
+	pending   map[string][]types.AuditLogEntry
+	lastSweep time.Time
+}
+
+func (d *SequenceDetector) Observe(e types.AuditLogEntry) []Finding {
+	first, then := d.First(e), d.Then(e)
+	if !first && !then {
+		return nil
+	}
+	key := d.Key(e)
+	if key == "" {
+		return nil
+	}
+	if d.pending == nil {
+		d.pending = make(map[string][]types.AuditLogEntry)
+	}
+	d.sweep(e.CreatedAt)
+
+	var findings []Finding
+	if then {
+		if pending := expire(d.pending[key], e.CreatedAt.Add(-d.Window)); len(pending) > 0 {
+			evidence := append(pending, e)
+			findings = append(findings, newFinding(d.Kind, d.Severity, key, d.Description, evidence))
+		}
+		delete(d.pending, key)
+	}
+	if first {
+		d.pending[key] = append(d.pending[key], e)
+	}
+	return findings
+}
+
+func (d *SequenceDetector) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < d.Window {
+		return
+	}
+	d.lastSweep = now
+	for key, pending := range d.pending {
+		if pending = expire(pending, now.Add(-d.Window)); len(pending) == 0 {
+			delete(d.pending, key)
+		} else {
+			d.pending[key] = pending
+		}
+	}
+}
+
+// NewFactorRemovedThenLoginDetector flags a user who logs in within window
+// of an MFA factor being removed from their account, which is how an
+// attacker with a stolen password gets past MFA.
+func NewFactorRemovedThenLoginDetector(window time.Duration) *SequenceDetector {
+	return &SequenceDetector{
+		Kind:        FindingFactorRemovedThenLogin,
+		Severity:    SeverityHigh,
+		Description: "login after an MFA factor was removed",
+		Window:      window,
+		First:       isAction(types.AuditActionFactorDeleted, types.AuditActionFactorUnenrolled),
+		Then:        isLogin,
+		Key:         subjectID,
+	}
+}
+
+func isAction(actions ...types.AuditAction) func(types.AuditLogEntry) bool {
+	return func(e types.AuditLogEntry) bool {
+		action := e.Action()
+		for _, a := range actions {
+			if action == a {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+var isLogin = isAction(types.AuditActionLogin, types.AuditActionMFACodeLogin)
+
+func ipAddress(e types.AuditLogEntry) string {
+	return e.IPAddress
+}
+
+// subjectID returns the ID of the user an entry is about: the user_id trait
+// for actions taken by an admin, otherwise the actor.
+func subjectID(e types.AuditLogEntry) string {
+	p := e.ParsePayload()
+	if id := p.Trait("user_id"); id != "" {
+		return id
+	}
+	return p.ActorID
+}
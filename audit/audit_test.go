@@ -0,0 +1,563 @@
+package audit_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/audit"
+	"github.com/supabase-community/auth-go/authmock"
+	"github.com/supabase-community/auth-go/authtest"
+	"github.com/supabase-community/auth-go/types"
+)
+
+type testServer struct {
+	*authtest.Server
+	mu    sync.Mutex
+	now   time.Time
+	admin auth.Client
+	n     int
+}
+
+func newTestServer(t *testing.T) *testServer {
+	ts := &testServer{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cfg := authtest.DefaultConfig()
+	cfg.Now = func() time.Time {
+		ts.mu.Lock()
+		defer ts.mu.Unlock()
+		return ts.now
+	}
+	ts.Server = authtest.NewServer(cfg)
+	t.Cleanup(ts.Close)
+	ts.admin = ts.AdminClient()
+	return ts
+}
+
+// createUsers creates n users, each adding a user_signedup entry to the
+// audit log a second apart.
+func (ts *testServer) createUsers(t *testing.T, n int) {
+	for i := 0; i < n; i++ {
+		ts.mu.Lock()
+		ts.now = ts.now.Add(time.Second)
+		ts.mu.Unlock()
+		ts.n++
+		_, err := ts.admin.AdminCreateUser(types.AdminCreateUserRequest{
+			Email: fmt.Sprintf("user%d@example.com", ts.n),
+		})
+		require.NoError(t, err)
+	}
+}
+
+func emails(entries []types.AuditLogEntry) []string {
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.ParsePayload().Trait("user_email"))
+	}
+	return out
+}
+
+func TestFollowerPoll(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ts := newTestServer(t)
+	ts.createUsers(t, 5)
+
+	f := audit.NewFollower(ts.admin, audit.NewMemoryCheckpointStore())
+	f.PerPage = 2
+	entries, err := f.Poll()
+	require.NoError(err)
+	assert.Equal([]string{
+		"user1@example.com",
+		"user2@example.com",
+		"user3@example.com",
+		"user4@example.com",
+		"user5@example.com",
+	}, emails(entries))
+
+	f.Start = ts.now
+	entries, err = f.Poll()
+	require.NoError(err)
+	assert.Equal([]string{"user5@example.com"}, emails(entries))
+}
+
+func TestFollowerRunResumes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ts := newTestServer(t)
+	ts.createUsers(t, 3)
+	store := audit.NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoint.json"))
+
+	run := func(stopAfter int) []types.AuditLogEntry {
+		f := audit.NewFollower(ts.admin, store)
+		f.PerPage = 2
+		f.Interval = time.Millisecond
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var handled []types.AuditLogEntry
+		err := f.Run(ctx, func(e types.AuditLogEntry) error {
+			handled = append(handled, e)
+			if len(handled) == stopAfter {
+				cancel()
+			}
+			return nil
+		})
+		assert.ErrorIs(err, context.Canceled)
+		return handled
+	}
+
+	assert.Equal([]string{"user1@example.com", "user2@example.com"}, emails(run(2)))
+
+	// Entries created in the same second are told apart by ID.
+	ts.mu.Lock()
+	ts.now = ts.now.Add(-time.Second)
+	ts.mu.Unlock()
+	ts.createUsers(t, 2)
+
+	handled := emails(run(3))
+	require.Len(handled, 3)
+	assert.ElementsMatch([]string{"user3@example.com", "user4@example.com"}, handled[:2])
+	assert.Equal("user5@example.com", handled[2])
+
+	cp, err := store.Load()
+	require.NoError(err)
+	require.NotNil(cp)
+	assert.Equal(ts.now, cp.CreatedAt)
+	assert.Len(cp.IDs, 1)
+}
+
+// New entries added between page reads shift older entries onto the next
+// page. They must not be delivered twice.
+func TestFollowerShiftingPages(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ts := newTestServer(t)
+	ts.createUsers(t, 4)
+
+	m := authmock.New()
+	m.On("AdminAudit").Run(func(args ...interface{}) []interface{} {
+		req := args[0].(types.AdminAuditRequest)
+		resp, err := ts.admin.AdminAudit(req)
+		if req.Page == 1 {
+			ts.createUsers(t, 1)
+		}
+		return []interface{}{resp, err}
+	})
+
+	f := audit.NewFollower(m, audit.NewMemoryCheckpointStore())
+	f.PerPage = 2
+	entries, err := f.Poll()
+	require.NoError(err)
+	assert.Equal([]string{
+		"user1@example.com",
+		"user2@example.com",
+		"user3@example.com",
+		"user4@example.com",
+	}, emails(entries))
+}
+
+func TestFollowerStream(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := newTestServer(t)
+	ts.createUsers(t, 2)
+
+	store := audit.NewMemoryCheckpointStore()
+	f := audit.NewFollower(ts.admin, store)
+	f.Interval = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	entries, errc := f.Stream(ctx, 0)
+	var got []types.AuditLogEntry
+	got = append(got, <-entries, <-entries)
+	ts.createUsers(t, 1)
+	got = append(got, <-entries)
+	cancel()
+	for range entries {
+	}
+	assert.ErrorIs(<-errc, context.Canceled)
+	assert.Equal([]string{"user1@example.com", "user2@example.com", "user3@example.com"}, emails(got))
+}
+
+func TestExportFormats(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ts := newTestServer(t)
+	start := ts.now
+	ts.createUsers(t, 5)
+
+	newExporter := func(format audit.Format) *audit.Exporter {
+		e := audit.NewExporter(ts.admin)
+		e.Format = format
+		e.PerPage = 2
+		e.From = start.Add(2 * time.Second)
+		e.To = start.Add(5 * time.Second)
+		return e
+	}
+
+	var buf bytes.Buffer
+	part, err := newExporter(audit.FormatJSONL).Export(&buf)
+	require.NoError(err)
+	assert.Equal(3, part.Count)
+	assert.Equal(map[string]int{"user_signedup": 3}, part.Counts)
+	assert.Equal(start.Add(4*time.Second), part.Newest.UTC())
+	assert.Equal(start.Add(2*time.Second), part.Oldest.UTC())
+	assert.Equal(int64(buf.Len()), part.Bytes)
+	sum := sha256.Sum256(buf.Bytes())
+	assert.Equal(hex.EncodeToString(sum[:]), part.SHA256)
+
+	var entries []types.AuditLogEntry
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var e types.AuditLogEntry
+		require.NoError(json.Unmarshal(scanner.Bytes(), &e))
+		entries = append(entries, e)
+	}
+	assert.Equal([]string{
+		"user4@example.com",
+		"user3@example.com",
+		"user2@example.com",
+	}, emails(entries))
+
+	buf.Reset()
+	_, err = newExporter(audit.FormatCSV).Export(&buf)
+	require.NoError(err)
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(err)
+	require.Len(rows, 4)
+	assert.Equal("id", rows[0][0])
+	assert.Equal(entries[0].ID.String(), rows[1][0])
+	assert.Equal("user_signedup", rows[1][3])
+	assert.Equal("team", rows[1][4])
+
+	buf.Reset()
+	_, err = newExporter(audit.FormatECS).Export(&buf)
+	require.NoError(err)
+	var doc struct {
+		Timestamp time.Time `json:"@timestamp"`
+		Event     struct {
+			ID       string   `json:"id"`
+			Action   string   `json:"action"`
+			Category []string `json:"category"`
+		} `json:"event"`
+	}
+	line, err := buf.ReadBytes('\n')
+	require.NoError(err)
+	require.NoError(json.Unmarshal(line, &doc))
+	assert.Equal(start.Add(4*time.Second), doc.Timestamp)
+	assert.Equal(entries[0].ID.String(), doc.Event.ID)
+	assert.Equal("user_signedup", doc.Event.Action)
+	assert.Equal([]string{"iam"}, doc.Event.Category)
+
+	buf.Reset()
+	_, err = newExporter(audit.FormatCEF).Export(&buf)
+	require.NoError(err)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(lines, 3)
+	assert.True(strings.HasPrefix(lines[0], "CEF:0|Supabase|Auth|1|user_signedup|user signedup|3|"))
+	assert.Contains(lines[0], "externalId="+entries[0].ID.String())
+	assert.Contains(lines[0], `"user_email":"user4@example.com"`)
+
+	_, err = newExporter("xml").Export(&buf)
+	assert.ErrorIs(err, audit.ErrUnknownFormat)
+}
+
+func TestExportDirResumes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ts := newTestServer(t)
+	ts.createUsers(t, 5)
+	dir := t.TempDir()
+
+	// Fail on the second page, after the first part has been written.
+	errUnavailable := errors.New("unavailable")
+	m := authmock.New()
+	m.On("AdminAudit").Run(func(args ...interface{}) []interface{} {
+		req := args[0].(types.AdminAuditRequest)
+		if req.Page > 1 {
+			return []interface{}{(*types.AdminAuditResponse)(nil), errUnavailable}
+		}
+		resp, err := ts.admin.AdminAudit(req)
+		return []interface{}{resp, err}
+	})
+
+	e := audit.NewExporter(m)
+	e.PerPage = 2
+	e.PartSize = 2
+	e.Gzip = true
+	_, err := e.ExportDir(dir)
+	require.ErrorIs(err, errUnavailable)
+
+	e = audit.NewExporter(ts.admin)
+	e.PerPage = 2
+	e.PartSize = 2
+	_, err = e.ExportDir(dir)
+	assert.ErrorIs(err, audit.ErrManifestMismatch)
+
+	// Entries added since the export started are newer than the cursor.
+	ts.createUsers(t, 1)
+
+	e.Gzip = true
+	manifest, err := e.ExportDir(dir)
+	require.NoError(err)
+	assert.True(manifest.Complete)
+	assert.Equal(5, manifest.Count)
+	assert.Equal(map[string]int{"user_signedup": 5}, manifest.Counts)
+	require.Len(manifest.Parts, 3)
+
+	var entries []types.AuditLogEntry
+	for i, part := range manifest.Parts {
+		assert.Equal(fmt.Sprintf("audit-%05d.jsonl.gz", i+1), part.File)
+		data, err := os.ReadFile(filepath.Join(dir, part.File))
+		require.NoError(err)
+		sum := sha256.Sum256(data)
+		assert.Equal(hex.EncodeToString(sum[:]), part.SHA256)
+
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		require.NoError(err)
+		dec := json.NewDecoder(gz)
+		for dec.More() {
+			var e types.AuditLogEntry
+			require.NoError(dec.Decode(&e))
+			entries = append(entries, e)
+		}
+	}
+	assert.Equal([]string{
+		"user5@example.com",
+		"user4@example.com",
+		"user3@example.com",
+		"user2@example.com",
+		"user1@example.com",
+	}, emails(entries))
+
+	// A complete export is not repeated.
+	again, err := e.ExportDir(dir)
+	require.NoError(err)
+	assert.Equal(manifest.Parts, again.Parts)
+}
+
+func auditEntry(at time.Time, action types.AuditAction, actorID, ip string, traits map[string]interface{}) types.AuditLogEntry {
+	return types.AuditLogEntry{
+		ID:        uuid.New(),
+		CreatedAt: at,
+		IPAddress: ip,
+		Payload: map[string]interface{}{
+			"action":   string(action),
+			"log_type": string(action.LogType()),
+			"actor_id": actorID,
+			"traits":   traits,
+		},
+	}
+}
+
+func TestAnalyzerDetectors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	var entries []types.AuditLogEntry
+	// Four accounts logged in to from one IP within a minute.
+	for i := 0; i < 4; i++ {
+		entries = append(entries, auditEntry(at(time.Duration(i)*10*time.Second), types.AuditActionLogin, fmt.Sprintf("user-%d", i), "203.0.113.1", nil))
+	}
+	// The same IP logging in to one account repeatedly is not flagged.
+	for i := 0; i < 4; i++ {
+		entries = append(entries, auditEntry(at(time.Duration(i)*10*time.Second), types.AuditActionLogin, "user-a", "203.0.113.2", nil))
+	}
+	// One account logging in from three IPs.
+	for i := 0; i < 3; i++ {
+		entries = append(entries, auditEntry(at(time.Hour+time.Duration(i)*time.Minute), types.AuditActionLogin, "user-b", fmt.Sprintf("198.51.100.%d", i), nil))
+	}
+	// Refreshes spread out further than the window are not flagged.
+	for i := 0; i < 3; i++ {
+		entries = append(entries, auditEntry(at(time.Duration(i)*time.Hour), types.AuditActionTokenRefreshed, "user-c", "", nil))
+	}
+	for i := 0; i < 3; i++ {
+		entries = append(entries, auditEntry(at(time.Duration(i)*time.Second), types.AuditActionTokenRefreshed, "user-d", "", nil))
+	}
+	// An admin removes a factor, then the user logs in.
+	entries = append(entries,
+		auditEntry(at(2*time.Hour), types.AuditActionFactorDeleted, "admin", "", map[string]interface{}{"user_id": "user-e"}),
+		auditEntry(at(2*time.Hour+time.Minute), types.AuditActionLogin, "user-e", "192.0.2.1", nil),
+	)
+
+	a := audit.NewAnalyzer(
+		audit.NewSharedIPLoginDetector(3, time.Minute),
+		audit.NewIPSpreadDetector(3, 10*time.Minute),
+		audit.NewRefreshStormDetector(3, time.Minute),
+		audit.NewFactorRemovedThenLoginDetector(time.Hour),
+	)
+	findings := a.Analyze(entries)
+
+	byKind := make(map[audit.FindingKind][]audit.Finding)
+	for _, f := range findings {
+		byKind[f.Kind] = append(byKind[f.Kind], f)
+	}
+	require.Len(byKind[audit.FindingSharedIPLogin], 1)
+	shared := byKind[audit.FindingSharedIPLogin][0]
+	assert.Equal("203.0.113.1", shared.Key)
+	assert.Len(shared.Evidence, 3)
+	assert.Equal(at(0), shared.Start)
+	assert.Equal(at(20*time.Second), shared.End)
+
+	require.Len(byKind[audit.FindingIPSpread], 1)
+	assert.Equal("user-b", byKind[audit.FindingIPSpread][0].Key)
+
+	require.Len(byKind[audit.FindingRefreshStorm], 1)
+	assert.Equal("user-d", byKind[audit.FindingRefreshStorm][0].Key)
+
+	require.Len(byKind[audit.FindingFactorRemovedThenLogin], 1)
+	seq := byKind[audit.FindingFactorRemovedThenLogin][0]
+	assert.Equal("user-e", seq.Key)
+	require.Len(seq.Evidence, 2)
+	assert.Equal(types.AuditActionFactorDeleted, seq.Evidence[0].Action())
+	assert.Equal(types.AuditActionLogin, seq.Evidence[1].Action())
+
+	assert.Len(findings, 4)
+}
+
+func TestAnalyzerRun(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ts := newTestServer(t)
+	_, err := ts.admin.AdminCreateUser(types.AdminCreateUserRequest{Email: "user@example.com"})
+	require.NoError(err)
+	for i := 0; i < 3; i++ {
+		_, err = ts.admin.AdminGenerateLink(types.AdminGenerateLinkRequest{
+			Type:  types.LinkTypeRecovery,
+			Email: "user@example.com",
+		})
+		require.NoError(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f := audit.NewFollower(ts.admin, audit.NewMemoryCheckpointStore())
+	entries, _ := f.Stream(ctx, 0)
+
+	findings := make(chan audit.Finding, 1)
+	go audit.NewAnalyzer().Run(ctx, entries, func(f audit.Finding) {
+		findings <- f
+	})
+
+	select {
+	case finding := <-findings:
+		assert.Equal(audit.FindingRecoveryFlood, finding.Kind)
+		assert.Len(finding.Evidence, 3)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no finding")
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ts := newTestServer(t)
+	ts.createUsers(t, 1)
+	password := "password123"
+	user, err := ts.admin.AdminCreateUser(types.AdminCreateUserRequest{
+		Email:        "timeline@example.com",
+		Password:     &password,
+		EmailConfirm: true,
+	})
+	require.NoError(err)
+
+	ts.mu.Lock()
+	ts.now = ts.now.Add(time.Minute)
+	ts.mu.Unlock()
+	_, err = ts.Client().SignInWithEmailPassword("timeline@example.com", "password123")
+	require.NoError(err)
+
+	ts.mu.Lock()
+	ts.now = ts.now.Add(time.Minute)
+	ts.mu.Unlock()
+	ban := types.BanDurationTime(24 * time.Hour)
+	_, err = ts.admin.AdminUpdateUser(types.AdminUpdateUserRequest{UserID: user.ID, BanDuration: &ban})
+	require.NoError(err)
+	ts.createUsers(t, 1)
+
+	timeline, err := audit.NewTimelineBuilder(ts.admin).Build(user.ID)
+	require.NoError(err)
+	assert.Equal(user.ID, timeline.User.ID)
+
+	var kinds []audit.EventKind
+	for _, ev := range timeline.Events {
+		kinds = append(kinds, ev.Kind)
+	}
+	assert.ElementsMatch([]audit.EventKind{
+		audit.EventSignUp,
+		audit.EventConfirmed,
+		audit.EventIdentity,
+		audit.EventLogin,
+		audit.EventAdminEdit,
+		audit.EventBanned,
+	}, kinds)
+	for i := 1; i < len(timeline.Events); i++ {
+		assert.False(timeline.Events[i].Time.Before(timeline.Events[i-1].Time))
+	}
+
+	for _, ev := range timeline.Events {
+		switch ev.Kind {
+		case audit.EventSignUp:
+			assert.True(ev.ByAdmin)
+			assert.Equal(audit.SourceAudit, ev.Source)
+		case audit.EventLogin:
+			assert.False(ev.ByAdmin)
+			assert.Equal("email", ev.Provider)
+			assert.Equal("Logged in with email", ev.Summary)
+		case audit.EventBanned:
+			assert.Equal(audit.SourceUser, ev.Source)
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(timeline.WriteText(&buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(lines, 7)
+	assert.Equal("User "+user.ID.String()+" <timeline@example.com>", lines[0])
+
+	data, err := json.Marshal(timeline)
+	require.NoError(err)
+	var decoded audit.Timeline
+	require.NoError(json.Unmarshal(data, &decoded))
+	assert.Len(decoded.Events, 6)
+
+	// Without the audit log, the login is taken from the user.
+	purged := audit.NewTimeline(timeline.User, nil)
+	var logins []audit.TimelineEvent
+	for _, ev := range purged.Events {
+		if ev.Kind == audit.EventLogin {
+			logins = append(logins, ev)
+		}
+	}
+	require.Len(logins, 1)
+	assert.Equal(audit.SourceUser, logins[0].Source)
+	assert.Equal("email", logins[0].Provider)
+	assert.Equal("Last signed in with email", logins[0].Summary)
+}
@@ -0,0 +1,131 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/supabase-community/auth-go/internal/atomicfile"
+)
+
+// Checkpoint records how far a Follower has read the audit log.
+type Checkpoint struct {
+	// CreatedAt is the time of the newest entry delivered.
+	CreatedAt time.Time `json:"created_at"`
+	// IDs holds the IDs of the delivered entries created at CreatedAt, since
+	// more entries with the same time may still be added.
+	IDs []uuid.UUID `json:"ids,omitempty"`
+}
+
+// delivered reports whether the entry is covered by the checkpoint.
+func (c Checkpoint) delivered(id uuid.UUID, createdAt time.Time) bool {
+	if createdAt.Before(c.CreatedAt) {
+		return true
+	}
+	if !createdAt.Equal(c.CreatedAt) {
+		return false
+	}
+	for _, seen := range c.IDs {
+		if seen == id {
+			return true
+		}
+	}
+	return false
+}
+
+// advance returns the checkpoint after delivering an entry. Entries must be
+// delivered in order of CreatedAt.
+func (c Checkpoint) advance(id uuid.UUID, createdAt time.Time) Checkpoint {
+	if createdAt.Equal(c.CreatedAt) {
+		return Checkpoint{
+			CreatedAt: c.CreatedAt,
+			IDs:       append(append([]uuid.UUID(nil), c.IDs...), id),
+		}
+	}
+	return Checkpoint{CreatedAt: createdAt, IDs: []uuid.UUID{id}}
+}
+
+// CheckpointStore persists a Follower's checkpoint, so it can resume where it
+// left off after a restart.
+type CheckpointStore interface {
+	// Load returns the saved checkpoint, or nil if there is none.
+	Load() (*Checkpoint, error)
+	Save(c Checkpoint) error
+}
+
+var _ CheckpointStore = &MemoryCheckpointStore{}
+
+// MemoryCheckpointStore is a CheckpointStore that keeps the checkpoint in
+// memory. It is lost on restart.
+type MemoryCheckpointStore struct {
+	mu sync.Mutex
+	c  *Checkpoint
+}
+
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{}
+}
+
+func (m *MemoryCheckpointStore) Load() (*Checkpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.c == nil {
+		return nil, nil
+	}
+	c := *m.c
+	return &c, nil
+}
+
+func (m *MemoryCheckpointStore) Save(c Checkpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.c = &c
+	return nil
+}
+
+var _ CheckpointStore = &FileCheckpointStore{}
+
+// FileCheckpointStore is a CheckpointStore that saves the checkpoint as JSON
+// in a file. The file is replaced atomically, so a crash while saving leaves
+// the previous checkpoint in place.
+type FileCheckpointStore struct {
+	path string
+}
+
+func NewFileCheckpointStore(path string) *FileCheckpointStore {
+	return &FileCheckpointStore{path: path}
+}
+
+func (f *FileCheckpointStore) Load() (*Checkpoint, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var c Checkpoint
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %w", f.path, err)
+	}
+	return &c, nil
+}
+
+func (f *FileCheckpointStore) Save(c Checkpoint) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(f.path, data); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
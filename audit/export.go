@@ -0,0 +1,723 @@
+package audit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/internal/atomicfile"
+	"github.com/supabase-community/auth-go/types"
+)
+
+// Format is the format entries are written in by an Exporter.
+type Format string
+
+const (
+	// FormatJSONL writes each entry as it is returned by Auth, one JSON
+	// object per line.
+	FormatJSONL Format = "jsonl"
+	// FormatCSV writes a header row, then one row per entry with the payload
+	// split into columns.
+	FormatCSV Format = "csv"
+	// FormatECS writes one Elastic Common Schema JSON document per line.
+	FormatECS Format = "ecs"
+	// FormatCEF writes one ArcSight Common Event Format line per entry.
+	FormatCEF Format = "cef"
+)
+
+const (
+	defaultPartSize  = 100000
+	manifestFileName = "manifest.json"
+)
+
+var (
+	ErrUnknownFormat    = errors.New("unknown export format")
+	ErrManifestMismatch = errors.New("existing export manifest does not match exporter settings")
+)
+
+// Exporter writes the audit log entries created in a time range to files for
+// archiving or ingestion by a SIEM.
+//
+// Auth can't filter the audit log by time, so every page newer than To is
+// read and entries are filtered on CreatedAt. Entries are written newest
+// first, in the order Auth returns them; since reading stops at the first
+// entry older than From, an export of a recent range is much cheaper than one
+// of an old range.
+type Exporter struct {
+	client auth.Client
+
+	// Format is the output format. Defaults to FormatJSONL.
+	Format Format
+	// From and To limit the export to entries created at or after From and
+	// before To. A zero time leaves that end of the range open.
+	From time.Time
+	To   time.Time
+	// Query, if set, only exports entries matching it.
+	Query *types.AuditQuery
+	// PerPage is the page size used to read the audit log. Defaults to 100.
+	PerPage uint
+	// Gzip compresses the output.
+	Gzip bool
+	// PartSize is the number of entries written to each file by ExportDir.
+	// Defaults to 100000.
+	PartSize int
+}
+
+// NewExporter returns an Exporter that reads the audit log with client, which
+// must have an admin token.
+func NewExporter(client auth.Client) *Exporter {
+	return &Exporter{client: client}
+}
+
+// Manifest summarises an export written by ExportDir. It is saved as
+// manifest.json in the export directory and updated as each part is
+// completed.
+type Manifest struct {
+	Format Format            `json:"format"`
+	Gzip   bool              `json:"gzip"`
+	From   time.Time         `json:"from"`
+	To     time.Time         `json:"to"`
+	Query  *types.AuditQuery `json:"query,omitempty"`
+	Parts  []ManifestPart    `json:"parts"`
+	Count  int               `json:"count"`
+	Counts map[string]int    `json:"counts"`
+	// Complete is set once the whole range has been exported.
+	Complete bool `json:"complete"`
+	// Cursor records the oldest entry exported so far, so an interrupted
+	// export can be resumed.
+	Cursor *Checkpoint `json:"cursor,omitempty"`
+}
+
+// ManifestPart describes one file of an export.
+type ManifestPart struct {
+	// File is the name of the file, relative to the export directory. It is
+	// empty for exports written by Export.
+	File  string `json:"file,omitempty"`
+	Count int    `json:"count"`
+	Bytes int64  `json:"bytes"`
+	// SHA256 is the hex encoded hash of the file, after compression.
+	SHA256 string `json:"sha256"`
+	// Newest and Oldest are the creation times of the first and last entries
+	// in the file.
+	Newest time.Time `json:"newest"`
+	Oldest time.Time `json:"oldest"`
+	// Counts holds the number of entries for each action.
+	Counts map[string]int `json:"counts"`
+}
+
+// Export writes every entry in the range to w and returns a summary of what
+// was written. Export can't be resumed; use ExportDir for large exports.
+func (e *Exporter) Export(w io.Writer) (*ManifestPart, error) {
+	pw, err := e.newPartWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	err = e.walk(Checkpoint{}, func(entry types.AuditLogEntry) error {
+		return pw.write(entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	part, err := pw.close()
+	if err != nil {
+		return nil, err
+	}
+	return &part, nil
+}
+
+// ExportDir writes every entry in the range to numbered files in dir, each
+// holding up to PartSize entries, and keeps a manifest of the completed
+// files in dir/manifest.json.
+//
+// If dir already holds a manifest for an incomplete export with the same
+// settings, the export resumes after the oldest entry of the last completed
+// file, and a partly written file is replaced. Entries added newer than that
+// entry are not exported when resuming, so set To for an export that must be
+// complete. ErrManifestMismatch is returned if the settings differ.
+func (e *Exporter) ExportDir(dir string) (*Manifest, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	m, err := e.loadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if m.Complete {
+		return m, nil
+	}
+
+	partSize := e.PartSize
+	if partSize <= 0 {
+		partSize = defaultPartSize
+	}
+
+	var cursor Checkpoint
+	if m.Cursor != nil {
+		cursor = *m.Cursor
+	}
+
+	var (
+		f    *os.File
+		pw   *partWriter
+		name string
+		next = cursor
+	)
+	finish := func() error {
+		part, err := pw.close()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		part.File = name
+		m.add(part)
+		m.Cursor = &next
+		pw = nil
+		return saveManifest(dir, m)
+	}
+
+	err = e.walk(cursor, func(entry types.AuditLogEntry) error {
+		if pw == nil {
+			name = e.partName(len(m.Parts) + 1)
+			var err error
+			f, err = os.Create(filepath.Join(dir, name))
+			if err != nil {
+				return err
+			}
+			if pw, err = e.newPartWriter(f); err != nil {
+				f.Close()
+				return err
+			}
+		}
+		if err := pw.write(entry); err != nil {
+			f.Close()
+			return err
+		}
+		next = next.advance(entry.ID, entry.CreatedAt)
+		if pw.part.Count >= partSize {
+			return finish()
+		}
+		return nil
+	})
+	if err != nil {
+		if pw != nil {
+			f.Close()
+		}
+		return nil, err
+	}
+	if pw != nil {
+		if err := finish(); err != nil {
+			return nil, err
+		}
+	}
+
+	m.Complete = true
+	if err := saveManifest(dir, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// walk calls fn with each entry in the range that is older than cursor,
+// newest first. A zero cursor starts at the newest entry.
+func (e *Exporter) walk(cursor Checkpoint, fn func(types.AuditLogEntry) error) error {
+	perPage := e.PerPage
+	if perPage == 0 {
+		perPage = defaultPerPage
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	p := auth.NewAdminAuditPaginator(e.client, e.Query, perPage)
+	return p.Walk(func(entry types.AuditLogEntry) error {
+		if !e.To.IsZero() && !entry.CreatedAt.Before(e.To) {
+			return nil
+		}
+		if !e.From.IsZero() && entry.CreatedAt.Before(e.From) {
+			return auth.ErrStopWalk
+		}
+		if !cursor.CreatedAt.IsZero() && exported(cursor, entry) {
+			return nil
+		}
+		// Entries added while reading shift later pages, so the same entry
+		// may be returned twice.
+		if seen[entry.ID] {
+			return nil
+		}
+		seen[entry.ID] = true
+		return fn(entry)
+	})
+}
+
+// exported reports whether the entry was exported before cursor, which
+// records the oldest exported entries.
+func exported(cursor Checkpoint, entry types.AuditLogEntry) bool {
+	if entry.CreatedAt.After(cursor.CreatedAt) {
+		return true
+	}
+	if !entry.CreatedAt.Equal(cursor.CreatedAt) {
+		return false
+	}
+	for _, id := range cursor.IDs {
+		if id == entry.ID {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Exporter) format() Format {
+	if e.Format == "" {
+		return FormatJSONL
+	}
+	return e.Format
+}
+
+func (e *Exporter) partName(n int) string {
+	ext := string(e.format())
+	if e.format() == FormatECS {
+		ext = "ecs.jsonl"
+	}
+	name := fmt.Sprintf("audit-%05d.%s", n, ext)
+	if e.Gzip {
+		name += ".gz"
+	}
+	return name
+}
+
+func (e *Exporter) loadManifest(dir string) (*Manifest, error) {
+	settings := &Manifest{
+		Format: e.format(),
+		Gzip:   e.Gzip,
+		From:   e.From,
+		To:     e.To,
+		Query:  e.Query,
+		Parts:  []ManifestPart{},
+		Counts: map[string]int{},
+	}
+
+	path := filepath.Join(dir, manifestFileName)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return settings, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+	if m.Format != settings.Format || m.Gzip != settings.Gzip ||
+		!m.From.Equal(settings.From) || !m.To.Equal(settings.To) ||
+		!sameQuery(m.Query, settings.Query) {
+		return nil, ErrManifestMismatch
+	}
+	if m.Counts == nil {
+		m.Counts = map[string]int{}
+	}
+	return &m, nil
+}
+
+func sameQuery(a, b *types.AuditQuery) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func saveManifest(dir string, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(filepath.Join(dir, manifestFileName), data); err != nil {
+		return fmt.Errorf("failed to save manifest: %w", err)
+	}
+	return nil
+}
+
+func (m *Manifest) add(part ManifestPart) {
+	m.Parts = append(m.Parts, part)
+	m.Count += part.Count
+	for action, n := range part.Counts {
+		m.Counts[action] += n
+	}
+}
+
+// partWriter encodes entries to a file, counting and hashing what is
+// written.
+type partWriter struct {
+	enc  encoder
+	buf  *bufio.Writer
+	gz   *gzip.Writer
+	hash hash.Hash
+	n    *countingWriter
+	part ManifestPart
+}
+
+func (e *Exporter) newPartWriter(w io.Writer) (*partWriter, error) {
+	pw := &partWriter{
+		hash: sha256.New(),
+		part: ManifestPart{Counts: map[string]int{}},
+	}
+	pw.n = &countingWriter{w: io.MultiWriter(w, pw.hash)}
+
+	var out io.Writer = pw.n
+	if e.Gzip {
+		pw.gz = gzip.NewWriter(out)
+		out = pw.gz
+	}
+	pw.buf = bufio.NewWriter(out)
+
+	switch e.format() {
+	case FormatJSONL:
+		pw.enc = &jsonlEncoder{w: pw.buf}
+	case FormatCSV:
+		pw.enc = newCSVEncoder(pw.buf)
+	case FormatECS:
+		pw.enc = &ecsEncoder{w: pw.buf}
+	case FormatCEF:
+		pw.enc = &cefEncoder{w: pw.buf}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, e.Format)
+	}
+	return pw, nil
+}
+
+func (pw *partWriter) write(entry types.AuditLogEntry) error {
+	if err := pw.enc.encode(entry); err != nil {
+		return err
+	}
+	if pw.part.Count == 0 {
+		pw.part.Newest = entry.CreatedAt
+	}
+	pw.part.Oldest = entry.CreatedAt
+	pw.part.Count++
+	pw.part.Counts[string(entry.Action())]++
+	return nil
+}
+
+func (pw *partWriter) close() (ManifestPart, error) {
+	if err := pw.enc.flush(); err != nil {
+		return ManifestPart{}, err
+	}
+	if err := pw.buf.Flush(); err != nil {
+		return ManifestPart{}, err
+	}
+	if pw.gz != nil {
+		if err := pw.gz.Close(); err != nil {
+			return ManifestPart{}, err
+		}
+	}
+	pw.part.Bytes = pw.n.n
+	pw.part.SHA256 = hex.EncodeToString(pw.hash.Sum(nil))
+	return pw.part, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type encoder interface {
+	encode(entry types.AuditLogEntry) error
+	flush() error
+}
+
+type jsonlEncoder struct {
+	w io.Writer
+}
+
+func (j *jsonlEncoder) encode(entry types.AuditLogEntry) error {
+	return writeJSONLine(j.w, entry)
+}
+
+func (j *jsonlEncoder) flush() error { return nil }
+
+func writeJSONLine(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+var csvHeader = []string{
+	"id",
+	"created_at",
+	"ip_address",
+	"action",
+	"log_type",
+	"actor_id",
+	"actor_username",
+	"actor_name",
+	"actor_via_sso",
+	"traits",
+}
+
+type csvEncoder struct {
+	w      *csv.Writer
+	header bool
+}
+
+func newCSVEncoder(w io.Writer) *csvEncoder {
+	return &csvEncoder{w: csv.NewWriter(w)}
+}
+
+func (c *csvEncoder) encode(entry types.AuditLogEntry) error {
+	if !c.header {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+		c.header = true
+	}
+
+	p := entry.ParsePayload()
+	traits := ""
+	if len(p.Traits) > 0 {
+		data, err := json.Marshal(p.Traits)
+		if err != nil {
+			return err
+		}
+		traits = string(data)
+	}
+	return c.w.Write([]string{
+		entry.ID.String(),
+		entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+		entry.IPAddress,
+		string(p.Action),
+		string(p.LogType),
+		p.ActorID,
+		p.ActorUsername,
+		p.ActorName,
+		strconv.FormatBool(p.ActorViaSSO),
+		traits,
+	})
+}
+
+func (c *csvEncoder) flush() error {
+	if !c.header {
+		// Write the header even if there are no entries, so the file can
+		// still be read as CSV.
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+		c.header = true
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// ecsVersion is the version of the Elastic Common Schema written by
+// FormatECS.
+const ecsVersion = "8.11.0"
+
+type ecsEvent struct {
+	Timestamp time.Time `json:"@timestamp"`
+	ECS       struct {
+		Version string `json:"version"`
+	} `json:"ecs"`
+	Event struct {
+		ID       string   `json:"id"`
+		Action   string   `json:"action"`
+		Kind     string   `json:"kind"`
+		Category []string `json:"category"`
+		Type     []string `json:"type"`
+		Dataset  string   `json:"dataset"`
+		Provider string   `json:"provider"`
+	} `json:"event"`
+	Source *struct {
+		IP string `json:"ip"`
+	} `json:"source,omitempty"`
+	User struct {
+		ID       string `json:"id,omitempty"`
+		Name     string `json:"name,omitempty"`
+		FullName string `json:"full_name,omitempty"`
+	} `json:"user"`
+	Supabase struct {
+		Auth struct {
+			LogType     string                 `json:"log_type,omitempty"`
+			ActorViaSSO bool                   `json:"actor_via_sso"`
+			Traits      map[string]interface{} `json:"traits,omitempty"`
+		} `json:"auth"`
+	} `json:"supabase"`
+}
+
+type ecsEncoder struct {
+	w io.Writer
+}
+
+func (c *ecsEncoder) encode(entry types.AuditLogEntry) error {
+	p := entry.ParsePayload()
+
+	var ev ecsEvent
+	ev.Timestamp = entry.CreatedAt.UTC()
+	ev.ECS.Version = ecsVersion
+	ev.Event.ID = entry.ID.String()
+	ev.Event.Action = string(p.Action)
+	ev.Event.Kind = "event"
+	ev.Event.Category, ev.Event.Type = ecsCategory(p)
+	ev.Event.Dataset = "supabase.auth"
+	ev.Event.Provider = "supabase-auth"
+	if entry.IPAddress != "" {
+		ev.Source = &struct {
+			IP string `json:"ip"`
+		}{IP: entry.IPAddress}
+	}
+	ev.User.ID = p.ActorID
+	ev.User.Name = p.ActorUsername
+	ev.User.FullName = p.ActorName
+	ev.Supabase.Auth.LogType = string(p.LogType)
+	ev.Supabase.Auth.ActorViaSSO = p.ActorViaSSO
+	ev.Supabase.Auth.Traits = p.Traits
+	return writeJSONLine(c.w, ev)
+}
+
+func (c *ecsEncoder) flush() error { return nil }
+
+// ecsCategory maps an audit action to ECS event.category and event.type
+// values.
+func ecsCategory(p types.AuditPayload) ([]string, []string) {
+	switch p.Action {
+	case types.AuditActionLogin, types.AuditActionMFACodeLogin:
+		return []string{"authentication"}, []string{"start"}
+	case types.AuditActionLogout:
+		return []string{"authentication"}, []string{"end"}
+	case types.AuditActionTokenRefreshed, types.AuditActionVerificationAttempted,
+		types.AuditActionChallengeCreated:
+		return []string{"authentication"}, []string{"info"}
+	case types.AuditActionTokenRevoked:
+		return []string{"authentication", "session"}, []string{"end"}
+	case types.AuditActionUserSignedUp, types.AuditActionUserInvited, types.AuditActionInviteAccepted:
+		return []string{"iam"}, []string{"user", "creation"}
+	case types.AuditActionUserDeleted:
+		return []string{"iam"}, []string{"user", "deletion"}
+	case types.AuditActionFactorDeleted, types.AuditActionFactorUnenrolled, types.AuditActionIdentityUnlinked:
+		return []string{"iam"}, []string{"user", "change"}
+	}
+	switch p.LogType {
+	case types.AuditLogTypeUser, types.AuditLogTypeFactor, types.AuditLogTypeRecoveryCodes, types.AuditLogTypeTeam:
+		return []string{"iam"}, []string{"user", "change"}
+	}
+	return []string{"authentication"}, []string{"info"}
+}
+
+type cefEncoder struct {
+	w io.Writer
+}
+
+func (c *cefEncoder) encode(entry types.AuditLogEntry) error {
+	p := entry.ParsePayload()
+
+	var b strings.Builder
+	b.WriteString("CEF:0|Supabase|Auth|1|")
+	b.WriteString(cefHeaderEscape(string(p.Action)))
+	b.WriteByte('|')
+	b.WriteString(cefHeaderEscape(cefName(p)))
+	b.WriteByte('|')
+	b.WriteString(strconv.Itoa(cefSeverity(p.Action)))
+	b.WriteByte('|')
+
+	ext := [][2]string{
+		{"rt", strconv.FormatInt(entry.CreatedAt.UnixNano()/int64(time.Millisecond), 10)},
+		{"externalId", entry.ID.String()},
+		{"act", string(p.Action)},
+		{"cat", string(p.LogType)},
+	}
+	if entry.IPAddress != "" {
+		ext = append(ext, [2]string{"src", entry.IPAddress})
+	}
+	if p.ActorID != "" {
+		ext = append(ext, [2]string{"suid", p.ActorID})
+	}
+	if p.ActorUsername != "" {
+		ext = append(ext, [2]string{"suser", p.ActorUsername})
+	}
+	if len(p.Traits) > 0 {
+		data, err := json.Marshal(p.Traits)
+		if err != nil {
+			return err
+		}
+		ext = append(ext,
+			[2]string{"cs1Label", "traits"},
+			[2]string{"cs1", string(data)},
+		)
+	}
+	for i, kv := range ext {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(kv[0])
+		b.WriteByte('=')
+		b.WriteString(cefExtensionEscape(kv[1]))
+	}
+	b.WriteByte('\n')
+
+	_, err := io.WriteString(c.w, b.String())
+	return err
+}
+
+func (c *cefEncoder) flush() error { return nil }
+
+func cefName(p types.AuditPayload) string {
+	if p.Action == "" {
+		return "unknown"
+	}
+	return strings.ReplaceAll(string(p.Action), "_", " ")
+}
+
+// cefSeverity rates actions that remove users, credentials or sessions
+// higher than routine logins and changes.
+func cefSeverity(action types.AuditAction) int {
+	switch action {
+	case types.AuditActionUserDeleted, types.AuditActionFactorDeleted,
+		types.AuditActionFactorUnenrolled, types.AuditActionIdentityUnlinked:
+		return 6
+	case types.AuditActionTokenRevoked, types.AuditActionUserUpdatedPassword,
+		types.AuditActionUserRecoveryRequested, types.AuditActionGenerateRecoveryCodes:
+		return 5
+	}
+	return 3
+}
+
+var (
+	cefHeaderReplacer    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefExtensionReplacer = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+func cefHeaderEscape(s string) string {
+	return cefHeaderReplacer.Replace(s)
+}
+
+func cefExtensionEscape(s string) string {
+	return cefExtensionReplacer.Replace(s)
+}
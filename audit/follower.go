@@ -0,0 +1,212 @@
+// Package audit provides tools for reading the Auth audit log: following it
+// as entries are added, exporting it, analysing it, and building the
+// history of a single account.
+package audit
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/types"
+)
+
+const (
+	defaultPollInterval = 10 * time.Second
+	defaultPerPage      = 100
+)
+
+// Follower tails the audit log, delivering each entry once and in order of
+// CreatedAt.
+//
+// The audit log is read newest first, one page at a time, so entries added
+// while a poll is in progress shift the page boundaries. Each poll keeps
+// reading until it reaches entries that were already delivered, and drops
+// entries seen twice, so shifted entries are neither missed nor repeated.
+//
+// After each entry is handled the checkpoint is saved, so a restarted
+// Follower resumes after the last handled entry. An entry may be delivered
+// again if the process stops between handling it and saving the checkpoint.
+type Follower struct {
+	client auth.Client
+	store  CheckpointStore
+
+	// Query, if set, only follows entries matching it.
+	Query *types.AuditQuery
+	// PerPage is the page size used to read the audit log. Defaults to 100.
+	PerPage uint
+	// Interval is the time between polls. Defaults to 10 seconds.
+	Interval time.Duration
+	// Start is used when there is no saved checkpoint: only entries created
+	// at or after it are delivered. If zero, the whole audit log is delivered.
+	Start time.Time
+}
+
+// NewFollower returns a Follower that reads the audit log with client, which
+// must have an admin token, and saves its checkpoint in store.
+func NewFollower(client auth.Client, store CheckpointStore) *Follower {
+	return &Follower{
+		client: client,
+		store:  store,
+	}
+}
+
+// Poll returns the entries added since the checkpoint, oldest first. It does
+// not save the checkpoint; use Run or Stream to do that as entries are
+// handled.
+func (f *Follower) Poll() ([]types.AuditLogEntry, error) {
+	cp, err := f.checkpoint()
+	if err != nil {
+		return nil, err
+	}
+	return f.poll(cp)
+}
+
+func (f *Follower) poll(cp Checkpoint) ([]types.AuditLogEntry, error) {
+	perPage := f.PerPage
+	if perPage == 0 {
+		perPage = defaultPerPage
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	var entries []types.AuditLogEntry
+	var page uint = 1
+	for {
+		resp, err := f.client.AdminAudit(types.AdminAuditRequest{
+			Query:   f.Query,
+			Page:    page,
+			PerPage: perPage,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		reachedCheckpoint := false
+		for _, e := range resp.Logs {
+			if cp.delivered(e.ID, e.CreatedAt) {
+				// Entries created at the checkpoint time may be in any
+				// order, so keep reading until older entries are reached.
+				if e.CreatedAt.Before(cp.CreatedAt) {
+					reachedCheckpoint = true
+				}
+				continue
+			}
+			if seen[e.ID] {
+				continue
+			}
+			seen[e.ID] = true
+			entries = append(entries, e)
+		}
+
+		if reachedCheckpoint || resp.NextPage == 0 || resp.NextPage <= page || len(resp.Logs) == 0 {
+			break
+		}
+		page = resp.NextPage
+	}
+
+	sortEntries(entries)
+	return entries, nil
+}
+
+// sortEntries sorts entries oldest first. Entries created at the same time
+// are ordered by ID, so the order is the same on every poll.
+func sortEntries(entries []types.AuditLogEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].ID.String() < entries[j].ID.String()
+		}
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+}
+
+// Run polls the audit log until ctx is cancelled, calling handler for each
+// new entry. The checkpoint is saved after each entry is handled. If handler
+// returns an error, Run stops and returns it, and the entry will be
+// delivered again on the next run.
+//
+// Run returns ctx.Err() when ctx is cancelled.
+func (f *Follower) Run(ctx context.Context, handler func(types.AuditLogEntry) error) error {
+	cp, err := f.checkpoint()
+	if err != nil {
+		return err
+	}
+
+	interval := f.Interval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		entries, err := f.poll(cp)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := handler(e); err != nil {
+				return err
+			}
+			cp = cp.advance(e.ID, e.CreatedAt)
+			if err := f.store.Save(cp); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stream runs the Follower in the background, sending new entries on the
+// returned channel, which holds up to buffer entries. The checkpoint is saved
+// once an entry has been sent on the channel, so entries still in the buffer
+// when the receiver stops are not delivered again. Use a buffer of 0 if every
+// entry must be received.
+//
+// The error channel receives the error that stopped the Follower, which is
+// ctx.Err() when ctx is cancelled, and is then closed along with the entries
+// channel.
+func (f *Follower) Stream(ctx context.Context, buffer int) (<-chan types.AuditLogEntry, <-chan error) {
+	entries := make(chan types.AuditLogEntry, buffer)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(errc)
+		defer close(entries)
+
+		errc <- f.Run(ctx, func(e types.AuditLogEntry) error {
+			select {
+			case entries <- e:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	return entries, errc
+}
+
+func (f *Follower) checkpoint() (Checkpoint, error) {
+	cp, err := f.store.Load()
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	if cp != nil {
+		return *cp, nil
+	}
+	if !f.Start.IsZero() {
+		return Checkpoint{CreatedAt: f.Start}, nil
+	}
+	return Checkpoint{}, nil
+}
@@ -0,0 +1,338 @@
+package audit
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/types"
+)
+
+// EventKind classifies a TimelineEvent.
+type EventKind string
+
+const (
+	EventSignUp                EventKind = "signup"
+	EventInvited               EventKind = "invited"
+	EventConfirmationRequested EventKind = "confirmation_requested"
+	EventConfirmed             EventKind = "confirmed"
+	EventLogin                 EventKind = "login"
+	EventLogout                EventKind = "logout"
+	EventSession               EventKind = "session"
+	EventRecoveryRequested     EventKind = "recovery_requested"
+	EventPasswordChanged       EventKind = "password_changed"
+	EventMFA                   EventKind = "mfa"
+	EventIdentity              EventKind = "identity"
+	EventBanned                EventKind = "banned"
+	EventUserEdit              EventKind = "user_edit"
+	EventAdminEdit             EventKind = "admin_edit"
+	EventDeleted               EventKind = "deleted"
+	EventOther                 EventKind = "other"
+)
+
+// TimelineSource says where a TimelineEvent came from.
+type TimelineSource string
+
+const (
+	// SourceAudit events come from an audit log entry.
+	SourceAudit TimelineSource = "audit"
+	// SourceUser events come from timestamps on the user, for things the
+	// audit log doesn't record or no longer holds.
+	SourceUser TimelineSource = "user"
+)
+
+// TimelineEvent is one thing that happened to an account.
+type TimelineEvent struct {
+	Time    time.Time      `json:"time"`
+	Kind    EventKind      `json:"kind"`
+	Source  TimelineSource `json:"source"`
+	Summary string         `json:"summary"`
+	// ByAdmin is set for audit log entries recorded by someone other than
+	// the user, usually with an admin token.
+	ByAdmin   bool   `json:"by_admin,omitempty"`
+	Actor     string `json:"actor,omitempty"`
+	Provider  string `json:"provider,omitempty"`
+	IPAddress string `json:"ip_address,omitempty"`
+	// Entry is the audit log entry the event was built from, if any.
+	Entry *types.AuditLogEntry `json:"entry,omitempty"`
+}
+
+// Timeline is the history of one account, oldest event first.
+type Timeline struct {
+	User   types.User      `json:"user"`
+	Events []TimelineEvent `json:"events"`
+}
+
+// TimelineBuilder builds account timelines from the user and the audit log.
+type TimelineBuilder struct {
+	client auth.Client
+
+	// PerPage is the page size used to read the audit log. Defaults to 100.
+	PerPage uint
+	// Since, if set, leaves out audit log entries created before it. The
+	// audit log is read back to the time the user was created, so this
+	// limits the cost for old accounts.
+	Since time.Time
+}
+
+// NewTimelineBuilder returns a TimelineBuilder that reads users and the
+// audit log with client, which must have an admin token.
+func NewTimelineBuilder(client auth.Client) *TimelineBuilder {
+	return &TimelineBuilder{client: client}
+}
+
+// timelineSkew allows for audit log entries being timestamped slightly
+// before the user row they belong to.
+const timelineSkew = time.Minute
+
+// Build returns the timeline for the user. It includes audit log entries
+// where the user is the actor, and entries recorded by admins about the
+// user, such as edits, bans and factor deletions.
+func (b *TimelineBuilder) Build(userID uuid.UUID) (*Timeline, error) {
+	resp, err := b.client.AdminGetUser(types.AdminGetUserRequest{UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+	user := resp.User
+
+	oldest := user.CreatedAt.Add(-timelineSkew)
+	if b.Since.After(oldest) {
+		oldest = b.Since
+	}
+
+	perPage := b.PerPage
+	if perPage == 0 {
+		perPage = defaultPerPage
+	}
+
+	id := userID.String()
+	seen := make(map[uuid.UUID]bool)
+	var entries []types.AuditLogEntry
+	p := auth.NewAdminAuditPaginator(b.client, nil, perPage)
+	err = p.Walk(func(e types.AuditLogEntry) error {
+		if e.CreatedAt.Before(oldest) {
+			return auth.ErrStopWalk
+		}
+		if seen[e.ID] || (e.ParsePayload().ActorID != id && subjectID(e) != id) {
+			return nil
+		}
+		seen[e.ID] = true
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewTimeline(user, entries), nil
+}
+
+// NewTimeline builds a timeline from a user and the audit log entries about
+// them, in any order.
+func NewTimeline(user types.User, entries []types.AuditLogEntry) *Timeline {
+	sorted := append([]types.AuditLogEntry(nil), entries...)
+	sortEntries(sorted)
+
+	t := &Timeline{User: user, Events: []TimelineEvent{}}
+	kinds := make(map[EventKind]bool)
+	var logins []time.Time
+	for i := range sorted {
+		ev := auditEvent(user.ID.String(), &sorted[i])
+		kinds[ev.Kind] = true
+		if ev.Kind == EventLogin {
+			logins = append(logins, ev.Time)
+		}
+		t.Events = append(t.Events, ev)
+	}
+
+	userEvent := func(at time.Time, kind EventKind, summary string) {
+		t.Events = append(t.Events, TimelineEvent{
+			Time:    at,
+			Kind:    kind,
+			Source:  SourceUser,
+			Summary: summary,
+		})
+	}
+	if !kinds[EventSignUp] && !kinds[EventInvited] {
+		userEvent(user.CreatedAt, EventSignUp, "Account created")
+	}
+	// Confirmations are not recorded in the audit log, apart from accepted
+	// invites.
+	if user.EmailConfirmedAt != nil {
+		userEvent(*user.EmailConfirmedAt, EventConfirmed, "Email "+user.Email+" confirmed")
+	}
+	if user.PhoneConfirmedAt != nil {
+		userEvent(*user.PhoneConfirmedAt, EventConfirmed, "Phone "+user.Phone+" confirmed")
+	}
+	for _, identity := range user.Identities {
+		t.Events = append(t.Events, TimelineEvent{
+			Time:     identity.CreatedAt,
+			Kind:     EventIdentity,
+			Source:   SourceUser,
+			Summary:  "Identity linked: " + identity.Provider,
+			Provider: identity.Provider,
+		})
+	}
+	// The last sign-ins of the user and of each identity are shown when the
+	// audit log no longer holds them, e.g. after it was purged.
+	login := func(at *time.Time, provider string) {
+		if at == nil || loggedInAt(logins, *at) {
+			return
+		}
+		logins = append(logins, *at)
+		summary := "Last signed in"
+		if provider != "" {
+			summary += " with " + provider
+		}
+		t.Events = append(t.Events, TimelineEvent{
+			Time:     *at,
+			Kind:     EventLogin,
+			Source:   SourceUser,
+			Summary:  summary,
+			Provider: provider,
+		})
+	}
+	for _, identity := range user.Identities {
+		login(identity.LastSignInAt, identity.Provider)
+	}
+	login(user.LastSignInAt, "")
+	for _, factor := range user.Factors {
+		summary := fmt.Sprintf("%s factor enrolled", strings.ToUpper(factor.FactorType))
+		if factor.FriendlyName != "" {
+			summary += fmt.Sprintf(" (%s)", factor.FriendlyName)
+		}
+		userEvent(factor.CreatedAt, EventMFA, summary)
+	}
+	// Auth records bans as a user_modified entry like any other edit, so a
+	// current ban is shown at the time the user was last updated.
+	if user.BannedUntil != nil && user.BannedUntil.After(user.UpdatedAt) {
+		userEvent(user.UpdatedAt, EventBanned, "Banned until "+user.BannedUntil.UTC().Format(time.RFC3339))
+	}
+
+	sort.SliceStable(t.Events, func(i, j int) bool {
+		return t.Events[i].Time.Before(t.Events[j].Time)
+	})
+	return t
+}
+
+// loggedInAt reports whether one of the logins is within timelineSkew of at.
+func loggedInAt(logins []time.Time, at time.Time) bool {
+	for _, l := range logins {
+		if d := l.Sub(at); d > -timelineSkew && d < timelineSkew {
+			return true
+		}
+	}
+	return false
+}
+
+func auditEvent(userID string, e *types.AuditLogEntry) TimelineEvent {
+	p := e.ParsePayload()
+	ev := TimelineEvent{
+		Time:      e.CreatedAt,
+		Source:    SourceAudit,
+		ByAdmin:   p.ActorID != userID,
+		Actor:     p.ActorUsername,
+		Provider:  p.Provider(),
+		IPAddress: e.IPAddress,
+		Entry:     e,
+	}
+	if ev.Actor == "" {
+		ev.Actor = p.ActorID
+	}
+
+	switch p.Action {
+	case types.AuditActionUserSignedUp:
+		ev.Kind, ev.Summary = EventSignUp, "Signed up"
+		if ev.ByAdmin {
+			ev.Summary = "Created by admin"
+		}
+	case types.AuditActionUserRepeatedSignUp:
+		ev.Kind, ev.Summary = EventSignUp, "Tried to sign up again"
+	case types.AuditActionUserInvited:
+		ev.Kind, ev.Summary = EventInvited, "Invited"
+	case types.AuditActionInviteAccepted:
+		ev.Kind, ev.Summary = EventConfirmed, "Accepted invite"
+	case types.AuditActionUserConfirmationRequested:
+		ev.Kind, ev.Summary = EventConfirmationRequested, "Confirmation requested"
+	case types.AuditActionLogin:
+		ev.Kind, ev.Summary = EventLogin, "Logged in"
+	case types.AuditActionMFACodeLogin:
+		ev.Kind, ev.Summary = EventLogin, "Logged in with MFA"
+	case types.AuditActionLogout:
+		ev.Kind, ev.Summary = EventLogout, "Logged out"
+	case types.AuditActionTokenRefreshed:
+		ev.Kind, ev.Summary = EventSession, "Session refreshed"
+	case types.AuditActionTokenRevoked:
+		ev.Kind, ev.Summary = EventSession, "Refresh token revoked"
+	case types.AuditActionUserRecoveryRequested:
+		ev.Kind, ev.Summary = EventRecoveryRequested, "Password recovery requested"
+	case types.AuditActionUserUpdatedPassword:
+		ev.Kind, ev.Summary = EventPasswordChanged, "Password changed"
+	case types.AuditActionUserModified:
+		ev.Kind, ev.Summary = EventUserEdit, "Updated their account"
+		if ev.ByAdmin {
+			ev.Kind, ev.Summary = EventAdminEdit, "Updated by admin"
+		}
+	case types.AuditActionUserDeleted:
+		ev.Kind, ev.Summary = EventDeleted, "Deleted"
+	case types.AuditActionFactorInProgress:
+		ev.Kind, ev.Summary = EventMFA, "Started enrolling an MFA factor"
+	case types.AuditActionFactorUnenrolled:
+		ev.Kind, ev.Summary = EventMFA, "Unenrolled an MFA factor"
+	case types.AuditActionFactorDeleted:
+		ev.Kind, ev.Summary = EventMFA, "MFA factor deleted"
+	case types.AuditActionFactorUpdated:
+		ev.Kind, ev.Summary = EventMFA, "MFA factor updated"
+	case types.AuditActionChallengeCreated:
+		ev.Kind, ev.Summary = EventMFA, "MFA challenge created"
+	case types.AuditActionVerificationAttempted:
+		ev.Kind, ev.Summary = EventMFA, "MFA challenge verified"
+	case types.AuditActionGenerateRecoveryCodes:
+		ev.Kind, ev.Summary = EventMFA, "Recovery codes generated"
+	case types.AuditActionIdentityUnlinked:
+		ev.Kind, ev.Summary = EventIdentity, "Identity unlinked"
+	default:
+		ev.Kind, ev.Summary = EventOther, string(p.Action)
+	}
+	if ev.Provider != "" {
+		ev.Summary += " with " + ev.Provider
+	}
+	return ev
+}
+
+// WriteText writes the timeline as one line per event, for reading in a
+// terminal or pasting into a support ticket.
+func (t *Timeline) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "User %s", t.User.ID)
+	if t.User.Email != "" {
+		fmt.Fprintf(&b, " <%s>", t.User.Email)
+	}
+	if t.User.Phone != "" {
+		fmt.Fprintf(&b, " %s", t.User.Phone)
+	}
+	b.WriteByte('\n')
+
+	for _, ev := range t.Events {
+		fmt.Fprintf(&b, "%s  %-22s  %s", ev.Time.UTC().Format(time.RFC3339), ev.Kind, ev.Summary)
+		if ev.ByAdmin {
+			if ev.Actor != "" {
+				fmt.Fprintf(&b, " (by %s)", ev.Actor)
+			} else {
+				b.WriteString(" (by admin)")
+			}
+		}
+		if ev.IPAddress != "" {
+			fmt.Fprintf(&b, " from %s", ev.IPAddress)
+		}
+		b.WriteByte('\n')
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
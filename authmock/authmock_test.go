@@ -0,0 +1,146 @@
+package authmock_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/authmock"
+	"github.com/supabase-community/auth-go/types"
+)
+
+type recordingT struct {
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestStubs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	m := authmock.New()
+	id := uuid.New()
+	m.On("AdminGetUser").
+		With(types.AdminGetUserRequest{UserID: id}).
+		Return(&types.AdminGetUserResponse{User: types.User{ID: id}}, nil)
+	m.On("AdminGetUser").Return(nil, errors.New("not found"))
+	m.On("Logout").Return(nil).Once()
+
+	// Options return the same mock, so the stubs apply to the copy.
+	var client auth.Client = m
+	client = client.WithToken("token")
+
+	user, err := client.AdminGetUser(types.AdminGetUserRequest{UserID: id})
+	require.NoError(err)
+	assert.Equal(id, user.ID)
+
+	user, err = client.AdminGetUser(types.AdminGetUserRequest{UserID: uuid.New()})
+	assert.EqualError(err, "not found")
+	assert.Nil(user)
+
+	assert.NoError(client.Logout())
+	err = client.Logout()
+	assert.ErrorIs(err, authmock.ErrUnexpectedCall)
+
+	calls := m.CallsTo("AdminGetUser")
+	require.Len(calls, 2)
+	assert.Equal(types.AdminGetUserRequest{UserID: id}, calls[0].Args[0])
+	assert.Len(m.Calls(), 5)
+
+	rt := &recordingT{}
+	assert.False(m.AssertExpectations(rt))
+	require.Len(rt.errors, 1)
+	assert.Contains(rt.errors[0], "unexpected call to Logout()")
+}
+
+func TestSequentialResponses(t *testing.T) {
+	assert := assert.New(t)
+
+	m := authmock.New()
+	m.On("HealthCheck").
+		Return(nil, errors.New("unavailable")).
+		Return(&types.HealthCheckResponse{Version: "v2"}, nil)
+	m.On("SignInWithEmailPassword").
+		With("user@example.com", authmock.Anything).
+		Run(func(args ...interface{}) []interface{} {
+			return []interface{}{&types.TokenResponse{Session: types.Session{AccessToken: args[1].(string)}}, nil}
+		})
+	m.On("Recover").Maybe()
+
+	_, err := m.HealthCheck()
+	assert.Error(err)
+	for i := 0; i < 2; i++ {
+		health, err := m.HealthCheck()
+		assert.NoError(err)
+		assert.Equal("v2", health.Version)
+	}
+
+	token, err := m.SignInWithEmailPassword("user@example.com", "password")
+	assert.NoError(err)
+	assert.Equal("password", token.AccessToken)
+
+	// Run may call back into the mock.
+	m.On("GetUser").Return(&types.UserResponse{User: types.User{Email: "user@example.com"}}, nil)
+	m.On("Reauthenticate").Run(func(args ...interface{}) []interface{} {
+		_, err := m.GetUser()
+		return []interface{}{err}
+	})
+	assert.NoError(m.Reauthenticate())
+
+	assert.True(m.AssertExpectations(t))
+}
+
+func TestMissingExpectations(t *testing.T) {
+	m := authmock.New()
+	m.On("GetUser").Return(&types.UserResponse{}, nil)
+	m.On("Reauthenticate").Return(nil).Times(2)
+	_ = m.Reauthenticate()
+
+	rt := &recordingT{}
+	assert.False(t, m.AssertExpectations(rt))
+	assert.Equal(t, []string{
+		"authmock: expected GetUser to be called",
+		"authmock: expected Reauthenticate to be called 2 times, was called 1 times",
+	}, rt.errors)
+}
+
+func TestInvalidStubs(t *testing.T) {
+	m := authmock.New()
+	assert.Panics(t, func() { m.On("NotAMethod") })
+	assert.Panics(t, func() { m.On("GetUser").Return(&types.UserResponse{}) })
+	assert.Panics(t, func() { m.On("GetUser").Return(&types.SignupResponse{}, nil) })
+	assert.Panics(t, func() { m.On("Signup").With("a", "b") })
+}
+
+// Every method of auth.Client must record a call under its own name, so
+// that stubs set with On are used.
+func TestAllMethods(t *testing.T) {
+	clientType := reflect.TypeOf((*auth.Client)(nil)).Elem()
+	m := authmock.New()
+	v := reflect.ValueOf(m)
+
+	for i := 0; i < clientType.NumMethod(); i++ {
+		method := clientType.Method(i)
+		args := make([]reflect.Value, method.Type.NumIn())
+		for j := range args {
+			args[j] = reflect.Zero(method.Type.In(j))
+		}
+		v.MethodByName(method.Name).Call(args)
+
+		calls := m.CallsTo(method.Name)
+		if assert.Len(t, calls, 1, method.Name) {
+			assert.Len(t, calls[0].Args, len(args), method.Name)
+		}
+	}
+}
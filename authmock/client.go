@@ -0,0 +1,234 @@
+package authmock
+
+import (
+	"net/http"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/types"
+)
+
+var _ auth.Client = (*Client)(nil)
+
+func (c *Client) WithCustomAuthURL(url string) auth.Client {
+	return result[auth.Client](c.call("WithCustomAuthURL", url), 0)
+}
+
+func (c *Client) WithToken(token string) auth.Client {
+	return result[auth.Client](c.call("WithToken", token), 0)
+}
+
+func (c *Client) WithClient(client http.Client) auth.Client {
+	return result[auth.Client](c.call("WithClient", client), 0)
+}
+
+func (c *Client) AdminAudit(req types.AdminAuditRequest) (*types.AdminAuditResponse, error) {
+	out := c.call("AdminAudit", req)
+	return result[*types.AdminAuditResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) AdminGenerateLink(req types.AdminGenerateLinkRequest) (*types.AdminGenerateLinkResponse, error) {
+	out := c.call("AdminGenerateLink", req)
+	return result[*types.AdminGenerateLinkResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) AdminListSSOProviders() (*types.AdminListSSOProvidersResponse, error) {
+	out := c.call("AdminListSSOProviders")
+	return result[*types.AdminListSSOProvidersResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) AdminCreateSSOProvider(req types.AdminCreateSSOProviderRequest) (*types.AdminCreateSSOProviderResponse, error) {
+	out := c.call("AdminCreateSSOProvider", req)
+	return result[*types.AdminCreateSSOProviderResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) AdminGetSSOProvider(req types.AdminGetSSOProviderRequest) (*types.AdminGetSSOProviderResponse, error) {
+	out := c.call("AdminGetSSOProvider", req)
+	return result[*types.AdminGetSSOProviderResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) AdminUpdateSSOProvider(req types.AdminUpdateSSOProviderRequest) (*types.AdminUpdateSSOProviderResponse, error) {
+	out := c.call("AdminUpdateSSOProvider", req)
+	return result[*types.AdminUpdateSSOProviderResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) AdminDeleteSSOProvider(req types.AdminDeleteSSOProviderRequest) (*types.AdminDeleteSSOProviderResponse, error) {
+	out := c.call("AdminDeleteSSOProvider", req)
+	return result[*types.AdminDeleteSSOProviderResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) AdminCreateUser(req types.AdminCreateUserRequest) (*types.AdminCreateUserResponse, error) {
+	out := c.call("AdminCreateUser", req)
+	return result[*types.AdminCreateUserResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) AdminListUsers(req types.AdminListUsersRequest) (*types.AdminListUsersResponse, error) {
+	out := c.call("AdminListUsers", req)
+	return result[*types.AdminListUsersResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) AdminGetUser(req types.AdminGetUserRequest) (*types.AdminGetUserResponse, error) {
+	out := c.call("AdminGetUser", req)
+	return result[*types.AdminGetUserResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) AdminGetUserByEmail(req types.AdminGetUserByEmailRequest) (*types.AdminGetUserResponse, error) {
+	out := c.call("AdminGetUserByEmail", req)
+	return result[*types.AdminGetUserResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) AdminGetUserByPhone(req types.AdminGetUserByPhoneRequest) (*types.AdminGetUserResponse, error) {
+	out := c.call("AdminGetUserByPhone", req)
+	return result[*types.AdminGetUserResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) AdminUpdateUser(req types.AdminUpdateUserRequest) (*types.AdminUpdateUserResponse, error) {
+	out := c.call("AdminUpdateUser", req)
+	return result[*types.AdminUpdateUserResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) AdminDeleteUser(req types.AdminDeleteUserRequest) error {
+	return result[error](c.call("AdminDeleteUser", req), 0)
+}
+
+func (c *Client) AdminListUserFactors(req types.AdminListUserFactorsRequest) (*types.AdminListUserFactorsResponse, error) {
+	out := c.call("AdminListUserFactors", req)
+	return result[*types.AdminListUserFactorsResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) AdminUpdateUserFactor(req types.AdminUpdateUserFactorRequest) (*types.AdminUpdateUserFactorResponse, error) {
+	out := c.call("AdminUpdateUserFactor", req)
+	return result[*types.AdminUpdateUserFactorResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) AdminDeleteUserFactor(req types.AdminDeleteUserFactorRequest) error {
+	return result[error](c.call("AdminDeleteUserFactor", req), 0)
+}
+
+func (c *Client) Authorize(req types.AuthorizeRequest) (*types.AuthorizeResponse, error) {
+	out := c.call("Authorize", req)
+	return result[*types.AuthorizeResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) EnrollFactor(req types.EnrollFactorRequest) (*types.EnrollFactorResponse, error) {
+	out := c.call("EnrollFactor", req)
+	return result[*types.EnrollFactorResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) ChallengeFactor(req types.ChallengeFactorRequest) (*types.ChallengeFactorResponse, error) {
+	out := c.call("ChallengeFactor", req)
+	return result[*types.ChallengeFactorResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) VerifyFactor(req types.VerifyFactorRequest) (*types.VerifyFactorResponse, error) {
+	out := c.call("VerifyFactor", req)
+	return result[*types.VerifyFactorResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) UnenrollFactor(req types.UnenrollFactorRequest) (*types.UnenrollFactorResponse, error) {
+	out := c.call("UnenrollFactor", req)
+	return result[*types.UnenrollFactorResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) HealthCheck() (*types.HealthCheckResponse, error) {
+	out := c.call("HealthCheck")
+	return result[*types.HealthCheckResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) Invite(req types.InviteRequest) (*types.InviteResponse, error) {
+	out := c.call("Invite", req)
+	return result[*types.InviteResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) Logout() error {
+	return result[error](c.call("Logout"), 0)
+}
+
+func (c *Client) Magiclink(req types.MagiclinkRequest) error {
+	return result[error](c.call("Magiclink", req), 0)
+}
+
+func (c *Client) OTP(req types.OTPRequest) error {
+	return result[error](c.call("OTP", req), 0)
+}
+
+func (c *Client) Reauthenticate() error {
+	return result[error](c.call("Reauthenticate"), 0)
+}
+
+func (c *Client) Recover(req types.RecoverRequest) error {
+	return result[error](c.call("Recover", req), 0)
+}
+
+func (c *Client) Resend(req types.ResendRequest) error {
+	return result[error](c.call("Resend", req), 0)
+}
+
+func (c *Client) GetSettings() (*types.SettingsResponse, error) {
+	out := c.call("GetSettings")
+	return result[*types.SettingsResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) Signup(req types.SignupRequest) (*types.SignupResponse, error) {
+	out := c.call("Signup", req)
+	return result[*types.SignupResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) SignInWithEmailPassword(email, password string) (*types.TokenResponse, error) {
+	out := c.call("SignInWithEmailPassword", email, password)
+	return result[*types.TokenResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) SignInWithPhonePassword(phone, password string) (*types.TokenResponse, error) {
+	out := c.call("SignInWithPhonePassword", phone, password)
+	return result[*types.TokenResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) SignInWithIdToken(provider, idToken, nonce, accessToken, captchaToken string) (*types.TokenResponse, error) {
+	out := c.call("SignInWithIdToken", provider, idToken, nonce, accessToken, captchaToken)
+	return result[*types.TokenResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) RefreshToken(refreshToken string) (*types.TokenResponse, error) {
+	out := c.call("RefreshToken", refreshToken)
+	return result[*types.TokenResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) Token(req types.TokenRequest) (*types.TokenResponse, error) {
+	out := c.call("Token", req)
+	return result[*types.TokenResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) GetUser() (*types.UserResponse, error) {
+	out := c.call("GetUser")
+	return result[*types.UserResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) UpdateUser(req types.UpdateUserRequest) (*types.UpdateUserResponse, error) {
+	out := c.call("UpdateUser", req)
+	return result[*types.UpdateUserResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) Verify(req types.VerifyRequest) (*types.VerifyResponse, error) {
+	out := c.call("Verify", req)
+	return result[*types.VerifyResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) VerifyForUser(req types.VerifyForUserRequest) (*types.VerifyForUserResponse, error) {
+	out := c.call("VerifyForUser", req)
+	return result[*types.VerifyForUserResponse](out, 0), result[error](out, 1)
+}
+
+func (c *Client) SAMLMetadata() ([]byte, error) {
+	out := c.call("SAMLMetadata")
+	return result[[]byte](out, 0), result[error](out, 1)
+}
+
+func (c *Client) SAMLACS(req *http.Request) (*http.Response, error) {
+	out := c.call("SAMLACS", req)
+	return result[*http.Response](out, 0), result[error](out, 1)
+}
+
+func (c *Client) SSO(req types.SSORequest) (*types.SSOResponse, error) {
+	out := c.call("SSO", req)
+	return result[*types.SSOResponse](out, 0), result[error](out, 1)
+}
@@ -0,0 +1,339 @@
+// Package authmock provides a mock implementation of auth.Client, for unit
+// testing code that calls Auth.
+//
+// Stub responses with On, then check the expected calls were made:
+//
+//	m := authmock.New()
+//	m.On("GetUser").Return(&types.UserResponse{User: user}, nil)
+//	m.On("Logout").Return(nil).Once()
+//
+//	run(m)
+//
+//	m.AssertExpectations(t)
+//
+// On panics if the method is not part of auth.Client, and Return panics if
+// the values don't match the method's results, so stubs cannot silently go
+// out of date when the interface changes.
+package authmock
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	auth "github.com/supabase-community/auth-go"
+)
+
+// ErrUnexpectedCall is returned by methods that were called without a
+// matching expectation.
+var ErrUnexpectedCall = errors.New("authmock: unexpected call")
+
+// Anything matches any argument passed to With.
+var Anything = anything{}
+
+type anything struct{}
+
+var clientType = reflect.TypeOf((*auth.Client)(nil)).Elem()
+
+// TestingT is the subset of testing.T used to report failed expectations.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Call is a recorded call to the mock.
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+func (c Call) String() string {
+	args := make([]string, len(c.Args))
+	for i, a := range c.Args {
+		args[i] = fmt.Sprintf("%+v", a)
+	}
+	return c.Method + "(" + strings.Join(args, ", ") + ")"
+}
+
+// Expectation is a stubbed method, created by Client.On.
+type Expectation struct {
+	method reflect.Method
+	args   []interface{}
+	match  func(args ...interface{}) bool
+	fn     func(args ...interface{}) []interface{}
+
+	returns  [][]interface{}
+	times    int
+	optional bool
+	calls    int
+}
+
+// With restricts the expectation to calls with these arguments. Arguments
+// are compared with reflect.DeepEqual, except for Anything, which matches
+// any value.
+func (e *Expectation) With(args ...interface{}) *Expectation {
+	if len(args) != e.method.Type.NumIn() {
+		panic(fmt.Sprintf("authmock: %s takes %d arguments, got %d", e.method.Name, e.method.Type.NumIn(), len(args)))
+	}
+	e.args = args
+	return e
+}
+
+// Match restricts the expectation to calls for which fn returns true.
+func (e *Expectation) Match(fn func(args ...interface{}) bool) *Expectation {
+	e.match = fn
+	return e
+}
+
+// Return adds the values to return from a call. If Return is used more than
+// once, successive calls get successive values, and the last values are
+// repeated once they run out.
+func (e *Expectation) Return(values ...interface{}) *Expectation {
+	checkResults(e.method, values)
+	e.returns = append(e.returns, values)
+	return e
+}
+
+// Run sets a function to compute the values returned from each call,
+// instead of Return. fn is called without the mock locked, so it may call
+// the mock itself.
+func (e *Expectation) Run(fn func(args ...interface{}) []interface{}) *Expectation {
+	e.fn = fn
+	return e
+}
+
+// Times sets the number of calls expected. Once the expectation has been
+// called n times, it no longer matches.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// Once is the same as Times(1).
+func (e *Expectation) Once() *Expectation {
+	return e.Times(1)
+}
+
+// Maybe marks the expectation as optional, so AssertExpectations does not
+// fail if it is never called.
+func (e *Expectation) Maybe() *Expectation {
+	e.optional = true
+	return e
+}
+
+func (e *Expectation) matches(args []interface{}) bool {
+	if e.times > 0 && e.calls >= e.times {
+		return false
+	}
+	if e.args != nil {
+		for i, want := range e.args {
+			if _, ok := want.(anything); ok {
+				continue
+			}
+			if !reflect.DeepEqual(want, args[i]) {
+				return false
+			}
+		}
+	}
+	if e.match != nil && !e.match(args...) {
+		return false
+	}
+	return true
+}
+
+// results counts a call and returns the values to return from it, or the
+// function to compute them. It must be called with the mock locked, and fn
+// must be called after unlocking it, so that fn can call the mock.
+func (e *Expectation) results() (values []interface{}, fn func(args ...interface{}) []interface{}) {
+	switch {
+	case e.fn != nil:
+		fn = e.fn
+	case len(e.returns) > 0:
+		i := e.calls
+		if i >= len(e.returns) {
+			i = len(e.returns) - 1
+		}
+		values = e.returns[i]
+	}
+	e.calls++
+	return values, fn
+}
+
+func (e *Expectation) String() string {
+	s := e.method.Name
+	if e.args != nil {
+		s = Call{Method: e.method.Name, Args: e.args}.String()
+	}
+	return s
+}
+
+// Client is a mock implementation of auth.Client. The zero value is not
+// usable; create one with New.
+//
+// WithToken, WithCustomAuthURL and WithClient return the same mock unless
+// stubbed, so expectations set on the mock apply to the copies too.
+type Client struct {
+	mu           sync.Mutex
+	expectations []*Expectation
+	calls        []Call
+	unexpected   []Call
+}
+
+// New returns a mock with no expectations.
+func New() *Client {
+	return &Client{}
+}
+
+// On adds an expectation for the method. When a call matches more than one
+// expectation, the first one added is used.
+func (c *Client) On(method string) *Expectation {
+	m, ok := clientType.MethodByName(method)
+	if !ok {
+		panic(fmt.Sprintf("authmock: auth.Client has no method %s", method))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := &Expectation{method: m}
+	c.expectations = append(c.expectations, e)
+	return e
+}
+
+// Calls returns every call made to the mock, in order.
+func (c *Client) Calls() []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Call(nil), c.calls...)
+}
+
+// CallsTo returns the calls made to a method, in order.
+func (c *Client) CallsTo(method string) []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var calls []Call
+	for _, call := range c.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// AssertExpectations reports an error for each expectation that was not
+// called the expected number of times, and for each unexpected call. It
+// returns false if there were any errors.
+func (c *Client) AssertExpectations(t TestingT) bool {
+	t.Helper()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ok := true
+	for _, e := range c.expectations {
+		switch {
+		case e.optional:
+		case e.times > 0 && e.calls != e.times:
+			t.Errorf("authmock: expected %s to be called %d times, was called %d times", e, e.times, e.calls)
+			ok = false
+		case e.times == 0 && e.calls == 0:
+			t.Errorf("authmock: expected %s to be called", e)
+			ok = false
+		}
+	}
+	for _, call := range c.unexpected {
+		t.Errorf("authmock: unexpected call to %s", call)
+		ok = false
+	}
+	return ok
+}
+
+// call records a call and returns the stubbed results, filled with zero
+// values where no value was given.
+func (c *Client) call(method string, args ...interface{}) []interface{} {
+	m, _ := clientType.MethodByName(method)
+
+	values, fn, matched := c.record(method, args)
+	if fn != nil {
+		values = fn(args...)
+		checkResults(m, values)
+	}
+
+	out := make([]interface{}, m.Type.NumOut())
+	for i := range out {
+		if i < len(values) && values[i] != nil {
+			out[i] = values[i]
+			continue
+		}
+		out[i] = reflect.Zero(m.Type.Out(i)).Interface()
+	}
+
+	if !matched {
+		if isOption(method) {
+			out[0] = c
+			return out
+		}
+		if last := len(out) - 1; last >= 0 && m.Type.Out(last) == errorType {
+			out[last] = fmt.Errorf("%w: %s", ErrUnexpectedCall, Call{Method: method, Args: args})
+		}
+	}
+	return out
+}
+
+// record records a call and finds the expectation it matches.
+func (c *Client) record(method string, args []interface{}) (values []interface{}, fn func(args ...interface{}) []interface{}, matched bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	call := Call{Method: method, Args: args}
+	c.calls = append(c.calls, call)
+	for _, e := range c.expectations {
+		if e.method.Name == method && e.matches(args) {
+			values, fn = e.results()
+			return values, fn, true
+		}
+	}
+	if !isOption(method) {
+		c.unexpected = append(c.unexpected, call)
+	}
+	return nil, nil, false
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+func isOption(method string) bool {
+	switch method {
+	case "WithCustomAuthURL", "WithToken", "WithClient":
+		return true
+	}
+	return false
+}
+
+// checkResults panics if values can't be returned from the method.
+func checkResults(m reflect.Method, values []interface{}) {
+	if len(values) != m.Type.NumOut() {
+		panic(fmt.Sprintf("authmock: %s returns %d values, got %d", m.Name, m.Type.NumOut(), len(values)))
+	}
+	for i, v := range values {
+		out := m.Type.Out(i)
+		if v == nil {
+			switch out.Kind() {
+			case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+				continue
+			}
+		} else if reflect.TypeOf(v).AssignableTo(out) {
+			continue
+		}
+		panic(fmt.Sprintf("authmock: %s result %d must be %s, got %T", m.Name, i, out, v))
+	}
+}
+
+// result returns the i'th result as T.
+func result[T any](out []interface{}, i int) T {
+	v, _ := out[i].(T)
+	return v
+}
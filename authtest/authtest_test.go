@@ -0,0 +1,525 @@
+package authtest_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supabase-community/auth-go/authtest"
+	"github.com/supabase-community/auth-go/types"
+)
+
+func TestSignupConfirmAndSignIn(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := authtest.NewServer(authtest.DefaultConfig())
+	defer srv.Close()
+	client := srv.Client()
+
+	signup, err := client.Signup(types.SignupRequest{
+		Email:    "User@Example.com",
+		Password: "password",
+		Data:     map[string]interface{}{"name": "Test"},
+	})
+	require.NoError(err)
+	assert.Equal("user@example.com", signup.Email)
+	assert.Nil(signup.EmailConfirmedAt)
+	assert.Empty(signup.AccessToken)
+
+	_, err = client.SignInWithEmailPassword("user@example.com", "password")
+	assert.ErrorContains(err, "email_not_confirmed")
+
+	msg, ok := srv.LastMessage("user@example.com")
+	require.True(ok)
+	assert.Equal("signup", msg.Type)
+
+	verified, err := client.VerifyForUser(types.VerifyForUserRequest{
+		Type:       types.VerificationTypeSignup,
+		Token:      msg.OTP,
+		Email:      "user@example.com",
+		RedirectTo: "http://localhost:3000",
+	})
+	require.NoError(err)
+	assert.NotNil(verified.User.EmailConfirmedAt)
+
+	// The OTP can only be used once.
+	_, err = client.VerifyForUser(types.VerifyForUserRequest{
+		Type:       types.VerificationTypeSignup,
+		Token:      msg.OTP,
+		Email:      "user@example.com",
+		RedirectTo: "http://localhost:3000",
+	})
+	assert.Error(err)
+
+	token, err := client.SignInWithEmailPassword("user@example.com", "password")
+	require.NoError(err)
+	assert.Equal("Test", token.User.UserMetadata["name"])
+
+	user, err := client.WithToken(token.AccessToken).GetUser()
+	require.NoError(err)
+	assert.Equal(signup.ID, user.ID)
+
+	refreshed, err := client.RefreshToken(token.RefreshToken)
+	require.NoError(err)
+	assert.NotEqual(token.RefreshToken, refreshed.RefreshToken)
+
+	// Reusing a rotated refresh token revokes the session.
+	_, err = client.RefreshToken(token.RefreshToken)
+	assert.ErrorContains(err, "refresh_token_already_used")
+	_, err = client.RefreshToken(refreshed.RefreshToken)
+	assert.Error(err)
+
+	_, err = client.SignInWithEmailPassword("user@example.com", "wrong")
+	assert.ErrorContains(err, "invalid_credentials")
+
+	entries := srv.AuditLog()
+	require.NotEmpty(entries)
+	assert.Equal("token_revoked", entries[0].Payload["action"])
+}
+
+func TestSignupDisabled(t *testing.T) {
+	srv := authtest.NewServer(authtest.DefaultConfig())
+	defer srv.Close()
+	srv.Configure(func(cfg *authtest.Config) {
+		cfg.DisableSignup = true
+	})
+
+	_, err := srv.Client().Signup(types.SignupRequest{
+		Email:    "user@example.com",
+		Password: "password",
+	})
+	assert.ErrorContains(t, err, "response status code 422")
+	assert.ErrorContains(t, err, "signup_disabled")
+}
+
+func TestAdminUsers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := authtest.DefaultConfig()
+	cfg.Now = func() time.Time { return now }
+	srv := authtest.NewServer(cfg)
+	defer srv.Close()
+	client := srv.AdminClient()
+
+	_, err := srv.Client().AdminListUsers(types.AdminListUsersRequest{})
+	assert.ErrorContains(err, "response status code 401")
+
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		_, err := client.AdminCreateUser(types.AdminCreateUserRequest{
+			Email:        email,
+			EmailConfirm: true,
+			AppMetadata:  map[string]interface{}{"plan": "free"},
+		})
+		require.NoError(err)
+		now = now.Add(time.Minute)
+	}
+
+	_, err = client.AdminCreateUser(types.AdminCreateUserRequest{Email: "a@example.com"})
+	assert.ErrorContains(err, "email_exists")
+
+	page, perPage := 1, 2
+	list, err := client.AdminListUsers(types.AdminListUsersRequest{Page: &page, PerPage: &perPage})
+	require.NoError(err)
+	require.Len(list.Users, 2)
+	assert.Equal("c@example.com", list.Users[0].Email)
+	assert.Equal("b@example.com", list.Users[1].Email)
+
+	page = 2
+	list, err = client.AdminListUsers(types.AdminListUsersRequest{Page: &page, PerPage: &perPage})
+	require.NoError(err)
+	require.Len(list.Users, 1)
+	id := list.Users[0].ID
+	assert.Equal("email", list.Users[0].AppMetadata["provider"])
+	assert.Equal("free", list.Users[0].AppMetadata["plan"])
+
+	banned := types.BanDurationTime(time.Hour)
+	updated, err := client.AdminUpdateUser(types.AdminUpdateUserRequest{
+		UserID:      id,
+		AppMetadata: map[string]interface{}{"plan": nil, "role": "admin"},
+		BanDuration: &banned,
+	})
+	require.NoError(err)
+	assert.NotContains(updated.AppMetadata, "plan")
+	assert.Equal("admin", updated.AppMetadata["role"])
+	require.NotNil(updated.BannedUntil)
+	assert.Equal(now.Add(time.Hour), *updated.BannedUntil)
+
+	require.NoError(client.AdminDeleteUser(types.AdminDeleteUserRequest{UserID: id}))
+	_, err = client.AdminGetUser(types.AdminGetUserRequest{UserID: id})
+	assert.ErrorContains(err, "response status code 404")
+
+	created, err := client.AdminCreateUser(types.AdminCreateUserRequest{
+		Email:        "d@example.com",
+		Phone:        "15550100",
+		EmailConfirm: true,
+		PhoneConfirm: true,
+		BanDuration:  2 * time.Hour,
+	})
+	require.NoError(err)
+	require.NotNil(created.BannedUntil)
+	assert.Equal(now.Add(2*time.Hour), *created.BannedUntil)
+
+	updated, err = client.AdminUpdateUser(types.AdminUpdateUserRequest{
+		UserID: created.ID,
+		Patch: types.AdminUserPatch{
+			Phone:        types.Set(""),
+			EmailConfirm: types.Set(false),
+		},
+	})
+	require.NoError(err)
+	assert.Equal("15550100", updated.Phone)
+	assert.NotNil(updated.PhoneConfirmedAt)
+	assert.NotNil(updated.EmailConfirmedAt)
+	assert.Equal("d@example.com", updated.Email)
+
+	audit, err := client.AdminAudit(types.AdminAuditRequest{
+		Query: &types.AuditQuery{Column: types.AuditQueryColumnAction, Value: "SIGNEDUP"},
+	})
+	require.NoError(err)
+	assert.Len(audit.Logs, 4)
+	assert.Equal(4, audit.TotalCount)
+}
+
+func TestAdminGenerateLink(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := authtest.NewServer(authtest.DefaultConfig())
+	defer srv.Close()
+
+	link, err := srv.AdminClient().AdminGenerateLink(types.AdminGenerateLinkRequest{
+		Type:     types.LinkTypeSignup,
+		Email:    "user@example.com",
+		Password: "password",
+	})
+	require.NoError(err)
+	assert.NotEmpty(link.ActionLink)
+	assert.Empty(srv.Messages())
+
+	verified, err := srv.Client().Verify(types.VerifyRequest{
+		Type:       types.VerificationTypeSignup,
+		Token:      link.HashedToken,
+		RedirectTo: "http://localhost:3000",
+	})
+	require.NoError(err)
+	assert.NotEmpty(verified.AccessToken)
+}
+
+func TestFactors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := authtest.NewServer(authtest.DefaultConfig())
+	defer srv.Close()
+
+	_, err := srv.AdminClient().AdminCreateUser(types.AdminCreateUserRequest{
+		Email:        "user@example.com",
+		Password:     strPtr("password"),
+		EmailConfirm: true,
+	})
+	require.NoError(err)
+	token, err := srv.Client().SignInWithEmailPassword("user@example.com", "password")
+	require.NoError(err)
+	client := srv.Client().WithToken(token.AccessToken)
+
+	enrolled, err := client.EnrollFactor(types.EnrollFactorRequest{
+		FactorType: types.FactorTypeTOTP,
+	})
+	require.NoError(err)
+
+	challenge, err := client.ChallengeFactor(types.ChallengeFactorRequest{FactorID: enrolled.ID})
+	require.NoError(err)
+
+	_, err = client.VerifyFactor(types.VerifyFactorRequest{
+		FactorID:    enrolled.ID,
+		ChallengeID: challenge.ID,
+		Code:        "000000",
+	})
+	assert.ErrorContains(err, "mfa_verification_failed")
+
+	code, err := authtest.TOTP(enrolled.TOTP.Secret, time.Now())
+	require.NoError(err)
+	session, err := client.VerifyFactor(types.VerifyFactorRequest{
+		FactorID:    enrolled.ID,
+		ChallengeID: challenge.ID,
+		Code:        code,
+	})
+	require.NoError(err)
+
+	// Unenrolling a verified factor requires an aal2 session.
+	_, err = client.UnenrollFactor(types.UnenrollFactorRequest{FactorID: enrolled.ID})
+	assert.ErrorContains(err, "insufficient_aal")
+	_, err = srv.Client().WithToken(session.AccessToken).UnenrollFactor(types.UnenrollFactorRequest{FactorID: enrolled.ID})
+	assert.NoError(err)
+}
+
+func TestSSOProviders(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := authtest.NewServer(authtest.DefaultConfig())
+	defer srv.Close()
+	client := srv.AdminClient()
+
+	created, err := client.AdminCreateSSOProvider(types.AdminCreateSSOProviderRequest{
+		Type:        "saml",
+		MetadataXML: `<EntityDescriptor entityID="https://idp.example.com"></EntityDescriptor>`,
+		Domains:     []string{"example.com"},
+	})
+	require.NoError(err)
+	assert.Equal("https://idp.example.com", created.SAMLProvider.EntityID)
+
+	_, err = client.AdminCreateSSOProvider(types.AdminCreateSSOProviderRequest{
+		Type:        "saml",
+		MetadataURL: "https://other.example.com/metadata",
+		Domains:     []string{"example.com"},
+	})
+	assert.ErrorContains(err, "sso_domain_already_exists")
+
+	list, err := client.AdminListSSOProviders()
+	require.NoError(err)
+	assert.Len(list.Providers, 1)
+
+	_, err = client.AdminDeleteSSOProvider(types.AdminDeleteSSOProviderRequest{ProviderID: created.ID})
+	require.NoError(err)
+	_, err = client.AdminGetSSOProvider(types.AdminGetSSOProviderRequest{ProviderID: created.ID})
+	assert.ErrorContains(err, "response status code 404")
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestFaultTransport(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := authtest.NewServer(authtest.DefaultConfig())
+	defer srv.Close()
+
+	ft := authtest.NewFaultTransport(nil,
+		authtest.FaultRule{
+			Path:     "/health",
+			Sequence: []authtest.Fault{authtest.Status(503), nil, authtest.TruncateBody(5)},
+		},
+		authtest.FaultRule{
+			Method: http.MethodGet,
+			Path:   "/admin/users/*",
+			Fault:  authtest.TooManyRequests(1500 * time.Millisecond),
+		},
+		authtest.FaultRule{
+			Path:  "/settings",
+			Fault: authtest.DropConnection(false),
+		},
+		authtest.FaultRule{
+			Path:  "/verify",
+			Fault: authtest.RedirectLoop(),
+		},
+	)
+	client := srv.Client().WithClient(http.Client{Transport: ft})
+
+	_, err := client.HealthCheck()
+	assert.ErrorContains(err, "response status code 503")
+	_, err = client.HealthCheck()
+	assert.NoError(err)
+	_, err = client.HealthCheck()
+	assert.Error(err)
+	_, err = client.HealthCheck()
+	assert.NoError(err)
+
+	_, err = client.WithToken(srv.AdminToken()).AdminGetUser(types.AdminGetUserRequest{UserID: uuid.New()})
+	assert.ErrorContains(err, "response status code 429")
+
+	_, err = client.GetSettings()
+	assert.ErrorIs(err, authtest.ErrConnectionDropped)
+
+	resp, err := client.Verify(types.VerifyRequest{
+		Type:       types.VerificationTypeSignup,
+		Token:      "token",
+		RedirectTo: "http://localhost:3000",
+	})
+	require.NoError(err)
+	assert.Contains(resp.URL, "/verify")
+	assert.Empty(resp.AccessToken)
+
+	assert.Equal(5, ft.Injected())
+
+	// Requests not matching any rule are not changed.
+	_, err = client.Signup(types.SignupRequest{Email: "user@example.com", Password: "password"})
+	assert.NoError(err)
+	assert.Equal(5, ft.Injected())
+}
+
+func TestFaultsCloseBody(t *testing.T) {
+	faults := map[string]authtest.Fault{
+		"Status":          authtest.Status(503),
+		"TooManyRequests": authtest.TooManyRequests(time.Second),
+		"DropConnection":  authtest.DropConnection(false),
+		"RedirectLoop":    authtest.RedirectLoop(),
+	}
+	for name, fault := range faults {
+		body := &trackingBody{Reader: strings.NewReader("{}")}
+		req, err := http.NewRequest(http.MethodPost, "http://localhost/token", body)
+		require.NoError(t, err)
+		_, _ = fault(req, nil)
+		assert.True(t, body.closed, name)
+	}
+}
+
+type trackingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestFaultTransportDelay(t *testing.T) {
+	srv := authtest.NewServer(authtest.DefaultConfig())
+	defer srv.Close()
+
+	ft := authtest.NewFaultTransport(nil, authtest.FaultRule{
+		Path:  "/health",
+		Fault: authtest.Delay(time.Second),
+	})
+	client := srv.Client().WithClient(http.Client{Transport: ft, Timeout: 10 * time.Millisecond})
+
+	_, err := client.HealthCheck()
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestFaultTransportProbability(t *testing.T) {
+	srv := authtest.NewServer(authtest.DefaultConfig())
+	defer srv.Close()
+
+	run := func() []bool {
+		ft := authtest.NewFaultTransport(nil, authtest.FaultRule{
+			Path:        "/health",
+			Fault:       authtest.Status(500),
+			Probability: 0.5,
+		})
+		client := srv.Client().WithClient(http.Client{Transport: ft})
+
+		var failed []bool
+		for i := 0; i < 20; i++ {
+			_, err := client.HealthCheck()
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+
+	first := run()
+	assert.Equal(t, first, run())
+	assert.Contains(t, first, true)
+	assert.Contains(t, first, false)
+}
+
+func TestRecorder(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := authtest.NewServer(authtest.DefaultConfig())
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	rec, err := authtest.NewRecorder(path, authtest.CassetteRecord, nil)
+	require.NoError(err)
+	scrubbed := 0
+	rec.Scrub = func(*authtest.Interaction) { scrubbed++ }
+	client := srv.Client().WithClient(http.Client{Transport: rec})
+
+	_, err = client.Signup(types.SignupRequest{Email: "user@example.com", Password: "secret-password"})
+	require.NoError(err)
+	msg, ok := srv.LastMessage("user@example.com")
+	require.True(ok)
+	_, err = client.Verify(types.VerifyRequest{
+		Type:       types.VerificationTypeSignup,
+		Token:      msg.TokenHash,
+		RedirectTo: "http://localhost:3000",
+	})
+	require.NoError(err)
+	token, err := client.SignInWithEmailPassword("user@example.com", "secret-password")
+	require.NoError(err)
+	require.NoError(rec.Save())
+	srv.Close()
+	assert.Equal(3, scrubbed)
+
+	data, err := os.ReadFile(path)
+	require.NoError(err)
+	cassette := string(data)
+	assert.NotContains(cassette, "secret-password")
+	assert.NotContains(cassette, msg.TokenHash)
+	assert.NotContains(cassette, token.AccessToken)
+	assert.NotContains(cassette, token.RefreshToken)
+	assert.NotContains(cassette, "eyJ")
+
+	// Replay with the server closed.
+	rec, err = authtest.NewRecorder(path, authtest.CassetteStrict, nil)
+	require.NoError(err)
+	client = srv.Client().WithClient(http.Client{Transport: rec})
+
+	signup, err := client.Signup(types.SignupRequest{Email: "user@example.com", Password: "other-password"})
+	require.NoError(err)
+	assert.Equal("user@example.com", signup.Email)
+	verified, err := client.Verify(types.VerifyRequest{
+		Type:       types.VerificationTypeSignup,
+		Token:      "any-token",
+		RedirectTo: "http://localhost:3000",
+	})
+	require.NoError(err)
+	assert.Equal(authtest.Redacted, verified.AccessToken)
+	replayed, err := client.SignInWithEmailPassword("user@example.com", "secret-password")
+	require.NoError(err)
+	assert.Equal(authtest.Redacted, replayed.AccessToken)
+	assert.Equal(token.User.ID, replayed.User.ID)
+
+	// Each interaction is only replayed once.
+	_, err = client.SignInWithEmailPassword("user@example.com", "secret-password")
+	assert.ErrorIs(err, authtest.ErrInteractionNotFound)
+	_, err = client.HealthCheck()
+	assert.ErrorIs(err, authtest.ErrInteractionNotFound)
+}
+
+func TestRecorderNewEpisodes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := authtest.NewServer(authtest.DefaultConfig())
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	_, err := authtest.NewRecorder(path, authtest.CassetteStrict, nil)
+	assert.Error(err)
+
+	rec, err := authtest.NewRecorder(path, authtest.CassettePassthrough, nil)
+	require.NoError(err)
+	_, err = srv.Client().WithClient(http.Client{Transport: rec}).HealthCheck()
+	require.NoError(err)
+	require.NoError(rec.Save())
+	_, err = os.Stat(path)
+	assert.ErrorIs(err, os.ErrNotExist)
+
+	rec, err = authtest.NewRecorder(path, authtest.CassetteNewEpisodes, nil)
+	require.NoError(err)
+	_, err = srv.Client().WithClient(http.Client{Transport: rec}).HealthCheck()
+	require.NoError(err)
+	require.NoError(rec.Save())
+
+	rec, err = authtest.NewRecorder(path, authtest.CassetteStrict, nil)
+	require.NoError(err)
+	_, err = srv.Client().WithClient(http.Client{Transport: rec}).HealthCheck()
+	assert.NoError(err)
+}
@@ -0,0 +1,375 @@
+package authtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ErrInteractionNotFound is returned by a replaying Recorder when a request
+// has no matching interaction in the cassette.
+var ErrInteractionNotFound = errors.New("authtest: no matching interaction in cassette")
+
+// Redacted replaces secrets in recorded interactions.
+const Redacted = "REDACTED"
+
+// CassetteMode controls how a Recorder handles requests.
+type CassetteMode int
+
+const (
+	// CassetteRecord sends every request and records it, replacing the
+	// existing cassette when saved.
+	CassetteRecord CassetteMode = iota
+	// CassetteStrict replays the cassette, and fails requests that are not
+	// in it with ErrInteractionNotFound. Nothing is sent.
+	CassetteStrict
+	// CassetteNewEpisodes replays the cassette, and sends and records
+	// requests that are not in it.
+	CassetteNewEpisodes
+	// CassettePassthrough replays the cassette, and sends requests that are
+	// not in it without recording them.
+	CassettePassthrough
+)
+
+// Cassette is the file format for recorded interactions.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Query is sorted by key, so it can be compared directly.
+	Query string `json:"query,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// Keys whose values are scrubbed from JSON bodies, query strings and
+// redirect URLs.
+var secretKeys = map[string]bool{
+	"access_token":           true,
+	"captcha_token":          true,
+	"code":                   true,
+	"code_verifier":          true,
+	"email_otp":              true,
+	"gotrue_meta_security":   true,
+	"hashed_token":           true,
+	"id_token":               true,
+	"nonce":                  true,
+	"otp":                    true,
+	"password":               true,
+	"provider_refresh_token": true,
+	"provider_token":         true,
+	"qr_code":                true,
+	"refresh_token":          true,
+	"secret":                 true,
+	"token":                  true,
+	"token_hash":             true,
+	"uri":                    true,
+}
+
+// Response headers that are not recorded.
+var droppedHeaders = []string{"Set-Cookie", "Date", "Content-Length"}
+
+var jwtRegex = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+
+// Recorder is an http.RoundTripper that records interactions with Auth to
+// a cassette file, and replays them. Use it with WithClient:
+//
+//	rec, err := authtest.NewRecorder("testdata/signup.json", authtest.CassetteStrict, nil)
+//	client := auth.New(ref, key).WithClient(http.Client{Transport: rec})
+//
+// Passwords, tokens, OTPs and JWTs are scrubbed before anything is written
+// or compared, so cassettes are safe to commit. Requests are matched on
+// method, path, query and body, and each recorded interaction is replayed
+// once, in order.
+type Recorder struct {
+	// Base sends requests to the server. Defaults to http.DefaultTransport.
+	Base http.RoundTripper
+	// Scrub, if set, is called on each interaction after the default
+	// scrubbing, to remove anything else that should not be recorded.
+	Scrub func(*Interaction)
+
+	path string
+	mode CassetteMode
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+	changed      bool
+}
+
+// NewRecorder returns a Recorder for the cassette at path. In strict mode
+// the cassette must exist. In the other replay modes a missing cassette is
+// treated as empty.
+func NewRecorder(path string, mode CassetteMode, base http.RoundTripper) (*Recorder, error) {
+	r := &Recorder{
+		Base: base,
+		path: path,
+		mode: mode,
+	}
+	if mode == CassetteRecord {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && mode != CassetteStrict {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	r.interactions = c.Interactions
+	r.used = make([]bool, len(c.Interactions))
+	return r, nil
+}
+
+// Save writes the cassette, if anything was recorded.
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.changed {
+		return nil
+	}
+	data, err := json.MarshalIndent(Cassette{Interactions: r.interactions}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(r.path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	r.changed = false
+	return nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	scrubbed := scrubRequest(req, body)
+
+	if r.mode != CassetteRecord {
+		recorded := r.customScrubRequest(scrubbed)
+		if resp, ok := r.replay(req, recorded); ok {
+			return resp, nil
+		}
+		if r.mode == CassetteStrict {
+			return nil, fmt.Errorf("%w: %s %s", ErrInteractionNotFound, req.Method, req.URL.Path)
+		}
+	}
+
+	base := r.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil || r.mode == CassettePassthrough {
+		return resp, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	// Scrub runs once, on the request and response together.
+	i := Interaction{
+		Request:  scrubbed,
+		Response: scrubResponse(resp, respBody),
+	}
+	if r.Scrub != nil {
+		r.Scrub(&i)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interactions = append(r.interactions, i)
+	r.used = append(r.used, true)
+	r.changed = true
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, recorded RecordedRequest) (*http.Response, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, in := range r.interactions {
+		if r.used[i] || in.Request != recorded {
+			continue
+		}
+		r.used[i] = true
+
+		header := in.Response.Headers.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.Status, http.StatusText(in.Response.Status)),
+			StatusCode:    in.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}, true
+	}
+	return nil, false
+}
+
+func scrubRequest(req *http.Request, body []byte) RecordedRequest {
+	return RecordedRequest{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  scrubValues(req.URL.Query()).Encode(),
+		Body:   scrubBody(body),
+	}
+}
+
+// customScrubRequest applies Scrub to a request the same way it was applied
+// when the request was recorded, so that it still matches.
+func (r *Recorder) customScrubRequest(recorded RecordedRequest) RecordedRequest {
+	if r.Scrub != nil {
+		i := Interaction{Request: recorded}
+		r.Scrub(&i)
+		recorded = i.Request
+	}
+	return recorded
+}
+
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+func scrubResponse(resp *http.Response, body []byte) RecordedResponse {
+	header := resp.Header.Clone()
+	for _, h := range droppedHeaders {
+		header.Del(h)
+	}
+	if loc := header.Get("Location"); loc != "" {
+		header.Set("Location", scrubURL(loc))
+	}
+	if len(header) == 0 {
+		header = nil
+	}
+	return RecordedResponse{
+		Status:  resp.StatusCode,
+		Headers: header,
+		Body:    scrubBody(body),
+	}
+}
+
+// scrubBody redacts secrets in a JSON body. JSON is re-encoded with sorted
+// keys so that bodies compare equal regardless of field order.
+func scrubBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return jwtRegex.ReplaceAllString(string(body), Redacted)
+	}
+	scrubbed, err := json.Marshal(scrubJSON(v))
+	if err != nil {
+		return Redacted
+	}
+	return string(scrubbed)
+}
+
+func scrubJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, field := range v {
+			if _, isString := field.(string); isString && secretKeys[k] {
+				v[k] = Redacted
+				continue
+			}
+			v[k] = scrubJSON(field)
+		}
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = scrubJSON(v[i])
+		}
+		return v
+	case string:
+		return jwtRegex.ReplaceAllString(v, Redacted)
+	default:
+		return v
+	}
+}
+
+func scrubValues(values url.Values) url.Values {
+	for k, vs := range values {
+		for i := range vs {
+			if secretKeys[k] {
+				vs[i] = Redacted
+			} else {
+				vs[i] = jwtRegex.ReplaceAllString(vs[i], Redacted)
+			}
+		}
+	}
+	return values
+}
+
+// scrubURL redacts secrets in the query and fragment of a redirect URL, such
+// as the session returned in the fragment by GET /verify.
+func scrubURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return jwtRegex.ReplaceAllString(raw, Redacted)
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = scrubValues(u.Query()).Encode()
+	}
+	fragment := u.Fragment
+	u.Fragment = ""
+	if fragment == "" {
+		return u.String()
+	}
+	values, err := url.ParseQuery(fragment)
+	if err != nil {
+		return u.String() + "#" + Redacted
+	}
+	return u.String() + "#" + scrubValues(values).Encode()
+}
+
+var _ http.RoundTripper = (*Recorder)(nil)
@@ -0,0 +1,192 @@
+package authtest
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/supabase-community/auth-go/types"
+)
+
+const challengeExpiry = 5 * time.Minute
+
+func (s *Server) handleFactors(w http.ResponseWriter, r *http.Request, parts []string) {
+	u, claims, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	if len(parts) == 0 {
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w)
+			return
+		}
+		s.enrollFactor(w, r, u)
+		return
+	}
+
+	factor := findFactor(u, parts[0])
+	if factor == nil {
+		writeError(w, http.StatusNotFound, "mfa_factor_not_found", "Factor not found")
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		if factor.Status == "verified" && claims["aal"] != "aal2" {
+			writeError(w, http.StatusUnprocessableEntity, "insufficient_aal", "AAL2 required to unenroll verified factor")
+			return
+		}
+		removed := *factor
+		removeFactor(u, removed.ID)
+		s.recordAudit(r, u, nil, "factor_unenrolled", map[string]interface{}{
+			"factor_id":     removed.ID.String(),
+			"factor_status": removed.Status,
+		})
+		writeJSON(w, http.StatusOK, types.UnenrollFactorResponse{ID: removed.ID})
+
+	case len(parts) == 2 && parts[1] == "challenge" && r.Method == http.MethodPost:
+		c := &challenge{
+			id:        uuid.New(),
+			factorID:  factor.ID,
+			expiresAt: s.now().Add(challengeExpiry),
+		}
+		s.challenges[c.id] = c
+		s.recordAudit(r, u, nil, "challenge_created", map[string]interface{}{
+			"factor_id":    factor.ID.String(),
+			"challenge_id": c.id.String(),
+		})
+		writeJSON(w, http.StatusOK, struct {
+			ID        uuid.UUID `json:"id"`
+			ExpiresAt int64     `json:"expires_at"`
+		}{c.id, c.expiresAt.Unix()})
+
+	case len(parts) == 2 && parts[1] == "verify" && r.Method == http.MethodPost:
+		var req struct {
+			ChallengeID uuid.UUID `json:"challenge_id"`
+			Code        string    `json:"code"`
+		}
+		if !decodeBody(w, r, &req) {
+			return
+		}
+		c, ok := s.challenges[req.ChallengeID]
+		if !ok || c.factorID != factor.ID {
+			writeError(w, http.StatusNotFound, "mfa_factor_not_found", "MFA factor with the provided challenge ID not found")
+			return
+		}
+		if !s.now().Before(c.expiresAt) {
+			delete(s.challenges, c.id)
+			writeError(w, http.StatusUnprocessableEntity, "mfa_challenge_expired", "MFA challenge has expired, verify against another challenge or create a new challenge.")
+			return
+		}
+		if !validTOTP(u.factorSecrets[factor.ID], req.Code, s.now()) {
+			writeError(w, http.StatusUnprocessableEntity, "mfa_verification_failed", "Invalid TOTP code entered")
+			return
+		}
+
+		delete(s.challenges, c.id)
+		factor.Status = "verified"
+		factor.UpdatedAt = s.now()
+		sess, err := s.signIn(u, "aal2", "")
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "unexpected_failure", err.Error())
+			return
+		}
+		s.recordAudit(r, u, nil, "verification_attempted", map[string]interface{}{
+			"factor_id":     factor.ID.String(),
+			"factor_status": factor.Status,
+		})
+		writeJSON(w, http.StatusOK, sess)
+
+	default:
+		writeMethodNotAllowed(w)
+	}
+}
+
+func (s *Server) enrollFactor(w http.ResponseWriter, r *http.Request, u *user) {
+	if !s.cfg.MFAEnabled {
+		writeError(w, http.StatusUnprocessableEntity, "mfa_totp_enroll_not_enabled", "MFA enroll is disabled for TOTP")
+		return
+	}
+
+	var req struct {
+		FriendlyName string `json:"friendly_name"`
+		FactorType   string `json:"factor_type"`
+		Issuer       string `json:"issuer"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.FactorType != string(types.FactorTypeTOTP) {
+		writeError(w, http.StatusBadRequest, "validation_failed", "factor_type needs to be totp")
+		return
+	}
+	for _, f := range u.Factors {
+		if req.FriendlyName != "" && f.FriendlyName == req.FriendlyName {
+			writeError(w, http.StatusUnprocessableEntity, "mfa_factor_name_conflict", "A factor with the friendly name \""+req.FriendlyName+"\" for this user already exists")
+			return
+		}
+	}
+
+	now := s.now()
+	f := types.Factor{
+		ID:           uuid.New(),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		Status:       "unverified",
+		FriendlyName: req.FriendlyName,
+		FactorType:   string(types.FactorTypeTOTP),
+	}
+	secret := newTOTPSecret()
+	u.Factors = append(u.Factors, f)
+	u.factorSecrets[f.ID] = secret
+
+	issuer := req.Issuer
+	if issuer == "" {
+		issuer = "authtest"
+	}
+	q := url.Values{}
+	q.Set("issuer", issuer)
+	q.Set("secret", secret)
+	uri := "otpauth://totp/" + url.PathEscape(issuer+":"+u.Email) + "?" + q.Encode()
+
+	s.recordAudit(r, u, nil, "factor_in_progress", map[string]interface{}{
+		"factor_id":     f.ID.String(),
+		"factor_status": f.Status,
+	})
+	writeJSON(w, http.StatusOK, types.EnrollFactorResponse{
+		ID:   f.ID,
+		Type: types.FactorTypeTOTP,
+		TOTP: types.TOTPObject{
+			QRCode: "data:image/svg+xml;utf-8,<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>",
+			Secret: secret,
+			URI:    uri,
+		},
+	})
+}
+
+func findFactor(u *user, id string) *types.Factor {
+	factorID, err := uuid.Parse(id)
+	if err != nil {
+		return nil
+	}
+	for i := range u.Factors {
+		if u.Factors[i].ID == factorID {
+			return &u.Factors[i]
+		}
+	}
+	return nil
+}
+
+func removeFactor(u *user, id uuid.UUID) {
+	factors := u.Factors[:0]
+	for _, f := range u.Factors {
+		if f.ID != id {
+			factors = append(factors, f)
+		}
+	}
+	u.Factors = factors
+	delete(u.factorSecrets, id)
+}
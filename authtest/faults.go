@@ -0,0 +1,292 @@
+package authtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrConnectionDropped is returned by the DropConnection fault.
+var ErrConnectionDropped = errors.New("authtest: connection dropped")
+
+// Fault changes the outcome of a request. It may call next to send the
+// request on, or return a response or error of its own.
+type Fault func(req *http.Request, next http.RoundTripper) (*http.Response, error)
+
+// Delay waits for d before sending the request. If the request context is
+// cancelled first, e.g. by the client timeout, its error is returned.
+func Delay(d time.Duration) Fault {
+	return func(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+			return next.RoundTrip(req)
+		case <-req.Context().Done():
+			closeBody(req)
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// Status responds with the status code and an Auth error body, without
+// sending the request.
+func Status(code int) Fault {
+	return func(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+		closeBody(req)
+		return faultResponse(req, code, "unexpected_failure", http.StatusText(code)), nil
+	}
+}
+
+// TooManyRequests responds with 429 and a Retry-After header, without sending
+// the request. retryAfter is rounded up to whole seconds.
+func TooManyRequests(retryAfter time.Duration) Fault {
+	return func(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+		closeBody(req)
+		resp := faultResponse(req, http.StatusTooManyRequests, "over_request_rate_limit", "Request rate limit reached")
+		seconds := int64((retryAfter + time.Second - 1) / time.Second)
+		resp.Header.Set("Retry-After", strconv.FormatInt(seconds, 10))
+		return resp, nil
+	}
+}
+
+// TruncateBody sends the request, then cuts the response body down to at
+// most n bytes, so that JSON responses fail to decode.
+func TruncateBody(n int) Fault {
+	return func(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if n < len(body) {
+			body = body[:n]
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		resp.ContentLength = int64(len(body))
+		resp.Header.Del("Content-Length")
+		return resp, nil
+	}
+}
+
+// DropConnection fails the request with ErrConnectionDropped. If sent is
+// true the request reaches the server first, as when a connection drops
+// while waiting for the response.
+func DropConnection(sent bool) Fault {
+	return func(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+		if sent {
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				return nil, err
+			}
+			resp.Body.Close()
+		} else {
+			closeBody(req)
+		}
+		return nil, ErrConnectionDropped
+	}
+}
+
+// RedirectLoop responds with a 303 redirect back to the request URL, without
+// sending the request.
+func RedirectLoop() Fault {
+	return func(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+		closeBody(req)
+		resp := faultResponse(req, http.StatusSeeOther, "", "")
+		resp.Body = io.NopCloser(strings.NewReader(""))
+		resp.ContentLength = 0
+		resp.Header = http.Header{"Location": []string{req.URL.String()}}
+		return resp, nil
+	}
+}
+
+// FaultRule selects the requests a fault is injected into.
+type FaultRule struct {
+	// Method, if set, restricts the rule to requests with this method.
+	Method string
+	// Path is matched against the end of the request path, so "/token"
+	// matches whatever the Auth base URL is. Segments may use path.Match
+	// patterns, e.g. "/admin/users/*".
+	Path string
+
+	// Sequence holds the faults for successive matching requests: the first
+	// matching request gets Sequence[0], the second Sequence[1] and so on. A
+	// nil entry lets the request through unchanged.
+	Sequence []Fault
+
+	// Fault is injected into matching requests once Sequence is exhausted.
+	Fault Fault
+	// Probability is the chance that Fault is injected into each matching
+	// request. Zero means always.
+	Probability float64
+}
+
+func (r *FaultRule) matches(req *http.Request) bool {
+	if r.Method != "" && !strings.EqualFold(r.Method, req.Method) {
+		return false
+	}
+	if r.Path == "" {
+		return true
+	}
+
+	pattern := strings.Split(strings.Trim(r.Path, "/"), "/")
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if len(segments) < len(pattern) {
+		return false
+	}
+	segments = segments[len(segments)-len(pattern):]
+	for i := range pattern {
+		if ok, err := path.Match(pattern[i], segments[i]); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// FaultTransport is an http.RoundTripper that injects faults into requests
+// matching its rules. Use it with WithClient:
+//
+//	ft := authtest.NewFaultTransport(nil, authtest.FaultRule{
+//		Path:     "/token",
+//		Sequence: []authtest.Fault{authtest.Status(503), authtest.Status(503)},
+//	})
+//	client := srv.Client().WithClient(http.Client{Transport: ft})
+//
+// When several rules match a request, the first one that injects a fault
+// wins. Probabilities use a seeded source, so runs are repeatable.
+type FaultTransport struct {
+	// Base sends requests that reach the server. Defaults to
+	// http.DefaultTransport.
+	Base http.RoundTripper
+
+	mu       sync.Mutex
+	rules    []*faultRuleState
+	rand     *rand.Rand
+	injected int
+}
+
+type faultRuleState struct {
+	FaultRule
+	matched int
+}
+
+// NewFaultTransport returns a transport that sends requests through base,
+// injecting faults according to rules.
+func NewFaultTransport(base http.RoundTripper, rules ...FaultRule) *FaultTransport {
+	t := &FaultTransport{
+		Base: base,
+		rand: rand.New(rand.NewSource(1)),
+	}
+	for _, r := range rules {
+		t.AddRule(r)
+	}
+	return t
+}
+
+// AddRule adds a rule after the existing rules.
+func (t *FaultTransport) AddRule(rule FaultRule) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rules = append(t.rules, &faultRuleState{FaultRule: rule})
+}
+
+// Reset removes all rules and clears the injected count.
+func (t *FaultTransport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rules = nil
+	t.injected = 0
+}
+
+// Seed reseeds the source used for probabilities.
+func (t *FaultTransport) Seed(seed int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rand = rand.New(rand.NewSource(seed))
+}
+
+// Injected returns the number of faults injected so far.
+func (t *FaultTransport) Injected() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.injected
+}
+
+func (t *FaultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if fault := t.pick(req); fault != nil {
+		return fault(req, base)
+	}
+	return base.RoundTrip(req)
+}
+
+func (t *FaultTransport) pick(req *http.Request) Fault {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, r := range t.rules {
+		if !r.matches(req) {
+			continue
+		}
+
+		var fault Fault
+		if r.matched < len(r.Sequence) {
+			fault = r.Sequence[r.matched]
+		} else if r.Fault != nil && (r.Probability == 0 || t.rand.Float64() < r.Probability) {
+			fault = r.Fault
+		}
+		r.matched++
+
+		if fault != nil {
+			t.injected++
+			return fault
+		}
+	}
+	return nil
+}
+
+// closeBody closes the request body of a fault that responds without sending
+// the request, as a RoundTripper must.
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+func faultResponse(req *http.Request, code int, errorCode string, msg string) *http.Response {
+	body, _ := json.Marshal(errorResponse{Code: code, ErrorCode: errorCode, Msg: msg})
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+var _ http.RoundTripper = (*FaultTransport)(nil)
@@ -0,0 +1,285 @@
+package authtest
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/types"
+)
+
+type Config struct {
+	// JWTSecret is used to sign and verify access tokens.
+	JWTSecret string
+	// JWTExpiry is the lifetime of issued access tokens.
+	JWTExpiry time.Duration
+	// SiteURL is the default redirect URL for email links.
+	SiteURL string
+
+	DisableSignup     bool
+	MailerAutoconfirm bool
+	PhoneAutoconfirm  bool
+	MFAEnabled        bool
+	// AnonymousUsers enables anonymous sign-ins: a signup with neither an
+	// email nor a phone creates an anonymous user and signs it in.
+	AnonymousUsers bool
+
+	// External lists the enabled providers. Email and Phone control whether
+	// users can sign up with an email or phone number, the other providers
+	// control GET /authorize, and SAML controls the admin SSO endpoints.
+	External types.ExternalProviders
+
+	// VerifyPasswordHash checks a password against the hash of a user created
+	// with AdminCreateUserRequest.PasswordHash. The server has no bcrypt or
+	// argon2 implementation, so if it is nil those users can't sign in with
+	// a password.
+	VerifyPasswordHash func(hash, password string) bool
+
+	// Now returns the current time. Defaults to time.Now. Timestamps in
+	// responses, tokens and the audit log are all taken from it.
+	Now func() time.Time
+}
+
+// DefaultConfig returns the configuration of a freshly installed Auth server:
+// email signups are enabled and must be confirmed, phone signups are disabled
+// and MFA is enabled.
+func DefaultConfig() Config {
+	return Config{
+		JWTSecret:  "secret",
+		JWTExpiry:  time.Hour,
+		SiteURL:    "http://localhost:3000",
+		MFAEnabled: true,
+		External: types.ExternalProviders{
+			Email: true,
+			SAML:  true,
+		},
+	}
+}
+
+// Server is an in-memory fake of the Auth server, backed by an
+// httptest.Server. It implements the endpoints called by this client with
+// the same state transitions and error responses as Auth, so flows like
+// signup, confirmation and sign in can be tested without running Auth.
+//
+// Emails and SMS messages are not sent. Instead they are recorded, and the
+// OTPs and links they contain can be read with Messages.
+//
+// State is lost when the server is closed.
+type Server struct {
+	*httptest.Server
+
+	mu  sync.Mutex
+	cfg Config
+
+	users        map[uuid.UUID]*user
+	sessions     map[string]*session
+	tokens       map[string]*otpToken
+	challenges   map[uuid.UUID]*challenge
+	ssoProviders map[uuid.UUID]*types.SSOProvider
+	audit        []types.AuditLogEntry
+	messages     []Message
+}
+
+// NewServer starts a new fake Auth server. The caller should call Close when
+// finished, to shut it down.
+func NewServer(cfg Config) *Server {
+	if cfg.JWTSecret == "" {
+		cfg.JWTSecret = "secret"
+	}
+	if cfg.JWTExpiry == 0 {
+		cfg.JWTExpiry = time.Hour
+	}
+	if cfg.SiteURL == "" {
+		cfg.SiteURL = "http://localhost:3000"
+	}
+
+	s := &Server{
+		cfg:          cfg,
+		users:        make(map[uuid.UUID]*user),
+		sessions:     make(map[string]*session),
+		tokens:       make(map[string]*otpToken),
+		challenges:   make(map[uuid.UUID]*challenge),
+		ssoProviders: make(map[uuid.UUID]*types.SSOProvider),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Client returns a client configured to use this server.
+func (s *Server) Client() auth.Client {
+	return auth.New("authtest", "authtest").WithCustomAuthURL(s.URL)
+}
+
+// AdminClient returns a client configured to use this server, with an admin
+// token set.
+func (s *Server) AdminClient() auth.Client {
+	return s.Client().WithToken(s.AdminToken())
+}
+
+// AdminToken returns a service role token signed with the server's secret.
+func (s *Server) AdminToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"role": "service_role",
+		"iss":  "authtest",
+		"exp":  s.now().Add(100 * 365 * 24 * time.Hour).Unix(),
+	})
+	token, err := t.SignedString([]byte(s.cfg.JWTSecret))
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
+
+// Configure changes the server configuration. The change applies to
+// requests made after it returns.
+func (s *Server) Configure(fn func(*Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fn(&s.cfg)
+}
+
+func (s *Server) now() time.Time {
+	if s.cfg.Now != nil {
+		return s.cfg.Now().UTC()
+	}
+	return time.Now().UTC()
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := "/" + strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+
+	switch {
+	case path == "/health":
+		s.handleHealth(w, r)
+	case path == "/settings":
+		s.handleSettings(w, r)
+	case path == "/authorize":
+		s.handleAuthorize(w, r)
+	case path == "/signup":
+		s.handleSignup(w, r)
+	case path == "/token":
+		s.handleToken(w, r)
+	case path == "/user":
+		s.handleUser(w, r)
+	case path == "/logout":
+		s.handleLogout(w, r)
+	case path == "/verify":
+		s.handleVerify(w, r)
+	case path == "/otp":
+		s.handleOTP(w, r)
+	case path == "/magiclink":
+		s.handleMagiclink(w, r)
+	case path == "/recover":
+		s.handleRecover(w, r)
+	case path == "/resend":
+		s.handleResend(w, r)
+	case path == "/reauthenticate":
+		s.handleReauthenticate(w, r)
+	case path == "/invite":
+		s.handleInvite(w, r)
+	case parts[0] == "factors":
+		s.handleFactors(w, r, parts[1:])
+	case path == "/admin/audit":
+		s.handleAdminAudit(w, r)
+	case path == "/admin/generate_link":
+		s.handleAdminGenerateLink(w, r)
+	case len(parts) >= 2 && parts[0] == "admin" && parts[1] == "users":
+		s.handleAdminUsers(w, r, parts[2:])
+	case len(parts) >= 3 && parts[0] == "admin" && parts[1] == "sso" && parts[2] == "providers":
+		s.handleAdminSSOProviders(w, r, parts[3:])
+	default:
+		writeError(w, http.StatusNotFound, "not_found", "Not Found")
+	}
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, types.HealthCheckResponse{
+		Version:     "authtest",
+		Name:        "GoTrue",
+		Description: "GoTrue is a user registration and authentication API",
+	})
+}
+
+func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, types.SettingsResponse{
+		DisableSignup:     s.cfg.DisableSignup,
+		Autoconfirm:       s.cfg.MailerAutoconfirm,
+		MailerAutoconfirm: s.cfg.MailerAutoconfirm,
+		PhoneAutoconfirm:  s.cfg.PhoneAutoconfirm,
+		SmsProvider:       "twilio",
+		MFAEnabled:        s.cfg.MFAEnabled,
+		External:          s.cfg.External,
+	})
+}
+
+// Error responses use the same shape as Auth.
+type errorResponse struct {
+	Code      int    `json:"code"`
+	ErrorCode string `json:"error_code"`
+	Msg       string `json:"msg"`
+}
+
+func writeError(w http.ResponseWriter, status int, errorCode string, msg string) {
+	writeJSON(w, status, errorResponse{
+		Code:      status,
+		ErrorCode: errorCode,
+		Msg:       msg,
+	})
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter) {
+	writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method Not Allowed")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Body == nil || r.ContentLength == 0 {
+		return true
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "bad_json", "Could not parse request body as JSON: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func clientIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		ip, _, _ := strings.Cut(fwd, ",")
+		return strings.TrimSpace(ip)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
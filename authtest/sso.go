@@ -0,0 +1,219 @@
+package authtest
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"github.com/supabase-community/auth-go/types"
+)
+
+var entityIDRegex = regexp.MustCompile(`entityID="([^"]+)"`)
+
+type ssoProviderParams struct {
+	ResourceID       *string                     `json:"resource_id"`
+	Type             string                      `json:"type"`
+	MetadataURL      string                      `json:"metadata_url"`
+	MetadataXML      string                      `json:"metadata_xml"`
+	Domains          []string                    `json:"domains"`
+	AttributeMapping *types.SAMLAttributeMapping `json:"attribute_mapping"`
+}
+
+func (s *Server) handleAdminSSOProviders(w http.ResponseWriter, r *http.Request, parts []string) {
+	if _, ok := s.requireAdmin(w, r); !ok {
+		return
+	}
+	if !s.cfg.External.SAML {
+		writeError(w, http.StatusNotFound, "saml_provider_disabled", "SAML 2.0 is disabled")
+		return
+	}
+
+	if len(parts) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			providers := make([]types.SSOProvider, 0, len(s.ssoProviders))
+			for _, p := range s.ssoProviders {
+				providers = append(providers, copyProvider(p))
+			}
+			sort.Slice(providers, func(i, j int) bool {
+				return providers[i].CreatedAt.Before(providers[j].CreatedAt)
+			})
+			writeJSON(w, http.StatusOK, types.AdminListSSOProvidersResponse{Providers: providers})
+		case http.MethodPost:
+			s.adminCreateSSOProvider(w, r)
+		default:
+			writeMethodNotAllowed(w)
+		}
+		return
+	}
+
+	id, err := uuid.Parse(parts[0])
+	if err != nil || len(parts) > 1 {
+		writeError(w, http.StatusNotFound, "sso_provider_not_found", "SSO Identity Provider not found")
+		return
+	}
+	p, ok := s.ssoProviders[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "sso_provider_not_found", "SSO Identity Provider not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, copyProvider(p))
+	case http.MethodPut:
+		s.adminUpdateSSOProvider(w, r, p)
+	case http.MethodDelete:
+		delete(s.ssoProviders, p.ID)
+		writeJSON(w, http.StatusOK, copyProvider(p))
+	default:
+		writeMethodNotAllowed(w)
+	}
+}
+
+func (s *Server) adminCreateSSOProvider(w http.ResponseWriter, r *http.Request) {
+	var req ssoProviderParams
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.Type != "saml" {
+		writeError(w, http.StatusBadRequest, "validation_failed", "Only 'saml' supported for SSO type")
+		return
+	}
+	if (req.MetadataURL == "") == (req.MetadataXML == "") {
+		writeError(w, http.StatusBadRequest, "validation_failed", "Exactly one of metadata_xml or metadata_url must be set")
+		return
+	}
+
+	entityID, ok := s.entityID(w, req)
+	if !ok {
+		return
+	}
+	for _, existing := range s.ssoProviders {
+		if existing.SAMLProvider.EntityID == entityID {
+			writeError(w, http.StatusUnprocessableEntity, "saml_idp_already_exists", "SAML Identity Provider with this EntityID ("+entityID+") already exists")
+			return
+		}
+	}
+	if !s.checkDomains(w, req.Domains, uuid.Nil) {
+		return
+	}
+
+	now := s.now()
+	p := &types.SSOProvider{
+		ID:         uuid.New(),
+		ResourceID: req.ResourceID,
+		SAMLProvider: types.SAMLProvider{
+			EntityID:    entityID,
+			MetadataXML: req.MetadataXML,
+		},
+		SSODomains: toDomains(req.Domains),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if req.MetadataURL != "" {
+		metadataURL := req.MetadataURL
+		p.SAMLProvider.MetadataURL = &metadataURL
+	}
+	if req.AttributeMapping != nil {
+		p.SAMLProvider.AttributeMapping = *req.AttributeMapping
+	}
+	s.ssoProviders[p.ID] = p
+	writeJSON(w, http.StatusCreated, copyProvider(p))
+}
+
+func (s *Server) adminUpdateSSOProvider(w http.ResponseWriter, r *http.Request, p *types.SSOProvider) {
+	var req ssoProviderParams
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.Type != "" && req.Type != "saml" {
+		writeError(w, http.StatusBadRequest, "validation_failed", "Only 'saml' supported for SSO type")
+		return
+	}
+	if req.MetadataURL != "" && req.MetadataXML != "" {
+		writeError(w, http.StatusBadRequest, "validation_failed", "Only one of metadata_xml or metadata_url must be set")
+		return
+	}
+	if req.MetadataXML != "" || req.MetadataURL != "" {
+		entityID, ok := s.entityID(w, req)
+		if !ok {
+			return
+		}
+		if entityID != p.SAMLProvider.EntityID {
+			writeError(w, http.StatusBadRequest, "saml_entity_id_mismatch", "SAML Metadata XML has updated EntityID, please create a new identity provider instead")
+			return
+		}
+	}
+	if req.Domains != nil && !s.checkDomains(w, req.Domains, p.ID) {
+		return
+	}
+
+	if req.ResourceID != nil {
+		p.ResourceID = req.ResourceID
+	}
+	if req.MetadataXML != "" {
+		p.SAMLProvider.MetadataXML = req.MetadataXML
+		p.SAMLProvider.MetadataURL = nil
+	}
+	if req.MetadataURL != "" {
+		metadataURL := req.MetadataURL
+		p.SAMLProvider.MetadataURL = &metadataURL
+	}
+	if req.Domains != nil {
+		p.SSODomains = toDomains(req.Domains)
+	}
+	if req.AttributeMapping != nil {
+		p.SAMLProvider.AttributeMapping = *req.AttributeMapping
+	}
+	p.UpdatedAt = s.now()
+	writeJSON(w, http.StatusOK, copyProvider(p))
+}
+
+// entityID reads the entity ID from the metadata. Metadata URLs are not
+// fetched, so the URL itself is used as the entity ID.
+func (s *Server) entityID(w http.ResponseWriter, req ssoProviderParams) (string, bool) {
+	if req.MetadataURL != "" {
+		return req.MetadataURL, true
+	}
+	m := entityIDRegex.FindStringSubmatch(req.MetadataXML)
+	if m == nil {
+		writeError(w, http.StatusBadRequest, "saml_metadata_invalid", "SAML Metadata XML is invalid: no EntityID")
+		return "", false
+	}
+	return m[1], true
+}
+
+// checkDomains makes sure none of the domains belong to another provider.
+func (s *Server) checkDomains(w http.ResponseWriter, domains []string, self uuid.UUID) bool {
+	for _, d := range domains {
+		for _, p := range s.ssoProviders {
+			if p.ID == self {
+				continue
+			}
+			for _, existing := range p.SSODomains {
+				if existing.Domain == d {
+					writeError(w, http.StatusBadRequest, "sso_domain_already_exists", "SSO Domain '"+d+"' is already assigned to an SSO identity provider ("+p.ID.String()+")")
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+func toDomains(domains []string) []types.SSODomain {
+	out := make([]types.SSODomain, 0, len(domains))
+	for _, d := range domains {
+		out = append(out, types.SSODomain{Domain: d})
+	}
+	return out
+}
+
+func copyProvider(p *types.SSOProvider) types.SSOProvider {
+	c := *p
+	c.SSODomains = append([]types.SSODomain{}, p.SSODomains...)
+	return c
+}
@@ -0,0 +1,586 @@
+package authtest
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+
+	"github.com/supabase-community/auth-go/internal/normalize"
+	"github.com/supabase-community/auth-go/types"
+)
+
+type user struct {
+	types.User
+
+	password      string
+	passwordHash  string
+	factorSecrets map[uuid.UUID]string
+}
+
+type session struct {
+	id      uuid.UUID
+	userID  uuid.UUID
+	aal     string
+	revoked bool
+}
+
+type otpToken struct {
+	hash    string
+	otp     string
+	typ     string
+	userID  uuid.UUID
+	sentTo  string
+	created time.Time
+}
+
+type challenge struct {
+	id        uuid.UUID
+	factorID  uuid.UUID
+	expiresAt time.Time
+}
+
+// Message is an email or SMS that would have been sent by Auth.
+type Message struct {
+	// Type is the verification type that the OTP and link can be used for,
+	// e.g. signup, recovery or sms.
+	Type string
+	// To is the email address or phone number the message was sent to.
+	To string
+	// OTP is the one time password, to be used with VerifyForUser.
+	OTP string
+	// TokenHash is the hashed token, to be used with Verify.
+	TokenHash string
+	// Link is the action link included in emails.
+	Link   string
+	SentAt time.Time
+}
+
+// Messages returns every message sent by the server, oldest first.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message(nil), s.messages...)
+}
+
+// LastMessage returns the most recent message sent to the email address or
+// phone number.
+func (s *Server) LastMessage(to string) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if strings.Contains(to, "@") {
+		to = normalize.Email(to)
+	} else {
+		to = normalize.Phone(to)
+	}
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if s.messages[i].To == to {
+			return s.messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// AuditLog returns every audit log entry recorded by the server, newest first.
+func (s *Server) AuditLog() []types.AuditLogEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]types.AuditLogEntry, len(s.audit))
+	for i, e := range s.audit {
+		entries[len(s.audit)-1-i] = e
+	}
+	return entries
+}
+
+// --- Users ---
+
+func (s *Server) findUserByEmail(email string) *user {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return nil
+	}
+	for _, u := range s.users {
+		if u.Email == email {
+			return u
+		}
+	}
+	return nil
+}
+
+func (s *Server) findUserByPhone(phone string) *user {
+	phone = normalize.Phone(phone)
+	if phone == "" {
+		return nil
+	}
+	for _, u := range s.users {
+		if u.Phone == phone {
+			return u
+		}
+	}
+	return nil
+}
+
+// sortedUsers returns users, newest first.
+func (s *Server) sortedUsers() []*user {
+	users := make([]*user, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].ID.String() < users[j].ID.String()
+		}
+		return users[i].CreatedAt.After(users[j].CreatedAt)
+	})
+	return users
+}
+
+func (s *Server) newUser(email, phone, password string) *user {
+	u := s.newUserRecord(email, phone, password)
+	s.users[u.ID] = u
+	return u
+}
+
+// newUserRecord returns a new user without storing it.
+func (s *Server) newUserRecord(email, phone, password string) *user {
+	now := s.now()
+	u := &user{
+		User: types.User{
+			ID:           uuid.New(),
+			Aud:          "authenticated",
+			Role:         "authenticated",
+			Email:        normalize.Email(email),
+			Phone:        normalize.Phone(phone),
+			AppMetadata:  map[string]interface{}{},
+			UserMetadata: map[string]interface{}{},
+			Identities:   []types.Identity{},
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		password:      password,
+		factorSecrets: make(map[uuid.UUID]string),
+	}
+
+	provider := "email"
+	if u.Email == "" && u.Phone != "" {
+		provider = "phone"
+	}
+	u.AppMetadata["provider"] = provider
+	u.AppMetadata["providers"] = []interface{}{provider}
+	u.Identities = append(u.Identities, types.Identity{
+		ID:     u.ID.String(),
+		UserID: u.ID,
+		IdentityData: map[string]interface{}{
+			"sub":            u.ID.String(),
+			"email":          u.Email,
+			"phone":          u.Phone,
+			"email_verified": false,
+			"phone_verified": false,
+		},
+		Provider:  provider,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	return u
+}
+
+// setUserID replaces the random ID of a user that has not been stored yet.
+func setUserID(u *user, id uuid.UUID) {
+	for i := range u.Identities {
+		if u.Identities[i].ID == u.ID.String() {
+			u.Identities[i].ID = id.String()
+			u.Identities[i].IdentityData["sub"] = id.String()
+		}
+		u.Identities[i].UserID = id
+	}
+	u.ID = id
+}
+
+// supportedPasswordHash reports whether Auth accepts the hash, which must be
+// in the modular crypt format of bcrypt or argon2.
+func supportedPasswordHash(hash string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$", "$argon2i$", "$argon2id$"} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// passwordMatches reports whether password is the user's password. Users
+// created with a password hash can only sign in if the server is configured
+// with VerifyPasswordHash.
+func (s *Server) passwordMatches(u *user, password string) bool {
+	if u.passwordHash != "" {
+		return s.cfg.VerifyPasswordHash != nil && s.cfg.VerifyPasswordHash(u.passwordHash, password)
+	}
+	return u.password != "" && u.password == password
+}
+
+func (s *Server) confirmEmail(u *user) {
+	if u.EmailConfirmedAt != nil {
+		return
+	}
+	now := s.now()
+	u.EmailConfirmedAt = &now
+	u.ConfirmedAt = now
+	u.UpdatedAt = now
+	for i := range u.Identities {
+		if u.Identities[i].IdentityData != nil {
+			u.Identities[i].IdentityData["email_verified"] = true
+		}
+	}
+}
+
+func (s *Server) confirmPhone(u *user) {
+	if u.PhoneConfirmedAt != nil {
+		return
+	}
+	now := s.now()
+	u.PhoneConfirmedAt = &now
+	if u.ConfirmedAt.IsZero() {
+		u.ConfirmedAt = now
+	}
+	u.UpdatedAt = now
+	for i := range u.Identities {
+		if u.Identities[i].IdentityData != nil {
+			u.Identities[i].IdentityData["phone_verified"] = true
+		}
+	}
+}
+
+func (s *Server) isBanned(u *user) bool {
+	return u.BannedUntil != nil && u.BannedUntil.After(s.now())
+}
+
+// view returns a copy of the user that is safe to encode after the lock is
+// released.
+func (u *user) view() types.User {
+	v := u.User
+	v.AppMetadata = copyMap(u.AppMetadata)
+	v.UserMetadata = copyMap(u.UserMetadata)
+	v.Factors = append([]types.Factor(nil), u.Factors...)
+	v.Identities = append([]types.Identity(nil), u.Identities...)
+	return v
+}
+
+// mergeMetadata applies updates to the metadata the same way Auth does: top
+// level keys are replaced, and keys set to null are removed.
+func mergeMetadata(m map[string]interface{}, updates map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		m = map[string]interface{}{}
+	}
+	for k, v := range updates {
+		if v == nil {
+			delete(m, k)
+		} else {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	// Round trip through JSON so nested values are copied too.
+	b, err := json.Marshal(m)
+	if err != nil {
+		return m
+	}
+	var c map[string]interface{}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return m
+	}
+	return c
+}
+
+// --- Sessions ---
+
+func (s *Server) issueSession(u *user, aal string, sessionID uuid.UUID) (*types.Session, error) {
+	if sessionID == uuid.Nil {
+		sessionID = uuid.New()
+	}
+	now := s.now()
+	exp := now.Add(s.cfg.JWTExpiry)
+
+	claims := jwt.MapClaims{
+		"aud":           u.Aud,
+		"exp":           exp.Unix(),
+		"iat":           now.Unix(),
+		"iss":           s.URL + "/auth/v1",
+		"sub":           u.ID.String(),
+		"email":         u.Email,
+		"phone":         u.Phone,
+		"app_metadata":  copyMap(u.AppMetadata),
+		"user_metadata": copyMap(u.UserMetadata),
+		"role":          u.Role,
+		"aal":           aal,
+		"session_id":    sessionID.String(),
+		"is_anonymous":  u.IsAnonymous,
+	}
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.cfg.JWTSecret))
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := randomToken(12)
+	s.sessions[refreshToken] = &session{
+		id:     sessionID,
+		userID: u.ID,
+		aal:    aal,
+	}
+
+	return &types.Session{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "bearer",
+		ExpiresIn:    int(s.cfg.JWTExpiry.Seconds()),
+		ExpiresAt:    exp.Unix(),
+		User:         u.view(),
+	}, nil
+}
+
+// signIn starts a new session for the user, as for any sign in other than a
+// token refresh. provider is the identity the user signed in with, or "" if
+// none, e.g. for an MFA verification.
+func (s *Server) signIn(u *user, aal, provider string) (*types.Session, error) {
+	now := s.now()
+	u.LastSignInAt = &now
+	u.UpdatedAt = now
+	for i := range u.Identities {
+		if provider != "" && u.Identities[i].Provider == provider {
+			u.Identities[i].LastSignInAt = &now
+		}
+	}
+	return s.issueSession(u, aal, uuid.Nil)
+}
+
+func (s *Server) revokeSessions(userID uuid.UUID) {
+	for _, sess := range s.sessions {
+		if sess.userID == userID {
+			sess.revoked = true
+		}
+	}
+}
+
+// parseToken checks the bearer token on the request and returns its claims.
+func (s *Server) parseToken(r *http.Request) (jwt.MapClaims, bool) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, false
+	}
+
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"HS256"}), jwt.WithoutClaimsValidation())
+	_, err := parser.ParseWithClaims(strings.TrimPrefix(header, "Bearer "), claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte(s.cfg.JWTSecret), nil
+	})
+	if err != nil {
+		return nil, false
+	}
+	// Expiry is checked against the server clock rather than the wall clock.
+	if exp, ok := claims["exp"].(float64); ok && s.now().Unix() > int64(exp) {
+		return nil, false
+	}
+	return claims, true
+}
+
+// requireUser authenticates the request with a user's access token.
+func (s *Server) requireUser(w http.ResponseWriter, r *http.Request) (*user, jwt.MapClaims, bool) {
+	claims, ok := s.parseToken(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "no_authorization", "This endpoint requires a Bearer token")
+		return nil, nil, false
+	}
+	sub, _ := claims["sub"].(string)
+	id, err := uuid.Parse(sub)
+	if err != nil {
+		writeError(w, http.StatusForbidden, "bad_jwt", "invalid claim: missing sub claim")
+		return nil, nil, false
+	}
+	u, ok := s.users[id]
+	if !ok {
+		writeError(w, http.StatusForbidden, "user_not_found", "User from sub claim in JWT does not exist")
+		return nil, nil, false
+	}
+	return u, claims, true
+}
+
+// requireAdmin authenticates the request with an admin or service role token.
+func (s *Server) requireAdmin(w http.ResponseWriter, r *http.Request) (jwt.MapClaims, bool) {
+	claims, ok := s.parseToken(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "no_authorization", "This endpoint requires a Bearer token")
+		return nil, false
+	}
+	role, _ := claims["role"].(string)
+	if role != "service_role" && role != "supabase_admin" {
+		writeError(w, http.StatusForbidden, "not_admin", "User not allowed")
+		return nil, false
+	}
+	return claims, true
+}
+
+// --- OTPs ---
+
+// newOTP creates a new token of the given type for the user, replacing any
+// previous token of that type.
+func (s *Server) newOTP(u *user, typ string, sentTo string) *otpToken {
+	for k, t := range s.tokens {
+		if t.userID == u.ID && t.typ == typ {
+			delete(s.tokens, k)
+		}
+	}
+
+	otp := randomDigits(6)
+	sum := sha256.Sum224([]byte(sentTo + otp))
+	t := &otpToken{
+		hash:    hex.EncodeToString(sum[:]),
+		otp:     otp,
+		typ:     typ,
+		userID:  u.ID,
+		sentTo:  sentTo,
+		created: s.now(),
+	}
+	s.tokens[t.hash] = t
+	return t
+}
+
+// sendOTP creates a new token and records the message that would be sent.
+func (s *Server) sendOTP(u *user, typ string, sentTo string, redirectTo string) *otpToken {
+	t := s.newOTP(u, typ, sentTo)
+	if redirectTo == "" {
+		redirectTo = s.cfg.SiteURL
+	}
+	s.messages = append(s.messages, Message{
+		Type:      typ,
+		To:        sentTo,
+		OTP:       t.otp,
+		TokenHash: t.hash,
+		Link:      s.actionLink(t, redirectTo),
+		SentAt:    t.created,
+	})
+	return t
+}
+
+func (s *Server) actionLink(t *otpToken, redirectTo string) string {
+	q := url.Values{}
+	q.Set("token", t.hash)
+	q.Set("type", t.typ)
+	q.Set("redirect_to", redirectTo)
+	return fmt.Sprintf("%s/verify?%s", s.URL, q.Encode())
+}
+
+// OTPs and links are valid for a day.
+const otpExpiry = 24 * time.Hour
+
+// findOTP looks up a token by hash, or by OTP for the user it was sent to.
+func (s *Server) findOTP(typ string, token string, sentTo string) *otpToken {
+	now := s.now()
+	for k, t := range s.tokens {
+		if now.Sub(t.created) > otpExpiry {
+			delete(s.tokens, k)
+			continue
+		}
+		if !typeMatches(typ, t.typ) {
+			continue
+		}
+		if t.hash == token || (sentTo != "" && t.sentTo == sentTo && t.otp == token) {
+			return t
+		}
+	}
+	return nil
+}
+
+// Email OTPs may be verified as type email, regardless of which email they
+// were sent in. Magic links and signup confirmations are interchangeable.
+func typeMatches(requested, issued string) bool {
+	if requested == issued {
+		return true
+	}
+	switch requested {
+	case "email":
+		return issued == types.VerificationTypeSignup || issued == types.VerificationTypeMagiclink ||
+			issued == types.VerificationTypeInvite || issued == types.VerificationTypeRecovery ||
+			issued == types.VerificationTypeEmailChange
+	case types.VerificationTypeMagiclink, types.VerificationTypeSignup:
+		return issued == types.VerificationTypeMagiclink || issued == types.VerificationTypeSignup
+	}
+	return false
+}
+
+// --- Audit log ---
+
+// recordAudit adds an entry to the audit log. actor is nil for actions taken
+// with an admin token, in which case the token's claims identify the actor.
+func (s *Server) recordAudit(r *http.Request, actor *user, adminClaims map[string]interface{}, action types.AuditAction, traits map[string]interface{}) {
+	payload := map[string]interface{}{
+		"action":        string(action),
+		"log_type":      string(action.LogType()),
+		"actor_via_sso": false,
+	}
+	if actor != nil {
+		payload["actor_id"] = actor.ID.String()
+		username := actor.Email
+		if username == "" {
+			username = actor.Phone
+		}
+		payload["actor_username"] = username
+		if name, ok := actor.UserMetadata["full_name"].(string); ok {
+			payload["actor_name"] = name
+		}
+	} else if adminClaims != nil {
+		sub, _ := adminClaims["sub"].(string)
+		role, _ := adminClaims["role"].(string)
+		payload["actor_id"] = sub
+		payload["actor_username"] = role
+	}
+	if len(traits) > 0 {
+		payload["traits"] = traits
+	}
+
+	s.audit = append(s.audit, types.AuditLogEntry{
+		ID:        uuid.New(),
+		Payload:   payload,
+		CreatedAt: s.now(),
+		IPAddress: clientIP(r),
+	})
+}
+
+// --- Random values ---
+
+func randomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func randomDigits(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		d, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			panic(err)
+		}
+		b[i] = byte('0' + d.Int64())
+	}
+	return string(b)
+}
@@ -0,0 +1,804 @@
+package authtest
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/supabase-community/auth-go/internal/normalize"
+	"github.com/supabase-community/auth-go/types"
+)
+
+const minPasswordLength = 6
+
+func (s *Server) emailAutoconfirm() bool {
+	return s.cfg.MailerAutoconfirm
+}
+
+func (s *Server) handleSignup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	var req struct {
+		Email    string                 `json:"email"`
+		Phone    string                 `json:"phone"`
+		Password string                 `json:"password"`
+		Data     map[string]interface{} `json:"data"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	if s.cfg.DisableSignup {
+		writeError(w, http.StatusUnprocessableEntity, "signup_disabled", "Signups not allowed for this instance")
+		return
+	}
+
+	var existing *user
+	switch {
+	case req.Email != "":
+		if !s.cfg.External.Email {
+			writeError(w, http.StatusUnprocessableEntity, "email_provider_disabled", "Email signups are disabled")
+			return
+		}
+		existing = s.findUserByEmail(req.Email)
+	case req.Phone != "":
+		if !s.cfg.External.Phone {
+			writeError(w, http.StatusBadRequest, "phone_provider_disabled", "Unsupported phone provider")
+			return
+		}
+		existing = s.findUserByPhone(req.Phone)
+	case s.cfg.AnonymousUsers && req.Password == "":
+		s.signupAnonymous(w, r, req.Data)
+		return
+	default:
+		writeError(w, http.StatusBadRequest, "validation_failed", "To signup, please provide your email")
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		writeError(w, http.StatusUnprocessableEntity, "weak_password", "Password should be at least 6 characters.")
+		return
+	}
+
+	byEmail := req.Email != ""
+	autoconfirm := (byEmail && s.emailAutoconfirm()) || (!byEmail && s.cfg.PhoneAutoconfirm)
+
+	u := existing
+	if u != nil {
+		confirmed := (byEmail && u.EmailConfirmedAt != nil) || (!byEmail && u.PhoneConfirmedAt != nil)
+		if confirmed {
+			if autoconfirm {
+				writeError(w, http.StatusUnprocessableEntity, "user_already_exists", "User already registered")
+				return
+			}
+			// Auth returns a fake user so the response doesn't reveal that
+			// the account exists.
+			s.recordAudit(r, u, nil, "user_repeated_signup", map[string]interface{}{"provider": provider(byEmail)})
+			now := s.now()
+			fake := s.newUserRecord(req.Email, req.Phone, "")
+			fake.ConfirmationSentAt = &now
+			writeJSON(w, http.StatusOK, fake.view())
+			return
+		}
+		u.password = req.Password
+		u.UserMetadata = mergeMetadata(u.UserMetadata, req.Data)
+		u.UpdatedAt = s.now()
+	} else {
+		u = s.newUser(req.Email, req.Phone, req.Password)
+		u.UserMetadata = mergeMetadata(u.UserMetadata, req.Data)
+		s.recordAudit(r, u, nil, "user_signedup", map[string]interface{}{"provider": provider(byEmail)})
+	}
+
+	if autoconfirm {
+		if byEmail {
+			s.confirmEmail(u)
+		} else {
+			s.confirmPhone(u)
+		}
+		sess, err := s.signIn(u, "aal1", provider(byEmail))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "unexpected_failure", err.Error())
+			return
+		}
+		s.recordAudit(r, u, nil, "login", map[string]interface{}{"provider": provider(byEmail)})
+		writeJSON(w, http.StatusOK, sess)
+		return
+	}
+
+	now := s.now()
+	u.ConfirmationSentAt = &now
+	if byEmail {
+		s.sendOTP(u, types.VerificationTypeSignup, u.Email, r.URL.Query().Get("redirect_to"))
+	} else {
+		s.sendOTP(u, types.VerificationTypeSMS, u.Phone, "")
+	}
+	s.recordAudit(r, u, nil, "user_confirmation_requested", map[string]interface{}{"provider": provider(byEmail)})
+	writeJSON(w, http.StatusOK, u.view())
+}
+
+func (s *Server) signupAnonymous(w http.ResponseWriter, r *http.Request, data map[string]interface{}) {
+	// Anonymous users have no identity until they link an email, phone or
+	// OAuth account.
+	u := s.newUser("", "", "")
+	u.IsAnonymous = true
+	u.Identities = []types.Identity{}
+	u.AppMetadata["provider"] = "anonymous"
+	u.AppMetadata["providers"] = []interface{}{"anonymous"}
+	u.UserMetadata = mergeMetadata(u.UserMetadata, data)
+	s.recordAudit(r, u, nil, "user_signedup", map[string]interface{}{"provider": "anonymous"})
+	sess, err := s.signIn(u, "aal1", "")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "unexpected_failure", err.Error())
+		return
+	}
+	s.recordAudit(r, u, nil, "login", map[string]interface{}{"provider": "anonymous"})
+	writeJSON(w, http.StatusOK, sess)
+}
+
+func provider(byEmail bool) string {
+	if byEmail {
+		return "email"
+	}
+	return "phone"
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	var req struct {
+		Email        string `json:"email"`
+		Phone        string `json:"phone"`
+		Password     string `json:"password"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	switch grant := r.URL.Query().Get("grant_type"); grant {
+	case "password":
+		var u *user
+		if req.Email != "" {
+			u = s.findUserByEmail(req.Email)
+		} else if req.Phone != "" {
+			u = s.findUserByPhone(req.Phone)
+		}
+		if u == nil || !s.passwordMatches(u, req.Password) {
+			writeError(w, http.StatusBadRequest, "invalid_credentials", "Invalid login credentials")
+			return
+		}
+		if req.Email != "" && u.EmailConfirmedAt == nil {
+			writeError(w, http.StatusBadRequest, "email_not_confirmed", "Email not confirmed")
+			return
+		}
+		if req.Email == "" && u.PhoneConfirmedAt == nil {
+			writeError(w, http.StatusBadRequest, "phone_not_confirmed", "Phone not confirmed")
+			return
+		}
+		if s.isBanned(u) {
+			writeError(w, http.StatusBadRequest, "user_banned", "User is banned")
+			return
+		}
+		sess, err := s.signIn(u, "aal1", provider(req.Email != ""))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "unexpected_failure", err.Error())
+			return
+		}
+		s.recordAudit(r, u, nil, "login", map[string]interface{}{"provider": provider(req.Email != "")})
+		writeJSON(w, http.StatusOK, sess)
+
+	case "refresh_token":
+		old, ok := s.sessions[req.RefreshToken]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "refresh_token_not_found", "Invalid Refresh Token: Refresh Token Not Found")
+			return
+		}
+		if old.revoked {
+			// Reusing a rotated token is treated as a leak, so the whole
+			// session is revoked.
+			for _, sess := range s.sessions {
+				if sess.id == old.id {
+					sess.revoked = true
+				}
+			}
+			if u, ok := s.users[old.userID]; ok {
+				s.recordAudit(r, u, nil, "token_revoked", nil)
+			}
+			writeError(w, http.StatusBadRequest, "refresh_token_already_used", "Invalid Refresh Token: Already Used")
+			return
+		}
+		u, ok := s.users[old.userID]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "refresh_token_not_found", "Invalid Refresh Token: Refresh Token Not Found")
+			return
+		}
+		if s.isBanned(u) {
+			writeError(w, http.StatusBadRequest, "user_banned", "User is banned")
+			return
+		}
+		old.revoked = true
+		sess, err := s.issueSession(u, old.aal, old.id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "unexpected_failure", err.Error())
+			return
+		}
+		s.recordAudit(r, u, nil, "token_revoked", nil)
+		s.recordAudit(r, u, nil, "token_refreshed", nil)
+		writeJSON(w, http.StatusOK, sess)
+
+	case "pkce":
+		writeError(w, http.StatusNotFound, "flow_state_not_found", "invalid flow state, no valid flow state found")
+
+	case "id_token":
+		writeError(w, http.StatusBadRequest, "validation_failed", "Custom OIDC provider not allowed")
+
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", "unsupported_grant_type")
+	}
+}
+
+func (s *Server) handleUser(w http.ResponseWriter, r *http.Request) {
+	u, _, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, u.view())
+
+	case http.MethodPut:
+		var req struct {
+			Email    *string                `json:"email"`
+			Phone    *string                `json:"phone"`
+			Password *string                `json:"password"`
+			Nonce    string                 `json:"nonce"`
+			Data     map[string]interface{} `json:"data"`
+			AppData  map[string]interface{} `json:"app_metadata"`
+		}
+		if !decodeBody(w, r, &req) {
+			return
+		}
+
+		if req.AppData != nil {
+			writeError(w, http.StatusUnauthorized, "not_admin", "Updating app_metadata requires admin privileges")
+			return
+		}
+
+		if req.Password != nil {
+			if len(*req.Password) < minPasswordLength {
+				writeError(w, http.StatusUnprocessableEntity, "weak_password", "Password should be at least 6 characters.")
+				return
+			}
+			if *req.Password == u.password {
+				writeError(w, http.StatusUnprocessableEntity, "same_password", "New password should be different from the old password.")
+				return
+			}
+		}
+
+		if req.Email != nil && *req.Email != "" && strings.ToLower(*req.Email) != u.Email {
+			if other := s.findUserByEmail(*req.Email); other != nil && other.ID != u.ID {
+				writeError(w, http.StatusUnprocessableEntity, "email_exists", "A user with this email address has already been registered")
+				return
+			}
+		}
+		if req.Phone != nil && *req.Phone != "" && normalize.Phone(*req.Phone) != u.Phone {
+			if other := s.findUserByPhone(*req.Phone); other != nil && other.ID != u.ID {
+				writeError(w, http.StatusUnprocessableEntity, "phone_exists", "A user with this phone number has already been registered")
+				return
+			}
+		}
+
+		now := s.now()
+		if req.Password != nil {
+			u.password = *req.Password
+			u.passwordHash = ""
+			s.recordAudit(r, u, nil, "user_updated_password", nil)
+		}
+		if req.Data != nil {
+			u.UserMetadata = mergeMetadata(u.UserMetadata, req.Data)
+		}
+		if req.Email != nil && *req.Email != "" && strings.ToLower(*req.Email) != u.Email {
+			email := strings.ToLower(*req.Email)
+			if s.emailAutoconfirm() {
+				u.Email = email
+			} else {
+				u.EmailChange = email
+				u.EmailChangeSentAt = &now
+				s.sendOTP(u, types.VerificationTypeEmailChange, email, r.URL.Query().Get("redirect_to"))
+			}
+		}
+		if req.Phone != nil && *req.Phone != "" && normalize.Phone(*req.Phone) != u.Phone {
+			phone := normalize.Phone(*req.Phone)
+			if s.cfg.PhoneAutoconfirm {
+				u.Phone = phone
+			} else {
+				u.PhoneChange = phone
+				u.PhoneChangeSentAt = &now
+				s.sendOTP(u, types.VerificationTypePhoneChange, phone, "")
+			}
+		}
+		u.UpdatedAt = now
+		s.recordAudit(r, u, nil, "user_modified", nil)
+		writeJSON(w, http.StatusOK, u.view())
+
+	default:
+		writeMethodNotAllowed(w)
+	}
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+	u, _, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+	s.revokeSessions(u.ID)
+	s.recordAudit(r, u, nil, "logout", nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleVerify(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		redirectTo := q.Get("redirect_to")
+		if redirectTo == "" {
+			redirectTo = s.cfg.SiteURL
+		}
+
+		t := s.findOTP(q.Get("type"), q.Get("token"), "")
+		var sess *types.Session
+		if t != nil {
+			sess = s.redeemOTP(r, t)
+		}
+		if sess == nil {
+			fragment := url.Values{}
+			fragment.Set("error", "access_denied")
+			fragment.Set("error_code", "403")
+			fragment.Set("error_description", "Email link is invalid or has expired")
+			http.Redirect(w, r, redirectTo+"#"+fragment.Encode(), http.StatusSeeOther)
+			return
+		}
+
+		fragment := url.Values{}
+		fragment.Set("access_token", sess.AccessToken)
+		fragment.Set("expires_at", strconv.FormatInt(sess.ExpiresAt, 10))
+		fragment.Set("expires_in", strconv.Itoa(sess.ExpiresIn))
+		fragment.Set("refresh_token", sess.RefreshToken)
+		fragment.Set("token_type", sess.TokenType)
+		fragment.Set("type", t.typ)
+		http.Redirect(w, r, redirectTo+"#"+fragment.Encode(), http.StatusSeeOther)
+
+	case http.MethodPost:
+		var req struct {
+			Type      string `json:"type"`
+			Token     string `json:"token"`
+			TokenHash string `json:"token_hash"`
+			Email     string `json:"email"`
+			Phone     string `json:"phone"`
+		}
+		if !decodeBody(w, r, &req) {
+			return
+		}
+
+		var t *otpToken
+		switch {
+		case req.TokenHash != "":
+			t = s.findOTP(req.Type, req.TokenHash, "")
+		case req.Email != "":
+			t = s.findOTP(req.Type, req.Token, strings.ToLower(req.Email))
+		case req.Phone != "":
+			t = s.findOTP(req.Type, req.Token, normalize.Phone(req.Phone))
+		default:
+			writeError(w, http.StatusBadRequest, "validation_failed", "Only an email address or phone number should be provided on verify")
+			return
+		}
+
+		var sess *types.Session
+		if t != nil {
+			sess = s.redeemOTP(r, t)
+		}
+		if sess == nil {
+			writeError(w, http.StatusForbidden, "otp_expired", "Token has expired or is invalid")
+			return
+		}
+		writeJSON(w, http.StatusOK, sess)
+
+	default:
+		writeMethodNotAllowed(w)
+	}
+}
+
+// redeemOTP applies the state change the token was issued for, and signs the
+// user in. It returns nil if the token can't be used.
+func (s *Server) redeemOTP(r *http.Request, t *otpToken) *types.Session {
+	u, ok := s.users[t.userID]
+	if !ok {
+		return nil
+	}
+	delete(s.tokens, t.hash)
+
+	now := s.now()
+	switch t.typ {
+	case types.VerificationTypeSignup, types.VerificationTypeMagiclink, types.VerificationTypeRecovery:
+		s.confirmEmail(u)
+	case types.VerificationTypeInvite:
+		s.confirmEmail(u)
+		s.recordAudit(r, u, nil, "invite_accepted", nil)
+	case types.VerificationTypeEmailChange:
+		if u.EmailChange != "" {
+			u.Email = u.EmailChange
+			u.EmailChange = ""
+			u.EmailChangeSentAt = nil
+			u.UpdatedAt = now
+		}
+		s.confirmEmail(u)
+	case types.VerificationTypeSMS:
+		s.confirmPhone(u)
+	case types.VerificationTypePhoneChange:
+		if u.PhoneChange != "" {
+			u.Phone = u.PhoneChange
+			u.PhoneChange = ""
+			u.PhoneChangeSentAt = nil
+			u.UpdatedAt = now
+		}
+		s.confirmPhone(u)
+	default:
+		return nil
+	}
+
+	if s.isBanned(u) {
+		return nil
+	}
+	byEmail := t.typ != types.VerificationTypeSMS && t.typ != types.VerificationTypePhoneChange
+	sess, err := s.signIn(u, "aal1", provider(byEmail))
+	if err != nil {
+		return nil
+	}
+	s.recordAudit(r, u, nil, "login", map[string]interface{}{"provider": provider(byEmail)})
+	return sess
+}
+
+func (s *Server) handleOTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	var req struct {
+		Email      string                 `json:"email"`
+		Phone      string                 `json:"phone"`
+		CreateUser bool                   `json:"create_user"`
+		Data       map[string]interface{} `json:"data"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if (req.Email == "") == (req.Phone == "") {
+		writeError(w, http.StatusBadRequest, "validation_failed", "Only an email address or phone number should be provided")
+		return
+	}
+	s.passwordless(w, r, req.Email, req.Phone, req.CreateUser, req.Data)
+}
+
+func (s *Server) handleMagiclink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	var req struct {
+		Email string                 `json:"email"`
+		Data  map[string]interface{} `json:"data"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.Email == "" {
+		writeError(w, http.StatusBadRequest, "validation_failed", "Password recovery requires an email")
+		return
+	}
+	s.passwordless(w, r, req.Email, "", true, req.Data)
+}
+
+// passwordless sends a magic link or SMS OTP, creating the user if allowed.
+func (s *Server) passwordless(w http.ResponseWriter, r *http.Request, email, phone string, createUser bool, data map[string]interface{}) {
+	byEmail := email != ""
+	if byEmail && !s.cfg.External.Email {
+		writeError(w, http.StatusUnprocessableEntity, "email_provider_disabled", "Email logins are disabled")
+		return
+	}
+	if !byEmail && !s.cfg.External.Phone {
+		writeError(w, http.StatusBadRequest, "phone_provider_disabled", "Unsupported phone provider")
+		return
+	}
+
+	var u *user
+	if byEmail {
+		u = s.findUserByEmail(email)
+	} else {
+		u = s.findUserByPhone(phone)
+	}
+
+	if u == nil {
+		if !createUser {
+			writeError(w, http.StatusUnprocessableEntity, "otp_disabled", "Signups not allowed for otp")
+			return
+		}
+		if s.cfg.DisableSignup {
+			writeError(w, http.StatusUnprocessableEntity, "signup_disabled", "Signups not allowed for this instance")
+			return
+		}
+		u = s.newUser(email, phone, "")
+		u.UserMetadata = mergeMetadata(u.UserMetadata, data)
+		s.recordAudit(r, u, nil, "user_signedup", map[string]interface{}{"provider": provider(byEmail)})
+	}
+
+	now := s.now()
+	switch {
+	case !byEmail:
+		s.sendOTP(u, types.VerificationTypeSMS, u.Phone, "")
+	case u.EmailConfirmedAt == nil:
+		u.ConfirmationSentAt = &now
+		s.sendOTP(u, types.VerificationTypeSignup, u.Email, r.URL.Query().Get("redirect_to"))
+		s.recordAudit(r, u, nil, "user_confirmation_requested", nil)
+	default:
+		u.RecoverySentAt = &now
+		s.sendOTP(u, types.VerificationTypeMagiclink, u.Email, r.URL.Query().Get("redirect_to"))
+		s.recordAudit(r, u, nil, "user_recovery_requested", nil)
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func (s *Server) handleRecover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.Email == "" {
+		writeError(w, http.StatusBadRequest, "validation_failed", "Password recovery requires an email")
+		return
+	}
+
+	// The response is the same whether or not the user exists.
+	if u := s.findUserByEmail(req.Email); u != nil {
+		now := s.now()
+		u.RecoverySentAt = &now
+		s.sendOTP(u, types.VerificationTypeRecovery, u.Email, r.URL.Query().Get("redirect_to"))
+		s.recordAudit(r, u, nil, "user_recovery_requested", nil)
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func (s *Server) handleResend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	var req struct {
+		Type  string `json:"type"`
+		Email string `json:"email"`
+		Phone string `json:"phone"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.Email == "" && req.Phone == "" {
+		writeError(w, http.StatusBadRequest, "validation_failed", "Missing one of these fields: email, phone")
+		return
+	}
+
+	var u *user
+	if req.Email != "" {
+		u = s.findUserByEmail(req.Email)
+	} else {
+		u = s.findUserByPhone(req.Phone)
+	}
+	// The response is the same whether or not the user exists.
+	if u == nil {
+		writeJSON(w, http.StatusOK, struct{}{})
+		return
+	}
+
+	typ := req.Type
+	if typ == "" {
+		switch {
+		case req.Email != "" && u.EmailChange != "":
+			typ = types.VerificationTypeEmailChange
+		case req.Email != "" && u.EmailConfirmedAt == nil:
+			typ = types.VerificationTypeSignup
+		case req.Phone != "" && u.PhoneChange != "":
+			typ = types.VerificationTypePhoneChange
+		case req.Phone != "" && u.PhoneConfirmedAt == nil:
+			typ = types.VerificationTypeSMS
+		}
+	}
+
+	now := s.now()
+	redirectTo := r.URL.Query().Get("redirect_to")
+	switch typ {
+	case types.VerificationTypeSignup:
+		if u.EmailConfirmedAt == nil {
+			u.ConfirmationSentAt = &now
+			s.sendOTP(u, typ, u.Email, redirectTo)
+			s.recordAudit(r, u, nil, "user_confirmation_requested", nil)
+		}
+	case types.VerificationTypeEmailChange:
+		if u.EmailChange != "" {
+			u.EmailChangeSentAt = &now
+			s.sendOTP(u, typ, u.EmailChange, redirectTo)
+		}
+	case types.VerificationTypeSMS:
+		if u.PhoneConfirmedAt == nil {
+			u.ConfirmationSentAt = &now
+			s.sendOTP(u, typ, u.Phone, "")
+		}
+	case types.VerificationTypePhoneChange:
+		if u.PhoneChange != "" {
+			u.PhoneChangeSentAt = &now
+			s.sendOTP(u, typ, u.PhoneChange, "")
+		}
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func (s *Server) handleReauthenticate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	u, _, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+	if u.Email == "" && u.Phone == "" {
+		writeError(w, http.StatusUnprocessableEntity, "reauthentication_not_valid", "Reauthentication requires the user to have an email or a phone number")
+		return
+	}
+
+	now := s.now()
+	u.ReauthenticationSentAt = &now
+	to := u.Email
+	if to == "" {
+		to = u.Phone
+	}
+	s.sendOTP(u, "reauthentication", to, "")
+	s.recordAudit(r, u, nil, "user_reauthenticate_requested", nil)
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func (s *Server) handleInvite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+	claims, ok := s.requireAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Email string                 `json:"email"`
+		Data  map[string]interface{} `json:"data"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.Email == "" {
+		writeError(w, http.StatusBadRequest, "validation_failed", "An email address is required")
+		return
+	}
+
+	u := s.findUserByEmail(req.Email)
+	if u != nil && u.EmailConfirmedAt != nil {
+		writeError(w, http.StatusUnprocessableEntity, "email_exists", "A user with this email address has already been registered")
+		return
+	}
+	if u == nil {
+		u = s.newUser(req.Email, "", "")
+	}
+	u.UserMetadata = mergeMetadata(u.UserMetadata, req.Data)
+
+	now := s.now()
+	u.InvitedAt = &now
+	u.UpdatedAt = now
+	s.sendOTP(u, types.VerificationTypeInvite, u.Email, r.URL.Query().Get("redirect_to"))
+	s.recordAudit(r, nil, claims, "user_invited", map[string]interface{}{
+		"user_id":    u.ID.String(),
+		"user_email": u.Email,
+	})
+	writeJSON(w, http.StatusOK, u.view())
+}
+
+var providerAuthorizationURLs = map[string]string{
+	"apple":  "https://appleid.apple.com/auth/authorize",
+	"github": "https://github.com/login/oauth/authorize",
+	"google": "https://accounts.google.com/o/oauth2/auth",
+}
+
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+
+	q := r.URL.Query()
+	p := q.Get("provider")
+	if !providerEnabled(s.cfg.External, p) {
+		writeError(w, http.StatusBadRequest, "validation_failed", "Unsupported provider: provider "+p+" could not be found")
+		return
+	}
+
+	authURL, ok := providerAuthorizationURLs[p]
+	if !ok {
+		authURL = "https://" + p + ".authtest.local/oauth/authorize"
+	}
+
+	params := url.Values{}
+	params.Set("client_id", "authtest")
+	params.Set("redirect_uri", s.URL+"/callback")
+	params.Set("response_type", "code")
+	params.Set("state", randomToken(16))
+	if scopes := q.Get("scopes"); scopes != "" {
+		params.Set("scope", scopes)
+	}
+	http.Redirect(w, r, authURL+"?"+params.Encode(), http.StatusFound)
+}
+
+func providerEnabled(ext types.ExternalProviders, p string) bool {
+	switch types.Provider(p) {
+	case types.ProviderApple:
+		return ext.Apple
+	case types.ProviderAzure:
+		return ext.Azure
+	case types.ProviderBitbucket:
+		return ext.Bitbucket
+	case types.ProviderDiscord:
+		return ext.Discord
+	case types.ProviderFacebook:
+		return ext.Facebook
+	case types.ProviderGitHub:
+		return ext.GitHub
+	case types.ProviderGitLab:
+		return ext.GitLab
+	case types.ProviderGoogle:
+		return ext.Google
+	case types.ProviderKeycloak:
+		return ext.Keycloak
+	case types.ProviderLinkedin:
+		return ext.Linkedin
+	case types.ProviderNotion:
+		return ext.Notion
+	case types.ProviderSlack:
+		return ext.Slack
+	case types.ProviderSpotify:
+		return ext.Spotify
+	case types.ProviderTwitch:
+		return ext.Twitch
+	case types.ProviderTwitter:
+		return ext.Twitter
+	case types.ProviderWorkOS:
+		return ext.WorkOS
+	case types.ProviderZoom:
+		return ext.Zoom
+	}
+	return false
+}
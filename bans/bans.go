@@ -0,0 +1,304 @@
+// Package bans bans and unbans users with AdminUpdateUser, keeping the
+// reason, actor and history of each ban in app_metadata, and applies bans
+// and unbans scheduled for later.
+package bans
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/metadata"
+	"github.com/supabase-community/auth-go/types"
+)
+
+// The app_metadata keys that the current ban and the ban history are kept
+// under.
+const (
+	BanKey     = "ban"
+	HistoryKey = "ban_history"
+)
+
+// Indefinitely is the ban duration used for bans without an end. Auth has no
+// permanent ban, so this is 100 years.
+const Indefinitely = 100 * 365 * 24 * time.Hour
+
+// SystemActor is the actor recorded when the Manager lifts an expired ban.
+const SystemActor = "system"
+
+var (
+	ErrInvalidBan      = errors.New("invalid ban")
+	ErrNoScheduleStore = errors.New("ban manager has no schedule store")
+	// ErrUserGone is returned for a schedule whose user was deleted after it
+	// was made.
+	ErrUserGone   = errors.New("scheduled user no longer exists")
+	errNotExpired = errors.New("ban has not expired")
+)
+
+// Action is a change to a user's ban.
+type Action string
+
+const (
+	ActionBan   Action = "ban"
+	ActionUnban Action = "unban"
+	// ActionExpire is recorded when the Manager lifts a ban that has
+	// expired.
+	ActionExpire Action = "expire"
+)
+
+// Record is an entry in a user's ban history.
+type Record struct {
+	Action Action    `json:"action"`
+	At     time.Time `json:"at"`
+	// Until is when a ban ends, or nil if it does not.
+	Until  *time.Time `json:"until,omitempty"`
+	Reason string     `json:"reason,omitempty"`
+	Actor  string     `json:"actor,omitempty"`
+}
+
+type BanRequest struct {
+	UserID uuid.UUID
+
+	// Until or Duration sets when the ban ends. If neither is set, the user
+	// is banned Indefinitely.
+	Until    time.Time
+	Duration time.Duration
+
+	Reason string
+	// Actor is who banned the user, e.g. an admin's email.
+	Actor string
+}
+
+type UnbanRequest struct {
+	UserID uuid.UUID
+	Reason string
+	Actor  string
+}
+
+// BannedUser is a user who is currently banned.
+type BannedUser struct {
+	User types.User
+	// Ban is the ban recorded by the Manager, or nil if the user was banned
+	// some other way.
+	Ban *Record
+}
+
+// Manager bans and unbans users.
+//
+// The ban itself and the app_metadata that records it are written in the
+// same AdminUpdateUser request, with a metadata.Updater so that concurrent
+// changes to app_metadata are not lost.
+type Manager struct {
+	client    auth.Client
+	updater   *metadata.Updater
+	schedules ScheduleStore
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+	// HistoryLimit is how many history records are kept per user, oldest
+	// dropped first. Defaults to 20.
+	HistoryLimit int
+	// PerPage is the page size used to list users. Defaults to 100.
+	PerPage int
+}
+
+// NewManager returns a Manager. The client must have an admin token set.
+// schedules is only needed to schedule bans and unbans, and may be nil
+// otherwise.
+func NewManager(client auth.Client, schedules ScheduleStore) *Manager {
+	updater := metadata.NewUpdater(client)
+	updater.Kind = metadata.KindApp
+	return &Manager{
+		client:       client,
+		updater:      updater,
+		schedules:    schedules,
+		HistoryLimit: 20,
+		PerPage:      100,
+	}
+}
+
+// Ban bans the user, replacing any current ban.
+func (m *Manager) Ban(req BanRequest) (*types.User, error) {
+	now := m.now()
+	d, until, err := banDuration(req.Until, req.Duration, now)
+	if err != nil {
+		return nil, err
+	}
+	rec := Record{Action: ActionBan, At: now, Until: until, Reason: req.Reason, Actor: req.Actor}
+	return m.apply(req.UserID, rec, types.BanDurationTime(d), nil)
+}
+
+// Unban lifts the user's ban. Unbanning a user who is not banned still
+// records the unban.
+func (m *Manager) Unban(req UnbanRequest) (*types.User, error) {
+	rec := Record{Action: ActionUnban, At: m.now(), Reason: req.Reason, Actor: req.Actor}
+	return m.apply(req.UserID, rec, types.BanDurationNone(), nil)
+}
+
+func (m *Manager) apply(userID uuid.UUID, rec Record, ban types.BanDuration, check func(*types.User) error) (*types.User, error) {
+	return m.updater.UpdateWith(userID, func(user *types.User, md map[string]interface{}, req *types.AdminUpdateUserRequest) error {
+		if check != nil {
+			if err := check(user); err != nil {
+				return err
+			}
+		}
+		history, err := readHistory(md)
+		if err != nil {
+			return err
+		}
+		history = append(history, rec)
+		if limit := m.historyLimit(); len(history) > limit {
+			history = history[len(history)-limit:]
+		}
+		md[HistoryKey] = history
+		if rec.Action == ActionBan {
+			md[BanKey] = rec
+		} else {
+			delete(md, BanKey)
+		}
+		req.BanDuration = &ban
+		return nil
+	})
+}
+
+// History returns the user's ban history, oldest first.
+func (m *Manager) History(userID uuid.UUID) ([]Record, error) {
+	resp, err := m.client.AdminGetUser(types.AdminGetUserRequest{UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+	return readHistory(resp.AppMetadata)
+}
+
+// CurrentBan returns the ban recorded in the user's app_metadata, or nil if
+// there is none. The recorded ban may have expired; check BannedUntil to see
+// whether the user is banned.
+func CurrentBan(user *types.User) (*Record, error) {
+	if user.AppMetadata[BanKey] == nil {
+		return nil, nil
+	}
+	raw, ok := user.AppMetadata[BanKey].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("reading %s of user %s: not an object", BanKey, user.ID)
+	}
+	rec, err := metadata.Decode[Record](raw)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s of user %s: %w", BanKey, user.ID, err)
+	}
+	return &rec, nil
+}
+
+func readHistory(md map[string]interface{}) ([]Record, error) {
+	h, err := metadata.Decode[struct {
+		History []Record `json:"history"`
+	}](map[string]interface{}{"history": md[HistoryKey]})
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", HistoryKey, err)
+	}
+	return h.History, nil
+}
+
+// Banned lists the users who are currently banned.
+func (m *Manager) Banned() ([]BannedUser, error) {
+	now := m.now()
+	var banned []BannedUser
+	err := auth.NewAdminUsersPaginator(m.client, m.PerPage).Walk(func(u types.User) error {
+		if u.BannedUntil == nil || !u.BannedUntil.After(now) {
+			return nil
+		}
+		rec, err := CurrentBan(&u)
+		if err != nil {
+			return err
+		}
+		banned = append(banned, BannedUser{User: u, Ban: rec})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return banned, nil
+}
+
+// LiftExpired lifts bans that have expired and records ActionExpire in the
+// history of each user. Auth stops enforcing a ban once it expires, but
+// keeps BannedUntil and the Manager keeps the recorded ban until they are
+// lifted. It returns the users whose bans were lifted.
+func (m *Manager) LiftExpired() ([]types.User, error) {
+	now := m.now()
+	expired := func(u *types.User) bool {
+		if u.BannedUntil != nil {
+			return !u.BannedUntil.After(now)
+		}
+		return u.AppMetadata[BanKey] != nil
+	}
+
+	var candidates []uuid.UUID
+	err := auth.NewAdminUsersPaginator(m.client, m.PerPage).Walk(func(u types.User) error {
+		if expired(&u) {
+			candidates = append(candidates, u.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var lifted []types.User
+	for _, id := range candidates {
+		rec := Record{Action: ActionExpire, At: now, Reason: "ban expired", Actor: SystemActor}
+		// The user may have been banned again since they were listed.
+		u, err := m.apply(id, rec, types.BanDurationNone(), func(u *types.User) error {
+			if !expired(u) {
+				return errNotExpired
+			}
+			return nil
+		})
+		if errors.Is(err, errNotExpired) {
+			continue
+		}
+		if err != nil {
+			return lifted, fmt.Errorf("lifting expired ban of user %s: %w", id, err)
+		}
+		lifted = append(lifted, *u)
+	}
+	return lifted, nil
+}
+
+// banDuration returns the ban duration to send and when the ban ends, or nil
+// for an indefinite ban.
+func banDuration(until time.Time, d time.Duration, now time.Time) (time.Duration, *time.Time, error) {
+	switch {
+	case !until.IsZero() && d != 0:
+		return 0, nil, fmt.Errorf("%w: only one of until or duration can be set", ErrInvalidBan)
+	case !until.IsZero():
+		if !until.After(now) {
+			return 0, nil, fmt.Errorf("%w: until %s is in the past", ErrInvalidBan, until.Format(time.RFC3339))
+		}
+		until = until.UTC()
+		return until.Sub(now), &until, nil
+	case d < 0:
+		return 0, nil, fmt.Errorf("%w: negative duration %s", ErrInvalidBan, d)
+	case d > 0:
+		end := now.Add(d).UTC()
+		return d, &end, nil
+	default:
+		return Indefinitely, nil, nil
+	}
+}
+
+func (m *Manager) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+func (m *Manager) historyLimit() int {
+	if m.HistoryLimit <= 0 {
+		return 20
+	}
+	return m.HistoryLimit
+}
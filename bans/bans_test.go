@@ -0,0 +1,192 @@
+package bans_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supabase-community/auth-go/authtest"
+	"github.com/supabase-community/auth-go/bans"
+	"github.com/supabase-community/auth-go/types"
+)
+
+func TestBans(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := authtest.DefaultConfig()
+	cfg.Now = func() time.Time { return now }
+	srv := authtest.NewServer(cfg)
+	defer srv.Close()
+	client := srv.AdminClient()
+
+	manager := bans.NewManager(client, nil)
+	manager.Now = func() time.Time { return now }
+	manager.HistoryLimit = 3
+
+	alice, err := client.AdminCreateUser(types.AdminCreateUserRequest{
+		Email:       "alice@example.com",
+		AppMetadata: map[string]interface{}{"plan": "pro"},
+	})
+	require.NoError(err)
+	bob, err := client.AdminCreateUser(types.AdminCreateUserRequest{Email: "bob@example.com"})
+	require.NoError(err)
+
+	_, err = manager.Ban(bans.BanRequest{UserID: alice.ID, Until: now.Add(-time.Hour)})
+	assert.ErrorIs(err, bans.ErrInvalidBan)
+	_, err = manager.Ban(bans.BanRequest{UserID: alice.ID, Until: now.Add(time.Hour), Duration: time.Hour})
+	assert.ErrorIs(err, bans.ErrInvalidBan)
+
+	user, err := manager.Ban(bans.BanRequest{UserID: alice.ID, Duration: time.Hour, Reason: "spam", Actor: "admin@example.com"})
+	require.NoError(err)
+	require.NotNil(user.BannedUntil)
+	assert.Equal(now.Add(time.Hour), *user.BannedUntil)
+	assert.Equal("pro", user.AppMetadata["plan"])
+	ban, err := bans.CurrentBan(user)
+	require.NoError(err)
+	require.NotNil(ban)
+	assert.Equal("spam", ban.Reason)
+	assert.Equal(now.Add(time.Hour), *ban.Until)
+
+	user, err = manager.Ban(bans.BanRequest{UserID: bob.ID, Reason: "fraud"})
+	require.NoError(err)
+	assert.Equal(now.Add(bans.Indefinitely), *user.BannedUntil)
+	ban, err = bans.CurrentBan(user)
+	require.NoError(err)
+	assert.Nil(ban.Until)
+
+	banned, err := manager.Banned()
+	require.NoError(err)
+	assert.Len(banned, 2)
+
+	// Alice's ban expires and is lifted with a history entry.
+	now = now.Add(2 * time.Hour)
+	banned, err = manager.Banned()
+	require.NoError(err)
+	require.Len(banned, 1)
+	assert.Equal(bob.ID, banned[0].User.ID)
+	assert.Equal("fraud", banned[0].Ban.Reason)
+
+	lifted, err := manager.LiftExpired()
+	require.NoError(err)
+	require.Len(lifted, 1)
+	assert.Equal(alice.ID, lifted[0].ID)
+	assert.Nil(lifted[0].BannedUntil)
+	assert.NotContains(lifted[0].AppMetadata, bans.BanKey)
+	lifted, err = manager.LiftExpired()
+	require.NoError(err)
+	assert.Empty(lifted)
+
+	_, err = manager.Unban(bans.UnbanRequest{UserID: bob.ID, Reason: "appeal", Actor: "admin@example.com"})
+	require.NoError(err)
+	for i := 0; i < 2; i++ {
+		_, err = manager.Ban(bans.BanRequest{UserID: alice.ID, Duration: time.Minute})
+		require.NoError(err)
+	}
+
+	history, err := manager.History(alice.ID)
+	require.NoError(err)
+	require.Len(history, 3)
+	assert.Equal(bans.ActionExpire, history[0].Action)
+	assert.Equal(bans.SystemActor, history[0].Actor)
+	assert.Equal(bans.ActionBan, history[2].Action)
+
+	history, err = manager.History(bob.ID)
+	require.NoError(err)
+	require.Len(history, 2)
+	assert.Equal(bans.ActionUnban, history[1].Action)
+	assert.Equal("appeal", history[1].Reason)
+
+	audit, err := client.AdminAudit(types.AdminAuditRequest{
+		Query: &types.AuditQuery{Column: types.AuditQueryColumnAction, Value: "user_modified"},
+	})
+	require.NoError(err)
+	assert.Equal(6, audit.TotalCount)
+
+	_, err = manager.ScheduleBan(now, bans.BanRequest{UserID: alice.ID})
+	assert.ErrorIs(err, bans.ErrNoScheduleStore)
+}
+
+func TestSchedules(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := authtest.DefaultConfig()
+	cfg.Now = func() time.Time { return now }
+	srv := authtest.NewServer(cfg)
+	defer srv.Close()
+	client := srv.AdminClient()
+
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	manager := bans.NewManager(client, bans.NewFileScheduleStore(path))
+	manager.Now = func() time.Time { return now }
+
+	user, err := client.AdminCreateUser(types.AdminCreateUserRequest{Email: "alice@example.com"})
+	require.NoError(err)
+
+	_, err = manager.ScheduleBan(now.Add(time.Hour), bans.BanRequest{UserID: user.ID, Until: now})
+	assert.ErrorIs(err, bans.ErrInvalidBan)
+
+	unban, err := manager.ScheduleUnban(now.Add(3*time.Hour), bans.UnbanRequest{UserID: user.ID, Reason: "served"})
+	require.NoError(err)
+	ban, err := manager.ScheduleBan(now.Add(time.Hour), bans.BanRequest{UserID: user.ID, Duration: 24 * time.Hour, Reason: "cooldown"})
+	require.NoError(err)
+	cancelled, err := manager.ScheduleBan(now.Add(2*time.Hour), bans.BanRequest{UserID: user.ID})
+	require.NoError(err)
+	require.NoError(manager.CancelSchedule(cancelled.ID))
+
+	// A new manager over the same file sees the schedules.
+	manager = bans.NewManager(client, bans.NewFileScheduleStore(path))
+	manager.Now = func() time.Time { return now }
+	schedules, err := manager.Schedules(user.ID)
+	require.NoError(err)
+	require.Len(schedules, 2)
+	assert.Equal(ban.ID, schedules[0].ID)
+	assert.Equal(unban.ID, schedules[1].ID)
+
+	applied, dropped, err := manager.RunDue()
+	require.NoError(err)
+	assert.Empty(applied)
+	assert.Empty(dropped)
+
+	now = now.Add(time.Hour)
+	applied, _, err = manager.RunDue()
+	require.NoError(err)
+	require.Len(applied, 1)
+	got, err := client.AdminGetUser(types.AdminGetUserRequest{UserID: user.ID})
+	require.NoError(err)
+	require.NotNil(got.BannedUntil)
+	assert.Equal(now.Add(24*time.Hour), *got.BannedUntil)
+
+	now = now.Add(2 * time.Hour)
+	applied, _, err = manager.RunDue()
+	require.NoError(err)
+	require.Len(applied, 1)
+	assert.Equal(bans.ActionUnban, applied[0].Action)
+	got, err = client.AdminGetUser(types.AdminGetUserRequest{UserID: user.ID})
+	require.NoError(err)
+	assert.Nil(got.BannedUntil)
+
+	schedules, err = manager.Schedules(user.ID)
+	require.NoError(err)
+	assert.Empty(schedules)
+
+	// Schedules of users deleted in the meantime are dropped.
+	gone, err := manager.ScheduleBan(now.Add(time.Hour), bans.BanRequest{UserID: user.ID})
+	require.NoError(err)
+	require.NoError(client.AdminDeleteUser(types.AdminDeleteUserRequest{UserID: user.ID}))
+	now = now.Add(time.Hour)
+	applied, dropped, err = manager.RunDue()
+	require.NoError(err)
+	assert.Empty(applied)
+	require.Len(dropped, 1)
+	assert.Equal(gone.ID, dropped[0].ID)
+	schedules, err = manager.Schedules(user.ID)
+	require.NoError(err)
+	assert.Empty(schedules)
+}
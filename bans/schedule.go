@@ -0,0 +1,332 @@
+package bans
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/supabase-community/auth-go/internal/atomicfile"
+	"github.com/supabase-community/auth-go/types"
+)
+
+// Schedule is a ban or unban to apply at a later time.
+type Schedule struct {
+	ID     uuid.UUID `json:"id"`
+	At     time.Time `json:"at"`
+	Action Action    `json:"action"`
+	UserID uuid.UUID `json:"user_id"`
+
+	// Until or Duration sets when a scheduled ban ends, as in BanRequest.
+	// Duration is counted from when the ban is applied.
+	Until    time.Time     `json:"until,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+
+	Reason string `json:"reason,omitempty"`
+	Actor  string `json:"actor,omitempty"`
+}
+
+// ScheduleStore persists scheduled bans and unbans. Implementations must be
+// safe for concurrent use.
+type ScheduleStore interface {
+	Add(s Schedule) error
+	// Remove removes a schedule. Removing a missing schedule is not an
+	// error.
+	Remove(id uuid.UUID) error
+	// List returns every schedule, ordered by At.
+	List() ([]Schedule, error)
+}
+
+// ScheduleBan schedules a ban to be applied at the given time by RunDue.
+func (m *Manager) ScheduleBan(at time.Time, req BanRequest) (Schedule, error) {
+	if _, _, err := banDuration(req.Until, req.Duration, at); err != nil {
+		return Schedule{}, err
+	}
+	return m.addSchedule(Schedule{
+		At:       at,
+		Action:   ActionBan,
+		UserID:   req.UserID,
+		Until:    req.Until,
+		Duration: req.Duration,
+		Reason:   req.Reason,
+		Actor:    req.Actor,
+	})
+}
+
+// ScheduleUnban schedules an unban to be applied at the given time by
+// RunDue.
+func (m *Manager) ScheduleUnban(at time.Time, req UnbanRequest) (Schedule, error) {
+	return m.addSchedule(Schedule{
+		At:     at,
+		Action: ActionUnban,
+		UserID: req.UserID,
+		Reason: req.Reason,
+		Actor:  req.Actor,
+	})
+}
+
+func (m *Manager) addSchedule(s Schedule) (Schedule, error) {
+	if m.schedules == nil {
+		return Schedule{}, ErrNoScheduleStore
+	}
+	s.ID = uuid.New()
+	s.At = s.At.UTC()
+	if err := m.schedules.Add(s); err != nil {
+		return Schedule{}, err
+	}
+	return s, nil
+}
+
+// CancelSchedule removes a scheduled ban or unban.
+func (m *Manager) CancelSchedule(id uuid.UUID) error {
+	if m.schedules == nil {
+		return ErrNoScheduleStore
+	}
+	return m.schedules.Remove(id)
+}
+
+// Schedules returns the user's scheduled bans and unbans, or every schedule
+// if userID is uuid.Nil.
+func (m *Manager) Schedules(userID uuid.UUID) ([]Schedule, error) {
+	if m.schedules == nil {
+		return nil, ErrNoScheduleStore
+	}
+	all, err := m.schedules.List()
+	if err != nil {
+		return nil, err
+	}
+	if userID == uuid.Nil {
+		return all, nil
+	}
+	var schedules []Schedule
+	for _, s := range all {
+		if s.UserID == userID {
+			schedules = append(schedules, s)
+		}
+	}
+	return schedules, nil
+}
+
+// RunDue applies the schedules that are due and removes them from the store.
+// A schedule that fails is left in the store to be retried, and the error
+// of the first failure is returned after every due schedule was tried.
+// Schedules that can no longer be applied are removed and returned in
+// dropped rather than applied: scheduled bans whose end has passed by the
+// time they are due, and schedules of users deleted in the meantime.
+func (m *Manager) RunDue() (applied, dropped []Schedule, err error) {
+	if m.schedules == nil {
+		return nil, nil, ErrNoScheduleStore
+	}
+	schedules, err := m.schedules.List()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := m.now()
+	var firstErr error
+	failed := 0
+	for _, s := range schedules {
+		if s.At.After(now) {
+			break
+		}
+		err := m.runSchedule(s)
+		if errors.Is(err, ErrInvalidBan) || errors.Is(err, ErrUserGone) {
+			dropped = append(dropped, s)
+			err = nil
+		} else if err == nil {
+			applied = append(applied, s)
+		}
+		if err == nil {
+			err = m.schedules.Remove(s.ID)
+		}
+		if err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = fmt.Errorf("schedule %s for user %s: %w", s.ID, s.UserID, err)
+			}
+		}
+	}
+	if firstErr != nil {
+		return applied, dropped, fmt.Errorf("%d scheduled changes failed, first: %w", failed, firstErr)
+	}
+	return applied, dropped, nil
+}
+
+func (m *Manager) runSchedule(s Schedule) error {
+	var err error
+	switch s.Action {
+	case ActionBan:
+		_, err = m.Ban(BanRequest{UserID: s.UserID, Until: s.Until, Duration: s.Duration, Reason: s.Reason, Actor: s.Actor})
+	case ActionUnban:
+		_, err = m.Unban(UnbanRequest{UserID: s.UserID, Reason: s.Reason, Actor: s.Actor})
+	default:
+		return fmt.Errorf("unknown action %q", s.Action)
+	}
+	if err != nil && isUserNotFound(err) {
+		return fmt.Errorf("%w: %s", ErrUserGone, s.UserID)
+	}
+	return err
+}
+
+func isUserNotFound(err error) bool {
+	var apiErr *types.APIError
+	return errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusNotFound || apiErr.ErrorCode == "user_not_found")
+}
+
+// Run calls RunDue and LiftExpired every interval until ctx is done. Errors
+// are passed to onError, which may be nil, and do not stop Run.
+func (m *Manager) Run(ctx context.Context, interval time.Duration, onError func(error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, _, err := m.RunDue(); err != nil && onError != nil {
+			onError(err)
+		}
+		if _, err := m.LiftExpired(); err != nil && onError != nil {
+			onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func sortSchedules(schedules []Schedule) {
+	sort.SliceStable(schedules, func(i, j int) bool {
+		return schedules[i].At.Before(schedules[j].At)
+	})
+}
+
+var _ ScheduleStore = &MemoryScheduleStore{}
+
+// MemoryScheduleStore is a ScheduleStore that keeps schedules in memory.
+// They are lost on restart.
+type MemoryScheduleStore struct {
+	mu        sync.Mutex
+	schedules []Schedule
+}
+
+func NewMemoryScheduleStore() *MemoryScheduleStore {
+	return &MemoryScheduleStore{}
+}
+
+func (m *MemoryScheduleStore) Add(s Schedule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.schedules = append(m.schedules, s)
+	sortSchedules(m.schedules)
+	return nil
+}
+
+func (m *MemoryScheduleStore) Remove(id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.schedules = removeSchedule(m.schedules, id)
+	return nil
+}
+
+func (m *MemoryScheduleStore) List() ([]Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Schedule(nil), m.schedules...), nil
+}
+
+func removeSchedule(schedules []Schedule, id uuid.UUID) []Schedule {
+	kept := schedules[:0]
+	for _, s := range schedules {
+		if s.ID != id {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+var _ ScheduleStore = &FileScheduleStore{}
+
+// FileScheduleStore is a ScheduleStore that saves schedules as JSON in a
+// file. The file is replaced atomically, so a crash while saving leaves the
+// previous schedules in place. It is not safe to share the file between
+// processes.
+type FileScheduleStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileScheduleStore(path string) *FileScheduleStore {
+	return &FileScheduleStore{path: path}
+}
+
+func (f *FileScheduleStore) Add(s Schedule) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	schedules, err := f.load()
+	if err != nil {
+		return err
+	}
+	schedules = append(schedules, s)
+	sortSchedules(schedules)
+	return f.save(schedules)
+}
+
+func (f *FileScheduleStore) Remove(id uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	schedules, err := f.load()
+	if err != nil {
+		return err
+	}
+	return f.save(removeSchedule(schedules, id))
+}
+
+func (f *FileScheduleStore) List() ([]Schedule, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.load()
+}
+
+func (f *FileScheduleStore) load() ([]Schedule, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedules: %w", err)
+	}
+
+	var schedules []Schedule
+	if err := json.Unmarshal(data, &schedules); err != nil {
+		return nil, fmt.Errorf("failed to parse schedules %s: %w", f.path, err)
+	}
+	return schedules, nil
+}
+
+func (f *FileScheduleStore) save(schedules []Schedule) error {
+	if schedules == nil {
+		schedules = []Schedule{}
+	}
+	data, err := json.Marshal(schedules)
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(f.path, data); err != nil {
+		return fmt.Errorf("failed to save schedules: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package bulk_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supabase-community/auth-go/authtest"
+	"github.com/supabase-community/auth-go/bulk"
+	"github.com/supabase-community/auth-go/types"
+)
+
+func newServer(t *testing.T) *authtest.Server {
+	cfg := authtest.DefaultConfig()
+	cfg.VerifyPasswordHash = func(hash, password string) bool {
+		return hash == "$2a$10$"+password
+	}
+	srv := authtest.NewServer(cfg)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func readReport(t *testing.T, buf *bytes.Buffer) map[int]bulk.RowResult {
+	results := make(map[int]bulk.RowResult)
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var res bulk.RowResult
+		require.NoError(t, dec.Decode(&res))
+		results[res.Row] = res
+	}
+	return results
+}
+
+func TestImportJSONL(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := newServer(t)
+	admin := srv.AdminClient()
+	_, err := admin.AdminCreateUser(types.AdminCreateUserRequest{Email: "existing@example.com"})
+	require.NoError(err)
+
+	id := uuid.New()
+	input := strings.Join([]string{
+		`{"id":"` + id.String() + `","email":"hashed@example.com","password_hash":"$2a$10$secret","email_confirm":true,"user_metadata":{"plan":"pro"},"legacy_id":42}`,
+		`{"email":"plain@example.com","password":"password123","app_metadata":{"tenant":"acme"}}`,
+		``,
+		`{"email":`,
+		`{"email":"existing@example.com"}`,
+		`{"id":"not-a-uuid","email":"bad@example.com"}`,
+	}, "\n")
+
+	var report bytes.Buffer
+	im := bulk.NewImporter(admin)
+	im.Report = &report
+	summary, err := im.Import(context.Background(), strings.NewReader(input))
+	require.NoError(err)
+	assert.Equal(bulk.ImportSummary{Rows: 5, Created: 2, Existing: 1, Failed: 2}, *summary)
+
+	results := readReport(t, &report)
+	assert.Equal(bulk.StatusCreated, results[1].Status)
+	assert.Equal(id.String(), results[1].UserID)
+	assert.Equal(bulk.StatusCreated, results[2].Status)
+	// The blank line is not a row.
+	assert.Equal(bulk.StatusFailed, results[3].Status)
+	assert.Equal(bulk.StatusExists, results[4].Status)
+	assert.Equal(bulk.StatusFailed, results[5].Status)
+	assert.Contains(results[5].Error, "field id")
+
+	user, err := admin.AdminGetUser(types.AdminGetUserRequest{UserID: id})
+	require.NoError(err)
+	assert.Equal("hashed@example.com", user.Email)
+	assert.Equal("pro", user.UserMetadata["plan"])
+	assert.NotContains(user.UserMetadata, "legacy_id")
+
+	_, err = srv.Client().SignInWithEmailPassword("hashed@example.com", "secret")
+	assert.NoError(err)
+
+	// Running the import again creates nothing new.
+	summary, err = im.Import(context.Background(), strings.NewReader(input))
+	require.NoError(err)
+	assert.Equal(bulk.ImportSummary{Rows: 5, Existing: 3, Failed: 2}, *summary)
+}
+
+func TestImportCSVMappingAndResume(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := newServer(t)
+	admin := srv.AdminClient()
+	_, err := admin.AdminCreateUser(types.AdminCreateUserRequest{Email: "carol@example.com"})
+	require.NoError(err)
+
+	input := "Email Address,Name,Confirmed,Notes\n" +
+		"alice@example.com,Alice,true,imported already\n" +
+		"bob@example.com,Bob,false,\n" +
+		"carol@example.com,Carol,true,\n" +
+		"dave@example.com,Dave,maybe,\n"
+
+	progress := bulk.NewMemoryProgressStore()
+	require.NoError(progress.Save(1))
+
+	var report bytes.Buffer
+	im := bulk.NewImporter(admin)
+	im.Format = bulk.FormatCSV
+	im.Mapping = map[string]string{
+		"Email Address": bulk.FieldEmail,
+		"Name":          "user_metadata.full_name",
+		"Confirmed":     bulk.FieldEmailConfirm,
+		"Notes":         "-",
+	}
+	im.OnConflict = bulk.ConflictUpdate
+	im.Concurrency = 2
+	im.RateLimit = 1000
+	im.Progress = progress
+	im.Report = &report
+
+	summary, err := im.Import(context.Background(), strings.NewReader(input))
+	require.NoError(err)
+	assert.Equal(bulk.ImportSummary{Rows: 3, Created: 1, Updated: 1, Failed: 1, Skipped: 1}, *summary)
+
+	row, err := progress.Load()
+	require.NoError(err)
+	assert.Equal(4, row)
+
+	results := readReport(t, &report)
+	assert.NotContains(results, 1)
+	assert.Equal(bulk.StatusFailed, results[4].Status)
+
+	resp, err := admin.AdminGetUserByEmail(types.AdminGetUserByEmailRequest{Email: "carol@example.com"})
+	require.NoError(err)
+	assert.Equal("Carol", resp.UserMetadata["full_name"])
+	assert.NotNil(resp.EmailConfirmedAt)
+	assert.Equal(resp.ID.String(), results[3].UserID)
+
+	_, err = admin.AdminGetUserByEmail(types.AdminGetUserByEmailRequest{Email: "alice@example.com"})
+	assert.Error(err)
+
+	im.Mapping = map[string]string{"Email Address": "mail"}
+	_, err = im.Import(context.Background(), strings.NewReader(input))
+	assert.ErrorIs(err, bulk.ErrInvalidMapping)
+}
+
+func TestImportResumeAfterBlankLine(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := newServer(t)
+	input := `{"email": "alice@example.com"}` + "\n\n" +
+		`{"email": "bob@example.com"}` + "\n  \n" +
+		`{"email": "carol@example.com"}` + "\n"
+
+	progress := bulk.NewMemoryProgressStore()
+	im := bulk.NewImporter(srv.AdminClient())
+	im.Progress = progress
+	summary, err := im.Import(context.Background(), strings.NewReader(input))
+	require.NoError(err)
+	assert.Equal(3, summary.Created)
+	row, err := progress.Load()
+	require.NoError(err)
+	assert.Equal(3, row)
+
+	// Resuming skips every row, including those after the blank lines.
+	summary, err = im.Import(context.Background(), strings.NewReader(input))
+	require.NoError(err)
+	assert.Equal(bulk.ImportSummary{Skipped: 3}, *summary)
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	src := newServer(t)
+	admin := src.AdminClient()
+	alice, err := admin.AdminCreateUser(types.AdminCreateUserRequest{
+		Email:        "alice@example.com",
+		EmailConfirm: true,
+		UserMetadata: map[string]interface{}{"full_name": "Alice"},
+		AppMetadata:  map[string]interface{}{"plan": "pro"},
+	})
+	require.NoError(err)
+	_, err = admin.AdminCreateUser(types.AdminCreateUserRequest{Email: "bob@example.com"})
+	require.NoError(err)
+
+	var buf bytes.Buffer
+	e := bulk.NewExporter(admin)
+	e.Enrich = true
+	e.Gzip = true
+	e.PerPage = 1
+	summary, err := e.Export(context.Background(), &buf)
+	require.NoError(err)
+	assert.Equal(2, summary.Users)
+	assert.Equal(int64(buf.Len()), summary.Bytes)
+	sum := sha256.Sum256(buf.Bytes())
+	assert.Equal(hex.EncodeToString(sum[:]), summary.SHA256)
+
+	gz, err := gzip.NewReader(&buf)
+	require.NoError(err)
+
+	dst := newServer(t)
+	im := bulk.NewImporter(dst.AdminClient())
+	imported, err := im.Import(context.Background(), gz)
+	require.NoError(err)
+	assert.Equal(bulk.ImportSummary{Rows: 2, Created: 2}, *imported)
+
+	copied, err := dst.AdminClient().AdminGetUser(types.AdminGetUserRequest{UserID: alice.ID})
+	require.NoError(err)
+	assert.Equal("alice@example.com", copied.Email)
+	assert.NotNil(copied.EmailConfirmedAt)
+	assert.Equal("Alice", copied.UserMetadata["full_name"])
+	assert.Equal("pro", copied.AppMetadata["plan"])
+}
+
+func TestExportProfiles(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := newServer(t)
+	admin := srv.AdminClient()
+	_, err := admin.AdminCreateUser(types.AdminCreateUserRequest{
+		Email:        "alice@example.com",
+		Phone:        "447700900123",
+		UserMetadata: map[string]interface{}{"full_name": "Alice", "theme": "dark"},
+		AppMetadata:  map[string]interface{}{"plan": "pro", "tenant": "acme"},
+	})
+	require.NoError(err)
+
+	export := func(profile *bulk.Profile) map[string]string {
+		var buf bytes.Buffer
+		e := bulk.NewExporter(admin)
+		e.Format = bulk.FormatCSV
+		e.Fields = []string{bulk.FieldID, bulk.FieldEmail, bulk.FieldPhone, bulk.FieldUserMetadata, bulk.FieldAppMetadata}
+		e.Profile = profile
+		_, err := e.Export(context.Background(), &buf)
+		require.NoError(err)
+
+		rows, err := csv.NewReader(&buf).ReadAll()
+		require.NoError(err)
+		require.Len(rows, 2)
+		record := make(map[string]string)
+		for i, name := range rows[0] {
+			record[name] = rows[1][i]
+		}
+		return record
+	}
+
+	record := export(nil)
+	assert.Equal("alice@example.com", record["email"])
+	assert.JSONEq(`{"full_name":"Alice","theme":"dark"}`, record["user_metadata"])
+
+	record = export(bulk.MaskedProfile())
+	assert.Equal("a***@example.com", record["email"])
+	assert.Equal("*********123", record["phone"])
+	assert.NotContains(record, "user_metadata")
+
+	pseudonymized := export(bulk.PseudonymizedProfile([]byte("key")))
+	assert.NotEqual("alice@example.com", pseudonymized["email"])
+	assert.True(strings.HasSuffix(pseudonymized["email"], "@example.com"))
+	assert.Len(pseudonymized["phone"], 12)
+	assert.Equal(pseudonymized, export(bulk.PseudonymizedProfile([]byte("key"))))
+	assert.NotEqual(pseudonymized["email"], export(bulk.PseudonymizedProfile([]byte("other")))["email"])
+
+	record = export(&bulk.Profile{Fields: map[string]bulk.Action{
+		"app_metadata.tenant": bulk.ActionDrop,
+		"app_metadata.plan":   bulk.ActionMask,
+	}})
+	assert.JSONEq(`{"plan":"***","provider":"email","providers":["email"]}`, record["app_metadata"])
+}
+
+func TestExportHashEmailWithoutDomain(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := newServer(t)
+	admin := srv.AdminClient()
+	_, err := admin.AdminCreateUser(types.AdminCreateUserRequest{Email: "alice"})
+	require.NoError(err)
+
+	var buf bytes.Buffer
+	e := bulk.NewExporter(admin)
+	e.Format = bulk.FormatCSV
+	e.Fields = []string{bulk.FieldEmail}
+	e.Profile = bulk.PseudonymizedProfile([]byte("key"))
+	_, err = e.Export(context.Background(), &buf)
+	require.NoError(err)
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(err)
+	require.Len(rows, 2)
+	assert.NotContains(rows[1][0], "alice")
+	assert.Regexp("^[0-9a-f]{64}$", rows[1][0])
+}
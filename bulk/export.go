@@ -0,0 +1,487 @@
+package bulk
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/internal/ratelimit"
+	"github.com/supabase-community/auth-go/types"
+)
+
+// Fields that can be exported but are not imported. The other exported
+// fields use the names an Importer reads.
+const (
+	FieldEmailConfirmedAt = "email_confirmed_at"
+	FieldPhoneConfirmedAt = "phone_confirmed_at"
+	FieldCreatedAt        = "created_at"
+	FieldUpdatedAt        = "updated_at"
+	FieldLastSignInAt     = "last_sign_in_at"
+	FieldBannedUntil      = "banned_until"
+	FieldIdentities       = "identities"
+	FieldFactors          = "factors"
+)
+
+// DefaultExportFields are the fields written by an Exporter unless Fields is
+// set. An export with these fields can be read back by an Importer without a
+// mapping, recreating the users with the same IDs, confirmations and
+// metadata. Auth never returns password hashes, so imported users must reset
+// their passwords or sign in another way.
+var DefaultExportFields = []string{
+	FieldID,
+	FieldEmail,
+	FieldPhone,
+	FieldRole,
+	FieldAud,
+	FieldEmailConfirm,
+	FieldPhoneConfirm,
+	FieldUserMetadata,
+	FieldAppMetadata,
+	FieldCreatedAt,
+	FieldLastSignInAt,
+}
+
+// Action is what a Profile does to a field.
+type Action string
+
+const (
+	// ActionDrop leaves the field out.
+	ActionDrop Action = "drop"
+	// ActionHash replaces the value with a keyed hash, so equal values stay
+	// equal without revealing them. Emails keep their domain and phones
+	// stay numbers, so hashed users can still be imported.
+	ActionHash Action = "hash"
+	// ActionMask keeps only the first character of emails and the last
+	// three digits of phones, and replaces other strings with "***".
+	ActionMask Action = "mask"
+)
+
+// Profile redacts personal data from an export. Fields maps field names, or
+// "user_metadata.<key>" and "app_metadata.<key>" for single metadata keys, to
+// the action applied to them. Fields not listed are written as they are.
+type Profile struct {
+	Fields map[string]Action
+	// Key is the secret used by ActionHash. Exports hashed with the same key
+	// can be joined; keep it secret, or hashes of known emails can be
+	// matched.
+	Key []byte
+}
+
+// PseudonymizedProfile hashes emails and phones with key and drops names,
+// identities and user metadata, for seeding test environments with
+// realistic but anonymous users.
+func PseudonymizedProfile(key []byte) *Profile {
+	return &Profile{
+		Key: key,
+		Fields: map[string]Action{
+			FieldEmail:        ActionHash,
+			FieldPhone:        ActionHash,
+			FieldUserMetadata: ActionDrop,
+			FieldIdentities:   ActionDrop,
+		},
+	}
+}
+
+// MaskedProfile masks emails and phones and drops identities and user
+// metadata, for reports that are read by people.
+func MaskedProfile() *Profile {
+	return &Profile{
+		Fields: map[string]Action{
+			FieldEmail:        ActionMask,
+			FieldPhone:        ActionMask,
+			FieldUserMetadata: ActionDrop,
+			FieldIdentities:   ActionDrop,
+		},
+	}
+}
+
+// ExportSummary describes what an Exporter wrote.
+type ExportSummary struct {
+	Users int   `json:"users"`
+	Bytes int64 `json:"bytes"`
+	// SHA256 is the hex encoded hash of the output, after compression.
+	SHA256 string `json:"sha256"`
+}
+
+// Exporter writes every user to JSONL or CSV, for backups and for seeding
+// other projects through an Importer.
+type Exporter struct {
+	client auth.Client
+
+	// Format is the output format. Defaults to FormatJSONL.
+	Format Format
+	// Fields lists the fields written, in order. Defaults to
+	// DefaultExportFields.
+	Fields []string
+	// Enrich fetches each user with AdminGetUser and their factors with
+	// AdminListUserFactors, rather than using the listed user. This is two
+	// extra requests per user.
+	Enrich bool
+	// Profile, if set, redacts personal data.
+	Profile *Profile
+	// Gzip compresses the output.
+	Gzip bool
+	// PerPage is the page size used to list users. Defaults to the server
+	// default.
+	PerPage int
+	// RateLimit is the maximum number of requests per second made by
+	// Enrich. If zero, requests are not limited.
+	RateLimit float64
+}
+
+// NewExporter returns an Exporter that reads users with client, which must
+// have an admin token.
+func NewExporter(client auth.Client) *Exporter {
+	return &Exporter{client: client}
+}
+
+// Export writes every user to w.
+func (e *Exporter) Export(ctx context.Context, w io.Writer) (*ExportSummary, error) {
+	fields := e.Fields
+	if len(fields) == 0 {
+		fields = DefaultExportFields
+	}
+	fields = e.visibleFields(fields)
+	limiter := ratelimit.New(e.RateLimit)
+
+	sum := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(w, sum)}
+	var out io.Writer = counter
+	var gz *gzip.Writer
+	if e.Gzip {
+		gz = gzip.NewWriter(out)
+		out = gz
+	}
+
+	var enc recordEncoder
+	switch e.Format {
+	case "", FormatJSONL:
+		enc = &jsonlEncoder{w: out}
+	case FormatCSV:
+		enc = &csvEncoder{w: csv.NewWriter(out), fields: fields}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, e.Format)
+	}
+
+	summary := &ExportSummary{}
+	seen := make(map[uuid.UUID]bool)
+	p := auth.NewAdminUsersPaginator(e.client, e.PerPage)
+	for p.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		user := p.Value()
+		// Users created while listing shift later pages, so the same user
+		// may be listed twice.
+		if seen[user.ID] {
+			continue
+		}
+		seen[user.ID] = true
+
+		if e.Enrich {
+			enriched, err := e.enrich(ctx, limiter, user.ID)
+			if err != nil {
+				return nil, err
+			}
+			user = *enriched
+		}
+
+		record := e.Profile.apply(userRecord(user, fields))
+		if err := enc.encode(record); err != nil {
+			return nil, err
+		}
+		summary.Users++
+	}
+	if err := p.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := enc.flush(); err != nil {
+		return nil, err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+	}
+	summary.Bytes = counter.n
+	summary.SHA256 = hex.EncodeToString(sum.Sum(nil))
+	return summary, nil
+}
+
+func (e *Exporter) enrich(ctx context.Context, limiter *ratelimit.Limiter, id uuid.UUID) (*types.User, error) {
+	if err := limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	resp, err := e.client.AdminGetUser(types.AdminGetUserRequest{UserID: id})
+	if err != nil {
+		return nil, err
+	}
+	if err := limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	factors, err := e.client.AdminListUserFactors(types.AdminListUserFactorsRequest{UserID: id})
+	if err != nil {
+		return nil, err
+	}
+	user := resp.User
+	user.Factors = factors.Factors
+	return &user, nil
+}
+
+// visibleFields leaves out fields the profile drops, so CSV exports don't
+// have empty columns for them.
+func (e *Exporter) visibleFields(fields []string) []string {
+	if e.Profile == nil {
+		return fields
+	}
+	var visible []string
+	for _, f := range fields {
+		if e.Profile.Fields[f] != ActionDrop {
+			visible = append(visible, f)
+		}
+	}
+	return visible
+}
+
+func userRecord(u types.User, fields []string) map[string]interface{} {
+	record := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		var v interface{}
+		switch f {
+		case FieldID:
+			v = u.ID.String()
+		case FieldEmail:
+			v = u.Email
+		case FieldPhone:
+			v = u.Phone
+		case FieldRole:
+			v = u.Role
+		case FieldAud:
+			v = u.Aud
+		case FieldEmailConfirm:
+			v = u.EmailConfirmedAt != nil
+		case FieldPhoneConfirm:
+			v = u.PhoneConfirmedAt != nil
+		case FieldUserMetadata:
+			v = u.UserMetadata
+		case FieldAppMetadata:
+			v = u.AppMetadata
+		case FieldEmailConfirmedAt:
+			v = u.EmailConfirmedAt
+		case FieldPhoneConfirmedAt:
+			v = u.PhoneConfirmedAt
+		case FieldCreatedAt:
+			v = u.CreatedAt
+		case FieldUpdatedAt:
+			v = u.UpdatedAt
+		case FieldLastSignInAt:
+			v = u.LastSignInAt
+		case FieldBannedUntil:
+			v = u.BannedUntil
+		case FieldIdentities:
+			v = u.Identities
+		case FieldFactors:
+			v = u.Factors
+		default:
+			continue
+		}
+		record[f] = v
+	}
+	return record
+}
+
+func (p *Profile) apply(record map[string]interface{}) map[string]interface{} {
+	if p == nil {
+		return record
+	}
+	for field, action := range p.Fields {
+		if v, ok := record[field]; ok {
+			if action == ActionDrop {
+				delete(record, field)
+			} else {
+				record[field] = p.redact(field, action, v)
+			}
+			continue
+		}
+
+		var container, key string
+		if key = strings.TrimPrefix(field, userMetadataPrefix); key != field {
+			container = FieldUserMetadata
+		} else if key = strings.TrimPrefix(field, appMetadataPrefix); key != field {
+			container = FieldAppMetadata
+		} else {
+			continue
+		}
+		m, _ := record[container].(map[string]interface{})
+		v, ok := m[key]
+		if !ok {
+			continue
+		}
+		// Copy the metadata, which is shared with the listed user.
+		copied := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			copied[k] = v
+		}
+		if action == ActionDrop {
+			delete(copied, key)
+		} else {
+			copied[key] = p.redact(key, action, v)
+		}
+		record[container] = copied
+	}
+	return record
+}
+
+func (p *Profile) redact(field string, action Action, v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		// Objects and lists can only be dropped or replaced entirely.
+		data, _ := json.Marshal(v)
+		s = string(data)
+	}
+	if s == "" {
+		return s
+	}
+
+	switch action {
+	case ActionHash:
+		mac := hmac.New(sha256.New, p.Key)
+		mac.Write([]byte(s))
+		sum := mac.Sum(nil)
+		switch field {
+		case FieldEmail:
+			// Only a well formed address keeps its domain; anything else
+			// would be exported as is.
+			if at := strings.LastIndex(s, "@"); at >= 0 {
+				return hex.EncodeToString(sum[:8]) + s[at:]
+			}
+		case FieldPhone:
+			return hashDigits(sum, 12)
+		}
+		return hex.EncodeToString(sum)
+	case ActionMask:
+		switch field {
+		case FieldEmail:
+			at := strings.LastIndex(s, "@")
+			if at < 1 {
+				return "***"
+			}
+			return s[:1] + "***" + s[at:]
+		case FieldPhone:
+			if len(s) <= 3 {
+				return "***"
+			}
+			return strings.Repeat("*", len(s)-3) + s[len(s)-3:]
+		}
+		return "***"
+	}
+	return v
+}
+
+// hashDigits turns a hash into a string of n decimal digits.
+func hashDigits(sum []byte, n int) string {
+	var b strings.Builder
+	for i := 0; b.Len() < n; i++ {
+		b.WriteString(strconv.Itoa(int(sum[i%len(sum)]) % 10))
+	}
+	return b.String()
+}
+
+type recordEncoder interface {
+	encode(record map[string]interface{}) error
+	flush() error
+}
+
+type jsonlEncoder struct {
+	w io.Writer
+}
+
+func (j *jsonlEncoder) encode(record map[string]interface{}) error {
+	return writeJSONLine(j.w, record)
+}
+
+func (j *jsonlEncoder) flush() error { return nil }
+
+type csvEncoder struct {
+	w       *csv.Writer
+	fields  []string
+	started bool
+}
+
+func (c *csvEncoder) encode(record map[string]interface{}) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	row := make([]string, len(c.fields))
+	for i, f := range c.fields {
+		s, err := csvValue(record[f])
+		if err != nil {
+			return err
+		}
+		row[i] = s
+	}
+	return c.w.Write(row)
+}
+
+func (c *csvEncoder) writeHeader() error {
+	if c.started {
+		return nil
+	}
+	c.started = true
+	return c.w.Write(c.fields)
+}
+
+func (c *csvEncoder) flush() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func csvValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano), nil
+	case *time.Time:
+		if v == nil {
+			return "", nil
+		}
+		return v.UTC().Format(time.RFC3339Nano), nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,648 @@
+// Package bulk imports and exports users in bulk, for migrations from other
+// identity providers, backups and seeding environments.
+package bulk
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/internal/ratelimit"
+	"github.com/supabase-community/auth-go/types"
+)
+
+// Format is the file format of an import or export.
+type Format string
+
+const (
+	// FormatJSONL has one JSON object per line.
+	FormatJSONL Format = "jsonl"
+	// FormatCSV has a header row naming the fields, then one row per user.
+	// Metadata columns hold JSON objects.
+	FormatCSV Format = "csv"
+)
+
+// Fields that imported rows can be mapped to. Keys of user_metadata and
+// app_metadata can also be set one at a time by mapping to
+// "user_metadata.<key>" or "app_metadata.<key>".
+const (
+	FieldID           = "id"
+	FieldEmail        = "email"
+	FieldPhone        = "phone"
+	FieldPassword     = "password"
+	FieldPasswordHash = "password_hash"
+	FieldRole         = "role"
+	FieldAud          = "aud"
+	FieldEmailConfirm = "email_confirm"
+	FieldPhoneConfirm = "phone_confirm"
+	FieldUserMetadata = "user_metadata"
+	FieldAppMetadata  = "app_metadata"
+)
+
+const (
+	userMetadataPrefix = FieldUserMetadata + "."
+	appMetadataPrefix  = FieldAppMetadata + "."
+
+	defaultConcurrency = 4
+	progressInterval   = 100
+)
+
+var (
+	ErrUnknownFormat  = errors.New("unknown bulk format")
+	ErrInvalidMapping = errors.New("field mapping is invalid - fields must map to id, email, phone, password, password_hash, role, aud, email_confirm, phone_confirm, user_metadata, app_metadata, user_metadata.<key>, app_metadata.<key> or -")
+)
+
+// ConflictPolicy decides what happens when an imported user already exists.
+type ConflictPolicy string
+
+const (
+	// ConflictSkip leaves the existing user as it is, and counts the row as
+	// imported. This makes it safe to run an import again.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictUpdate updates the existing user from the row. Password hashes
+	// can only be set when a user is created, so they are not updated.
+	ConflictUpdate ConflictPolicy = "update"
+	// ConflictFail counts the row as failed.
+	ConflictFail ConflictPolicy = "fail"
+)
+
+// RowStatus is the outcome of importing a row.
+type RowStatus string
+
+const (
+	StatusCreated RowStatus = "created"
+	StatusExists  RowStatus = "exists"
+	StatusUpdated RowStatus = "updated"
+	StatusFailed  RowStatus = "failed"
+)
+
+// RowResult is the outcome of importing a row, as written to the report.
+type RowResult struct {
+	// Row is the number of the record, starting at 1: the non-blank line
+	// for JSONL, or the record after the header for CSV.
+	Row    int       `json:"row"`
+	Status RowStatus `json:"status"`
+	// UserID is the ID of the created or updated user. It is not looked up
+	// for users skipped by ConflictSkip, unless the row sets the ID.
+	UserID string `json:"user_id,omitempty"`
+	Email  string `json:"email,omitempty"`
+	Phone  string `json:"phone,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ImportSummary counts the outcomes of an import.
+type ImportSummary struct {
+	Rows     int `json:"rows"`
+	Created  int `json:"created"`
+	Existing int `json:"existing"`
+	Updated  int `json:"updated"`
+	Failed   int `json:"failed"`
+	// Skipped is the number of rows skipped because an earlier run had
+	// already imported them.
+	Skipped int `json:"skipped"`
+}
+
+// Importer creates users from JSONL or CSV rows with AdminCreateUser.
+//
+// Rows are imported concurrently, so they finish out of order. The progress
+// saved is the last row that it and every row before it has finished, so a
+// resumed import may repeat rows that finished after it; with ConflictSkip
+// or ConflictUpdate these are reported as existing or updated.
+type Importer struct {
+	client auth.Client
+
+	// Format is the input format. Defaults to FormatJSONL.
+	Format Format
+	// Mapping maps input field names to the Field constants. Input fields
+	// not in the mapping, or mapped to "-", are ignored. If nil, input fields
+	// are used by name, and unknown fields are ignored.
+	Mapping map[string]string
+	// Concurrency is the number of users created at once. Defaults to 4.
+	Concurrency int
+	// RateLimit is the maximum number of requests per second. If zero,
+	// requests are not limited.
+	RateLimit float64
+	// OnConflict decides what happens to users that already exist. Defaults
+	// to ConflictSkip.
+	OnConflict ConflictPolicy
+	// Progress, if set, is used to resume an interrupted import.
+	Progress ProgressStore
+	// Report, if set, receives a RowResult for each row as a line of JSON.
+	Report io.Writer
+}
+
+// NewImporter returns an Importer that creates users with client, which must
+// have an admin token.
+func NewImporter(client auth.Client) *Importer {
+	return &Importer{client: client}
+}
+
+type importJob struct {
+	row int
+	req types.AdminCreateUserRequest
+	err error
+}
+
+// Import reads rows from r and imports them. Rows that fail don't stop the
+// import; they are counted and reported. Import stops early if r can't be
+// read, the progress can't be saved, or ctx is cancelled, in which case the
+// progress made so far is saved.
+func (im *Importer) Import(ctx context.Context, r io.Reader) (*ImportSummary, error) {
+	if err := im.validateMapping(); err != nil {
+		return nil, err
+	}
+	rows, err := im.newRowReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	done := 0
+	if im.Progress != nil {
+		if done, err = im.Progress.Load(); err != nil {
+			return nil, err
+		}
+	}
+
+	concurrency := im.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	limiter := ratelimit.New(im.RateLimit)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan importJob)
+	results := make(chan RowResult)
+	var readErr error
+	summary := &ImportSummary{}
+
+	resumeAfter := done
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		defer close(jobs)
+		for ctx.Err() == nil {
+			row, fields, err := rows.next()
+			if err == io.EOF {
+				return
+			}
+			var parseErr *rowError
+			if err != nil && !errors.As(err, &parseErr) {
+				readErr = err
+				cancel()
+				return
+			}
+			if row <= resumeAfter {
+				summary.Skipped++
+				continue
+			}
+
+			job := importJob{row: row, err: err}
+			if err == nil {
+				job.req, job.err = im.buildRequest(fields)
+			}
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if job.err != nil {
+					results <- RowResult{Row: job.row, Status: StatusFailed, Error: job.err.Error()}
+					continue
+				}
+				if err := limiter.Wait(ctx); err != nil {
+					return
+				}
+				results <- im.importRow(ctx, limiter, job)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// finished holds rows after the saved progress that have finished, until
+	// every row before them has too.
+	finished := make(map[int]bool)
+	saved := done
+	var saveErr error
+	for res := range results {
+		summary.Rows++
+		switch res.Status {
+		case StatusCreated:
+			summary.Created++
+		case StatusExists:
+			summary.Existing++
+		case StatusUpdated:
+			summary.Updated++
+		case StatusFailed:
+			summary.Failed++
+		}
+		if im.Report != nil && saveErr == nil {
+			if err := writeJSONLine(im.Report, res); err != nil {
+				saveErr = fmt.Errorf("failed to write report: %w", err)
+				cancel()
+			}
+		}
+
+		finished[res.Row] = true
+		for finished[done+1] {
+			delete(finished, done+1)
+			done++
+		}
+		if im.Progress != nil && saveErr == nil && done-saved >= progressInterval {
+			if err := im.Progress.Save(done); err != nil {
+				saveErr = err
+				cancel()
+			}
+			saved = done
+		}
+	}
+
+	<-readerDone
+
+	if im.Progress != nil && saveErr == nil && done != saved {
+		saveErr = im.Progress.Save(done)
+	}
+	switch {
+	case readErr != nil:
+		return summary, readErr
+	case saveErr != nil:
+		return summary, saveErr
+	}
+	return summary, ctx.Err()
+}
+
+func (im *Importer) importRow(ctx context.Context, limiter *ratelimit.Limiter, job importJob) RowResult {
+	req := job.req
+	res := RowResult{Row: job.row, Email: req.Email, Phone: req.Phone}
+
+	user, err := im.client.AdminCreateUser(req)
+	if err == nil {
+		res.Status = StatusCreated
+		res.UserID = user.ID.String()
+		return res
+	}
+	if !isAlreadyExists(err) {
+		return failed(res, err)
+	}
+
+	switch im.OnConflict {
+	case ConflictFail:
+		return failed(res, err)
+	case ConflictUpdate:
+	default:
+		res.Status = StatusExists
+		if req.ID != nil {
+			res.UserID = req.ID.String()
+		}
+		return res
+	}
+
+	if err := limiter.Wait(ctx); err != nil {
+		return failed(res, err)
+	}
+	existing, err := im.findExisting(req)
+	if err != nil {
+		return failed(res, err)
+	}
+	res.UserID = existing.ID.String()
+
+	password := ""
+	if req.Password != nil {
+		password = *req.Password
+	}
+	if err := limiter.Wait(ctx); err != nil {
+		return failed(res, err)
+	}
+	_, err = im.client.AdminUpdateUser(types.AdminUpdateUserRequest{
+		UserID:       existing.ID,
+		Aud:          req.Aud,
+		Role:         req.Role,
+		Email:        req.Email,
+		Phone:        req.Phone,
+		Password:     password,
+		EmailConfirm: req.EmailConfirm,
+		PhoneConfirm: req.PhoneConfirm,
+		UserMetadata: req.UserMetadata,
+		AppMetadata:  req.AppMetadata,
+	})
+	if err != nil {
+		return failed(res, err)
+	}
+	res.Status = StatusUpdated
+	return res
+}
+
+func failed(res RowResult, err error) RowResult {
+	res.Status = StatusFailed
+	res.Error = err.Error()
+	return res
+}
+
+// findExisting looks up the user that a create request conflicted with.
+func (im *Importer) findExisting(req types.AdminCreateUserRequest) (*types.User, error) {
+	if req.ID != nil {
+		resp, err := im.client.AdminGetUser(types.AdminGetUserRequest{UserID: *req.ID})
+		if err == nil {
+			return &resp.User, nil
+		}
+	}
+	if req.Email != "" {
+		resp, err := im.client.AdminGetUserByEmail(types.AdminGetUserByEmailRequest{Email: req.Email})
+		if err == nil {
+			return &resp.User, nil
+		}
+		var notFound *types.ErrUserNotFound
+		if !errors.As(err, &notFound) || req.Phone == "" {
+			return nil, err
+		}
+	}
+	resp, err := im.client.AdminGetUserByPhone(types.AdminGetUserByPhoneRequest{Phone: req.Phone})
+	if err != nil {
+		return nil, err
+	}
+	return &resp.User, nil
+}
+
+// isAlreadyExists reports whether a create failed because the email, phone
+// or ID is already taken.
+func isAlreadyExists(err error) bool {
+	var apiErr *types.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.ErrorCode {
+	case "email_exists", "phone_exists", "user_already_exists":
+		return true
+	}
+	return false
+}
+
+func (im *Importer) validateMapping() error {
+	for _, target := range im.Mapping {
+		if target != "-" && !knownField(target) {
+			return fmt.Errorf("%w: unknown field %q", ErrInvalidMapping, target)
+		}
+	}
+	return nil
+}
+
+func knownField(name string) bool {
+	switch name {
+	case FieldID, FieldEmail, FieldPhone, FieldPassword, FieldPasswordHash, FieldRole, FieldAud,
+		FieldEmailConfirm, FieldPhoneConfirm, FieldUserMetadata, FieldAppMetadata:
+		return true
+	}
+	return (strings.HasPrefix(name, userMetadataPrefix) && len(name) > len(userMetadataPrefix)) ||
+		(strings.HasPrefix(name, appMetadataPrefix) && len(name) > len(appMetadataPrefix))
+}
+
+// buildRequest maps an input row to a create request.
+func (im *Importer) buildRequest(fields map[string]interface{}) (types.AdminCreateUserRequest, error) {
+	var req types.AdminCreateUserRequest
+	for name, value := range fields {
+		target := name
+		if im.Mapping != nil {
+			var ok bool
+			if target, ok = im.Mapping[name]; !ok {
+				continue
+			}
+		}
+		if target == "-" || !knownField(target) || isEmpty(value) {
+			continue
+		}
+		if err := setField(&req, target, value); err != nil {
+			return req, fmt.Errorf("field %s: %w", name, err)
+		}
+	}
+	return req, nil
+}
+
+func setField(req *types.AdminCreateUserRequest, target string, value interface{}) error {
+	switch target {
+	case FieldID:
+		id, err := uuid.Parse(stringValue(value))
+		if err != nil {
+			return err
+		}
+		req.ID = &id
+	case FieldEmail:
+		req.Email = stringValue(value)
+	case FieldPhone:
+		req.Phone = stringValue(value)
+	case FieldPassword:
+		password := stringValue(value)
+		req.Password = &password
+	case FieldPasswordHash:
+		req.PasswordHash = stringValue(value)
+	case FieldRole:
+		req.Role = stringValue(value)
+	case FieldAud:
+		req.Aud = stringValue(value)
+	case FieldEmailConfirm:
+		b, err := boolValue(value)
+		if err != nil {
+			return err
+		}
+		req.EmailConfirm = b
+	case FieldPhoneConfirm:
+		b, err := boolValue(value)
+		if err != nil {
+			return err
+		}
+		req.PhoneConfirm = b
+	case FieldUserMetadata:
+		m, err := mapValue(value)
+		if err != nil {
+			return err
+		}
+		req.UserMetadata = mergeMap(req.UserMetadata, m)
+	case FieldAppMetadata:
+		m, err := mapValue(value)
+		if err != nil {
+			return err
+		}
+		req.AppMetadata = mergeMap(req.AppMetadata, m)
+	default:
+		if key := strings.TrimPrefix(target, userMetadataPrefix); key != target {
+			req.UserMetadata = mergeMap(req.UserMetadata, map[string]interface{}{key: value})
+		} else if key := strings.TrimPrefix(target, appMetadataPrefix); key != target {
+			req.AppMetadata = mergeMap(req.AppMetadata, map[string]interface{}{key: value})
+		}
+	}
+	return nil
+}
+
+func isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	}
+	return false
+}
+
+func stringValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(value)
+}
+
+func boolValue(value interface{}) (bool, error) {
+	if b, ok := value.(bool); ok {
+		return b, nil
+	}
+	return strconv.ParseBool(stringValue(value))
+}
+
+func mapValue(value interface{}) (map[string]interface{}, error) {
+	if m, ok := value.(map[string]interface{}); ok {
+		return m, nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected an object, got %T", value)
+	}
+	var m map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func mergeMap(dst, src map[string]interface{}) map[string]interface{} {
+	if dst == nil {
+		dst = make(map[string]interface{}, len(src))
+	}
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+// rowError is an error in a single row, which doesn't stop the import.
+type rowError struct {
+	err error
+}
+
+func (e *rowError) Error() string { return e.err.Error() }
+func (e *rowError) Unwrap() error { return e.err }
+
+type rowReader interface {
+	// next returns the next row and its number, a *rowError if the row
+	// can't be parsed, or io.EOF.
+	next() (int, map[string]interface{}, error)
+}
+
+func (im *Importer) newRowReader(r io.Reader) (rowReader, error) {
+	switch im.Format {
+	case "", FormatJSONL:
+		return &jsonlReader{r: bufio.NewReader(r)}, nil
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		header, err := cr.Read()
+		if err == io.EOF {
+			return &csvReader{r: cr}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV header: %w", err)
+		}
+		cr.FieldsPerRecord = len(header)
+		return &csvReader{r: cr, header: header}, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, im.Format)
+}
+
+type jsonlReader struct {
+	r   *bufio.Reader
+	row int
+}
+
+func (j *jsonlReader) next() (int, map[string]interface{}, error) {
+	for {
+		data, err := j.r.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(data) == 0) {
+			return 0, nil, err
+		}
+		// Blank lines are not rows, so that every row number produces a
+		// result and progress can move past them.
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+		j.row++
+
+		var fields map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&fields); err != nil {
+			return j.row, nil, &rowError{err: err}
+		}
+		return j.row, fields, nil
+	}
+}
+
+type csvReader struct {
+	r      *csv.Reader
+	header []string
+	row    int
+}
+
+func (c *csvReader) next() (int, map[string]interface{}, error) {
+	if c.header == nil {
+		return 0, nil, io.EOF
+	}
+	record, err := c.r.Read()
+	if err == io.EOF {
+		return 0, nil, io.EOF
+	}
+	c.row++
+	if err != nil {
+		if errors.Is(err, csv.ErrFieldCount) {
+			return c.row, nil, &rowError{err: err}
+		}
+		return 0, nil, err
+	}
+
+	fields := make(map[string]interface{}, len(record))
+	for i, value := range record {
+		fields[c.header[i]] = value
+	}
+	return c.row, fields, nil
+}
+
+func writeJSONLine(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,92 @@
+package bulk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/supabase-community/auth-go/internal/atomicfile"
+)
+
+// ProgressStore persists how far an import has got, so it can resume after a
+// restart. The saved value is the last row number such that it and every row
+// before it has been imported.
+type ProgressStore interface {
+	// Load returns the saved row, or 0 if there is none.
+	Load() (int, error)
+	Save(row int) error
+}
+
+var _ ProgressStore = &MemoryProgressStore{}
+
+// MemoryProgressStore is a ProgressStore that keeps the progress in memory.
+// It is lost on restart.
+type MemoryProgressStore struct {
+	mu  sync.Mutex
+	row int
+}
+
+func NewMemoryProgressStore() *MemoryProgressStore {
+	return &MemoryProgressStore{}
+}
+
+func (m *MemoryProgressStore) Load() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.row, nil
+}
+
+func (m *MemoryProgressStore) Save(row int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.row = row
+	return nil
+}
+
+var _ ProgressStore = &FileProgressStore{}
+
+// FileProgressStore is a ProgressStore that saves the progress as JSON in a
+// file. The file is replaced atomically, so a crash while saving leaves the
+// previous progress in place.
+type FileProgressStore struct {
+	path string
+}
+
+func NewFileProgressStore(path string) *FileProgressStore {
+	return &FileProgressStore{path: path}
+}
+
+type progress struct {
+	Row int `json:"row"`
+}
+
+func (f *FileProgressStore) Load() (int, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read progress: %w", err)
+	}
+
+	var p progress
+	if err := json.Unmarshal(data, &p); err != nil {
+		return 0, fmt.Errorf("failed to parse progress %s: %w", f.path, err)
+	}
+	return p.Row, nil
+}
+
+func (f *FileProgressStore) Save(row int) error {
+	data, err := json.Marshal(progress{Row: row})
+	if err != nil {
+		return err
+	}
+	if err := atomicfile.WriteFile(f.path, data); err != nil {
+		return fmt.Errorf("failed to save progress: %w", err)
+	}
+	return nil
+}
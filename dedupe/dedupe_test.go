@@ -0,0 +1,153 @@
+package dedupe_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supabase-community/auth-go/authtest"
+	"github.com/supabase-community/auth-go/dedupe"
+	"github.com/supabase-community/auth-go/types"
+)
+
+func TestNormalize(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("adalovelace@gmail.com", dedupe.NormalizeEmail(" Ada.Lovelace+news@GoogleMail.com"))
+	assert.Equal("ada.lovelace@example.com", dedupe.NormalizeEmail("Ada.Lovelace+news@example.com"))
+	assert.Equal("+tag@example.com", dedupe.NormalizeEmail("+tag@example.com"))
+	assert.Equal("", dedupe.NormalizeEmail("not-an-email"))
+	assert.Equal("15550100", dedupe.NormalizePhone("+1 (555) 010-0"))
+	assert.Equal("445550100", dedupe.NormalizePhone("0044 5550100"))
+}
+
+func TestDetectAndMerge(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	cfg := authtest.DefaultConfig()
+	cfg.Now = func() time.Time { return now }
+	srv := authtest.NewServer(cfg)
+	defer srv.Close()
+	client := srv.AdminClient()
+	password := "password"
+
+	create := func(req types.AdminCreateUserRequest) *types.User {
+		now = now.Add(time.Hour)
+		req.Password = &password
+		u, err := client.AdminCreateUser(req)
+		require.NoError(err)
+		return &u.User
+	}
+	ada1 := create(types.AdminCreateUserRequest{Email: "ada.lovelace@gmail.com", EmailConfirm: true})
+	ada2 := create(types.AdminCreateUserRequest{
+		Email:        "adalovelace+news@googlemail.com",
+		EmailConfirm: true,
+		UserMetadata: map[string]interface{}{"name": "Ada", "plan": "pro"},
+		AppMetadata:  map[string]interface{}{"tier": "gold", "roles": []interface{}{"admin"}},
+	})
+	ada3 := create(types.AdminCreateUserRequest{
+		Email:        "AdaLovelace@gmail.com",
+		EmailConfirm: true,
+		UserMetadata: map[string]interface{}{"name": "Ada Lovelace"},
+	})
+	bob1 := create(types.AdminCreateUserRequest{Email: "bob@example.com"})
+	bob2 := create(types.AdminCreateUserRequest{
+		Email:        "bob+shop@example.com",
+		UserMetadata: map[string]interface{}{"plan": "pro"},
+	})
+	create(types.AdminCreateUserRequest{Email: "carol@example.com"})
+	old := create(types.AdminCreateUserRequest{Email: "carol+old@example.com"})
+	require.NoError(client.AdminDeleteUser(types.AdminDeleteUserRequest{UserID: old.ID, ShouldSoftDelete: true}))
+
+	for _, email := range []string{"ada.lovelace@gmail.com", "adalovelace@gmail.com"} {
+		now = now.Add(time.Hour)
+		_, err := srv.Client().SignInWithEmailPassword(email, password)
+		require.NoError(err)
+	}
+
+	detector := dedupe.NewDetector(client)
+	detector.PerPage = 2
+	clusters, err := detector.Detect(context.Background())
+	require.NoError(err)
+	require.Len(clusters, 2)
+	require.Len(clusters[0].Users, 3)
+	assert.Equal(ada1.ID, clusters[0].Users[0].ID)
+	assert.Equal([]string{"email:adalovelace@gmail.com"}, clusters[0].Keys)
+	require.Len(clusters[1].Users, 2)
+	assert.Equal(bob1.ID, clusters[1].Users[0].ID)
+
+	merger := dedupe.NewMerger(client)
+	merger.Actor = "admin@example.com"
+	plan, err := merger.Plan(clusters[0])
+	require.NoError(err)
+	assert.Equal(ada3.ID, plan.Survivor.UserID)
+	assert.Equal(dedupe.ActionKeep, plan.Survivor.Action)
+	require.Len(plan.Duplicates, 2)
+	assert.Equal(map[string]interface{}{"plan": "pro"}, plan.UserMetadata)
+	assert.Equal(map[string]interface{}{"tier": "gold"}, plan.AppMetadata)
+	require.Len(plan.Conflicts, 1)
+	assert.Equal("name", plan.Conflicts[0].Key)
+	assert.Equal(ada2.ID, plan.Conflicts[0].UserID)
+
+	// Planning changes nothing.
+	var text bytes.Buffer
+	require.NoError(plan.WriteText(&text))
+	assert.Contains(text.String(), "planned  ban          "+ada2.ID.String())
+	assert.Contains(text.String(), "conflict user_metadata.name: keeping Ada Lovelace over Ada")
+	got, err := client.AdminGetUser(types.AdminGetUserRequest{UserID: ada2.ID})
+	require.NoError(err)
+	assert.Nil(got.BannedUntil)
+
+	require.NoError(merger.Apply(plan))
+	assert.Equal(dedupe.StatusDone, plan.Survivor.Status)
+	for _, d := range plan.Duplicates {
+		assert.Equal(dedupe.StatusDone, d.Status)
+	}
+	got, err = client.AdminGetUser(types.AdminGetUserRequest{UserID: ada3.ID})
+	require.NoError(err)
+	assert.Equal("Ada Lovelace", got.UserMetadata["name"])
+	assert.Equal("pro", got.UserMetadata["plan"])
+	assert.Equal("gold", got.AppMetadata["tier"])
+	assert.NotContains(got.AppMetadata, "roles")
+	assert.ElementsMatch([]interface{}{ada1.ID.String(), ada2.ID.String()}, got.AppMetadata[dedupe.MergedFromKey])
+	_, err = srv.Client().SignInWithEmailPassword("ada.lovelace@gmail.com", password)
+	assert.Error(err)
+	_, err = srv.Client().SignInWithEmailPassword("adalovelace@gmail.com", password)
+	assert.NoError(err)
+
+	merger.Action = dedupe.ActionSoftDelete
+	plan, err = merger.Plan(clusters[1])
+	require.NoError(err)
+	assert.Equal(bob1.ID, plan.Survivor.UserID)
+	// bob2 never confirmed their email, so their metadata is not trusted.
+	assert.Empty(plan.UserMetadata)
+	require.Len(plan.Conflicts, 1)
+	assert.True(plan.Conflicts[0].Unconfirmed)
+	assert.Equal("plan", plan.Conflicts[0].Key)
+	text.Reset()
+	require.NoError(plan.WriteText(&text))
+	assert.Contains(text.String(), "conflict user_metadata.plan: not adding pro from unconfirmed "+bob2.ID.String())
+	require.NoError(merger.Apply(plan))
+	got, err = client.AdminGetUser(types.AdminGetUserRequest{UserID: bob2.ID})
+	require.NoError(err)
+	assert.NotNil(got.DeletedAt)
+	got, err = client.AdminGetUser(types.AdminGetUserRequest{UserID: bob1.ID})
+	require.NoError(err)
+	assert.NotContains(got.UserMetadata, "plan")
+
+	// Merged users are not detected again.
+	clusters, err = detector.Detect(context.Background())
+	require.NoError(err)
+	assert.Empty(clusters)
+
+	merger.Action = "archive"
+	_, err = merger.Plan(dedupe.Cluster{Users: []types.User{*ada3, *bob1}})
+	assert.ErrorIs(err, dedupe.ErrUnknownAction)
+}
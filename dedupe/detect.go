@@ -0,0 +1,202 @@
+// Package dedupe finds users who signed up more than once, e.g. with a
+// password and again with Google under a differently cased or plus-addressed
+// email, and merges each set of duplicates into one surviving account.
+package dedupe
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/types"
+)
+
+// gmailDomains are the domains that ignore dots in the local part.
+var gmailDomains = map[string]bool{"gmail.com": true, "googlemail.com": true}
+
+// NormalizeEmail returns the address that email is delivered to: lower
+// cased, without a "+tag" suffix on the local part, and for Gmail without
+// dots in the local part. It returns "" for an empty or invalid address.
+func NormalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" || domain == "" {
+		return ""
+	}
+	if i := strings.IndexByte(local, '+'); i > 0 {
+		local = local[:i]
+	}
+	if gmailDomains[domain] {
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+	return local + "@" + domain
+}
+
+// NormalizePhone returns the digits of phone without a leading "00"
+// international prefix, so that "+1 (555) 010-0" and "15550100" match.
+func NormalizePhone(phone string) string {
+	var b strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return strings.TrimPrefix(b.String(), "00")
+}
+
+// Cluster is a set of users who are likely the same person.
+type Cluster struct {
+	// Users are the users, oldest first.
+	Users []types.User
+	// Keys are the normalized emails and phones, prefixed with "email:" or
+	// "phone:", that more than one of the users share.
+	Keys []string
+}
+
+// Detector finds clusters of duplicate users.
+type Detector struct {
+	client auth.Client
+
+	// NormalizeEmail and NormalizePhone normalize the emails and phones of
+	// users and their identities. Default to the functions of the same
+	// name.
+	NormalizeEmail func(string) string
+	NormalizePhone func(string) string
+	// PerPage is the page size used to list users. Defaults to 100.
+	PerPage int
+}
+
+// NewDetector returns a Detector. The client must have an admin token set.
+func NewDetector(client auth.Client) *Detector {
+	return &Detector{
+		client:         client,
+		NormalizeEmail: NormalizeEmail,
+		NormalizePhone: NormalizePhone,
+		PerPage:        100,
+	}
+}
+
+// Detect lists every user and returns the clusters of users who share a
+// normalized email or phone, either on the user or in the identity data of
+// one of their identities. Users who share a key with a member of a cluster
+// join it, so a cluster can hold users with different emails. Soft deleted
+// and anonymous users are ignored, as are users that a Merger already merged
+// into another user.
+//
+// Every user is held in memory while clustering.
+func (d *Detector) Detect(ctx context.Context) ([]Cluster, error) {
+	var users []types.User
+	var parent []int
+	owners := map[string]int{}
+	shared := map[string]bool{}
+	merged := map[string]bool{}
+
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	err := auth.NewAdminUsersPaginator(d.client, d.PerPage).Walk(func(u types.User) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if u.DeletedAt != nil || u.IsAnonymous {
+			return nil
+		}
+		ids, _ := u.AppMetadata[MergedFromKey].([]interface{})
+		for _, id := range ids {
+			if id, ok := id.(string); ok {
+				merged[id] = true
+			}
+		}
+		i := len(users)
+		users = append(users, u)
+		parent = append(parent, i)
+		for _, key := range d.keys(&u) {
+			owner, ok := owners[key]
+			if !ok {
+				owners[key] = i
+				continue
+			}
+			shared[key] = true
+			if a, b := find(owner), find(i); a != b {
+				parent[b] = a
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	members := map[int][]int{}
+	for i := range users {
+		if merged[users[i].ID.String()] {
+			continue
+		}
+		root := find(i)
+		members[root] = append(members[root], i)
+	}
+	keys := map[int][]string{}
+	for key := range shared {
+		root := find(owners[key])
+		keys[root] = append(keys[root], key)
+	}
+
+	var clusters []Cluster
+	for root, idx := range members {
+		if len(idx) < 2 {
+			continue
+		}
+		c := Cluster{Keys: keys[root]}
+		for _, i := range idx {
+			c.Users = append(c.Users, users[i])
+		}
+		sort.SliceStable(c.Users, func(i, j int) bool { return c.Users[i].CreatedAt.Before(c.Users[j].CreatedAt) })
+		sort.Strings(c.Keys)
+		clusters = append(clusters, c)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Users[0].CreatedAt.Before(clusters[j].Users[0].CreatedAt)
+	})
+	return clusters, nil
+}
+
+// keys returns the distinct normalized keys of the user.
+func (d *Detector) keys(u *types.User) []string {
+	seen := map[string]bool{}
+	var keys []string
+	add := func(kind, v string) {
+		if v == "" {
+			return
+		}
+		key := kind + ":" + v
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	normEmail, normPhone := d.NormalizeEmail, d.NormalizePhone
+	if normEmail == nil {
+		normEmail = NormalizeEmail
+	}
+	if normPhone == nil {
+		normPhone = NormalizePhone
+	}
+	add("email", normEmail(u.Email))
+	add("phone", normPhone(u.Phone))
+	for _, id := range u.Identities {
+		if email, ok := id.IdentityData["email"].(string); ok {
+			add("email", normEmail(email))
+		}
+		if phone, ok := id.IdentityData["phone"].(string); ok {
+			add("phone", normPhone(phone))
+		}
+	}
+	return keys
+}
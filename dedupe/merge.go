@@ -0,0 +1,398 @@
+package dedupe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/bans"
+	"github.com/supabase-community/auth-go/metadata"
+	"github.com/supabase-community/auth-go/mfa"
+	"github.com/supabase-community/auth-go/rbac"
+	"github.com/supabase-community/auth-go/types"
+)
+
+// MergedFromKey is the app_metadata key of the survivor that the IDs of the
+// users merged into it are recorded under.
+const MergedFromKey = "merged_from"
+
+var ErrUnknownAction = errors.New("unknown merge action")
+
+// Action is what is done to a duplicate once it is merged.
+type Action string
+
+const (
+	// ActionBan bans the duplicate indefinitely. It can be undone by
+	// unbanning the user.
+	ActionBan        Action = "ban"
+	ActionSoftDelete Action = "soft_delete"
+	ActionDelete     Action = "delete"
+	// ActionKeep is the action of the survivor.
+	ActionKeep Action = "keep"
+)
+
+// Status is what happened to an entry of a MergePlan.
+type Status string
+
+const (
+	StatusPlanned Status = "planned"
+	StatusDone    Status = "done"
+	StatusFailed  Status = "failed"
+	// StatusSkipped is an entry that was not applied because an earlier
+	// one failed.
+	StatusSkipped Status = "skipped"
+)
+
+// Entry is a user of a MergePlan.
+type Entry struct {
+	UserID uuid.UUID `json:"user_id"`
+	Email  string    `json:"email,omitempty"`
+	Phone  string    `json:"phone,omitempty"`
+	Action Action    `json:"action"`
+	Status Status    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Conflict is a metadata key that a duplicate has a different value for than
+// the survivor. The survivor's value is kept.
+type Conflict struct {
+	Kind   metadata.Kind `json:"kind"`
+	Key    string        `json:"key"`
+	UserID uuid.UUID     `json:"user_id"`
+	Value  interface{}   `json:"value"`
+	Kept   interface{}   `json:"kept"`
+	// Unconfirmed is set for keys of a duplicate without a confirmed email
+	// or phone. Their values are not merged, as anyone could have signed up
+	// with the duplicate's email or phone, so Kept may be nil.
+	Unconfirmed bool `json:"unconfirmed,omitempty"`
+}
+
+// MergePlan is how a cluster is merged. Merger.Plan returns it with every
+// entry planned, and Merger.Apply fills in the outcome.
+type MergePlan struct {
+	Survivor   Entry    `json:"survivor"`
+	Duplicates []Entry  `json:"duplicates"`
+	Keys       []string `json:"keys"`
+
+	// UserMetadata and AppMetadata are the keys that only duplicates with a
+	// confirmed email or phone have, which are added to the survivor. When
+	// several duplicates have a key, the value of the oldest one is used.
+	UserMetadata map[string]interface{} `json:"user_metadata"`
+	AppMetadata  map[string]interface{} `json:"app_metadata"`
+	Conflicts    []Conflict             `json:"conflicts"`
+}
+
+// WriteText writes the plan for review, one line per user and conflict.
+func (p *MergePlan) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "cluster %s\n", strings.Join(p.Keys, ", "))
+	for _, e := range append([]Entry{p.Survivor}, p.Duplicates...) {
+		fmt.Fprintf(&b, "  %-8s %-12s %s %s", e.Status, e.Action, e.UserID, contact(e))
+		if e.Error != "" {
+			fmt.Fprintf(&b, ": %s", e.Error)
+		}
+		b.WriteString("\n")
+	}
+	for _, kind := range []metadata.Kind{metadata.KindUser, metadata.KindApp} {
+		m := p.UserMetadata
+		if kind == metadata.KindApp {
+			m = p.AppMetadata
+		}
+		for _, k := range sortedKeys(m) {
+			fmt.Fprintf(&b, "  add      %s.%s = %v\n", kind, k, m[k])
+		}
+	}
+	for _, c := range p.Conflicts {
+		if c.Unconfirmed {
+			fmt.Fprintf(&b, "  conflict %s.%s: not adding %v from unconfirmed %s\n", c.Kind, c.Key, c.Value, c.UserID)
+			continue
+		}
+		fmt.Fprintf(&b, "  conflict %s.%s: keeping %v over %v from %s\n", c.Kind, c.Key, c.Kept, c.Value, c.UserID)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func contact(e Entry) string {
+	if e.Email != "" {
+		return e.Email
+	}
+	return e.Phone
+}
+
+// Merger plans and applies merges of duplicate users.
+//
+// Auth cannot move identities between users, so a duplicate's sign-in
+// methods are not carried over: once merged, the user signs in with the
+// survivor's.
+type Merger struct {
+	client  auth.Client
+	updater *metadata.Updater
+	bans    *bans.Manager
+
+	// Action is what is done to duplicates. Defaults to ActionBan.
+	Action Action
+	// Choose returns the index of the survivor in users, which are ordered
+	// oldest first. Defaults to PreferConfirmed.
+	Choose func(users []types.User) int
+	// SkipAppKeys are app_metadata keys that are never merged, because Auth
+	// or another package manages them per user. Defaults to Auth's provider
+	// keys and the keys of the bans, rbac and mfa packages, so that merging
+	// never grants a role or carries over a ban.
+	SkipAppKeys []string
+	// Actor is recorded as who banned duplicates, e.g. an admin's email.
+	Actor string
+}
+
+// NewMerger returns a Merger. The client must have an admin token set.
+func NewMerger(client auth.Client) *Merger {
+	updater := metadata.NewUpdater(client)
+	updater.Kind = metadata.KindApp
+	return &Merger{
+		client:  client,
+		updater: updater,
+		bans:    bans.NewManager(client, nil),
+		Action:  ActionBan,
+		Choose:  PreferConfirmed,
+		SkipAppKeys: []string{
+			"provider", "providers", MergedFromKey,
+			bans.BanKey, bans.HistoryKey,
+			rbac.RolesKey, rbac.TenantRolesKey, mfa.ResetsKey,
+		},
+	}
+}
+
+// PreferConfirmed chooses the user with a confirmed email or phone who
+// signed in most recently, falling back to the oldest user.
+func PreferConfirmed(users []types.User) int {
+	best := 0
+	for i := 1; i < len(users); i++ {
+		if better(&users[i], &users[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+func better(a, b *types.User) bool {
+	ac, bc := confirmed(a), confirmed(b)
+	if ac != bc {
+		return ac
+	}
+	switch {
+	case a.LastSignInAt == nil:
+		return false
+	case b.LastSignInAt == nil:
+		return true
+	default:
+		return a.LastSignInAt.After(*b.LastSignInAt)
+	}
+}
+
+func confirmed(u *types.User) bool {
+	return u.EmailConfirmedAt != nil || u.PhoneConfirmedAt != nil
+}
+
+// Plan chooses the survivor of the cluster and works out the metadata to
+// merge into it. Nothing is changed, so the plan can be reviewed as a dry
+// run before it is applied.
+func (m *Merger) Plan(c Cluster) (*MergePlan, error) {
+	action := m.action()
+	switch action {
+	case ActionBan, ActionSoftDelete, ActionDelete:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAction, action)
+	}
+	if len(c.Users) < 2 {
+		return nil, fmt.Errorf("cluster has %d users, need at least 2", len(c.Users))
+	}
+	choose := m.Choose
+	if choose == nil {
+		choose = PreferConfirmed
+	}
+	si := choose(c.Users)
+	if si < 0 || si >= len(c.Users) {
+		return nil, fmt.Errorf("survivor index %d out of range", si)
+	}
+	survivor := &c.Users[si]
+
+	plan := &MergePlan{
+		Survivor:     entry(survivor, ActionKeep),
+		Keys:         c.Keys,
+		UserMetadata: map[string]interface{}{},
+		AppMetadata:  map[string]interface{}{},
+		Conflicts:    []Conflict{},
+	}
+	for i := range c.Users {
+		if i == si {
+			continue
+		}
+		d := &c.Users[i]
+		plan.Duplicates = append(plan.Duplicates, entry(d, action))
+		plan.Conflicts = append(plan.Conflicts, merge(metadata.KindUser, plan.UserMetadata, survivor.UserMetadata, d, nil)...)
+		plan.Conflicts = append(plan.Conflicts, merge(metadata.KindApp, plan.AppMetadata, survivor.AppMetadata, d, m.SkipAppKeys)...)
+	}
+	return plan, nil
+}
+
+func entry(u *types.User, action Action) Entry {
+	return Entry{UserID: u.ID, Email: u.Email, Phone: u.Phone, Action: action, Status: StatusPlanned}
+}
+
+// merge adds the keys of the duplicate's metadata that neither the survivor
+// nor an earlier duplicate has to added, and returns the conflicts. Keys of
+// a duplicate without a confirmed email or phone are never added; they are
+// returned as conflicts instead.
+func merge(kind metadata.Kind, added, survivor map[string]interface{}, d *types.User, skip []string) []Conflict {
+	src := d.UserMetadata
+	if kind == metadata.KindApp {
+		src = d.AppMetadata
+	}
+	trusted := confirmed(d)
+	var conflicts []Conflict
+	for _, k := range sortedKeys(src) {
+		if contains(skip, k) {
+			continue
+		}
+		v := src[k]
+		kept, ok := survivor[k]
+		if !ok {
+			kept, ok = added[k]
+		}
+		switch {
+		case ok && reflect.DeepEqual(kept, v):
+		case !trusted:
+			conflicts = append(conflicts, Conflict{Kind: kind, Key: k, UserID: d.ID, Value: v, Kept: kept, Unconfirmed: true})
+		case ok:
+			conflicts = append(conflicts, Conflict{Kind: kind, Key: k, UserID: d.ID, Value: v, Kept: kept})
+		default:
+			added[k] = v
+		}
+	}
+	return conflicts
+}
+
+// Apply merges the plan's metadata into the survivor, records the
+// duplicates under MergedFromKey, then bans or deletes each duplicate. It
+// stops at the first failure, marking the rest of the entries skipped, and
+// returns the error. The plan is updated with the outcome of each entry.
+//
+// Keys that the survivor gained since the plan was made are not
+// overwritten.
+func (m *Merger) Apply(plan *MergePlan) error {
+	err := m.updateSurvivor(plan)
+	if err != nil {
+		plan.Survivor.Status = StatusFailed
+		plan.Survivor.Error = err.Error()
+		for i := range plan.Duplicates {
+			plan.Duplicates[i].Status = StatusSkipped
+		}
+		return fmt.Errorf("merging into user %s: %w", plan.Survivor.UserID, err)
+	}
+	plan.Survivor.Status = StatusDone
+
+	for i := range plan.Duplicates {
+		e := &plan.Duplicates[i]
+		if err != nil {
+			e.Status = StatusSkipped
+			continue
+		}
+		if derr := m.retire(plan.Survivor.UserID, e); derr != nil {
+			e.Status = StatusFailed
+			e.Error = derr.Error()
+			err = fmt.Errorf("%s user %s: %w", e.Action, e.UserID, derr)
+			continue
+		}
+		e.Status = StatusDone
+	}
+	return err
+}
+
+func (m *Merger) updateSurvivor(plan *MergePlan) error {
+	_, err := m.updater.UpdateWith(plan.Survivor.UserID, func(user *types.User, app map[string]interface{}, req *types.AdminUpdateUserRequest) error {
+		for k, v := range plan.AppMetadata {
+			if _, ok := app[k]; !ok {
+				app[k] = v
+			}
+		}
+		merged, _ := app[MergedFromKey].([]interface{})
+		for _, d := range plan.Duplicates {
+			if !containsValue(merged, d.UserID.String()) {
+				merged = append(merged, d.UserID.String())
+			}
+		}
+		app[MergedFromKey] = merged
+
+		userMeta := map[string]interface{}{}
+		for k, v := range plan.UserMetadata {
+			if _, ok := user.UserMetadata[k]; !ok {
+				userMeta[k] = v
+			}
+		}
+		if len(userMeta) > 0 {
+			req.UserMetadata = userMeta
+		}
+		return nil
+	})
+	return err
+}
+
+func (m *Merger) retire(survivorID uuid.UUID, e *Entry) error {
+	switch e.Action {
+	case ActionBan:
+		_, err := m.bans.Ban(bans.BanRequest{
+			UserID: e.UserID,
+			Reason: "duplicate of " + survivorID.String(),
+			Actor:  m.Actor,
+		})
+		return err
+	case ActionSoftDelete, ActionDelete:
+		return m.client.AdminDeleteUser(types.AdminDeleteUserRequest{
+			UserID:           e.UserID,
+			ShouldSoftDelete: e.Action == ActionSoftDelete,
+		})
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownAction, e.Action)
+	}
+}
+
+func (m *Merger) action() Action {
+	if m.Action == "" {
+		return ActionBan
+	}
+	return m.Action
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsValue(list []interface{}, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -4,9 +4,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"strings"
 
+	"github.com/supabase-community/auth-go/internal/normalize"
 	"github.com/supabase-community/auth-go/types"
 )
 
@@ -33,11 +34,7 @@ func (c *Client) AdminCreateUser(req types.AdminCreateUserRequest) (*types.Admin
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		fullBody, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("response status code %d", resp.StatusCode)
-		}
-		return nil, fmt.Errorf("response status code %d: %s", resp.StatusCode, fullBody)
+		return nil, responseError(resp)
 	}
 
 	var res types.AdminCreateUserResponse
@@ -52,7 +49,26 @@ func (c *Client) AdminCreateUser(req types.AdminCreateUserRequest) (*types.Admin
 // GET /admin/users
 //
 // Get a list of users.
+//
+// The result may be paginated with Page and PerPage in the request. The
+// response will include the total number of users, as well as the total
+// number of pages and, if not already on the last page, the next page number.
 func (c *Client) AdminListUsers(req types.AdminListUsersRequest) (*types.AdminListUsersResponse, error) {
+	sort := make([]string, 0, len(req.Sort))
+	for _, s := range req.Sort {
+		if s.Field != types.UserSortFieldCreatedAt {
+			return nil, types.ErrInvalidAdminListUsersRequest
+		}
+		switch s.Direction {
+		case "":
+			sort = append(sort, string(s.Field))
+		case types.SortAscending, types.SortDescending:
+			sort = append(sort, fmt.Sprintf("%s %s", s.Field, s.Direction))
+		default:
+			return nil, types.ErrInvalidAdminListUsersRequest
+		}
+	}
+
 	r, err := c.newRequest(adminUsersPath, http.MethodGet, nil)
 	if err != nil {
 		return nil, err
@@ -65,6 +81,12 @@ func (c *Client) AdminListUsers(req types.AdminListUsersRequest) (*types.AdminLi
 	if req.PerPage != nil {
 		q.Add("per_page", fmt.Sprintf("%d", *req.PerPage))
 	}
+	if req.Filter != "" {
+		q.Add("filter", req.Filter)
+	}
+	if len(sort) > 0 {
+		q.Add("sort", strings.Join(sort, ","))
+	}
 	r.URL.RawQuery = q.Encode()
 
 	resp, err := c.client.Do(r)
@@ -74,11 +96,7 @@ func (c *Client) AdminListUsers(req types.AdminListUsersRequest) (*types.AdminLi
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		fullBody, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("response status code %d", resp.StatusCode)
-		}
-		return nil, fmt.Errorf("response status code %d: %s", resp.StatusCode, fullBody)
+		return nil, responseError(resp)
 	}
 
 	var res types.AdminListUsersResponse
@@ -87,6 +105,15 @@ func (c *Client) AdminListUsers(req types.AdminListUsersRequest) (*types.AdminLi
 		return nil, err
 	}
 
+	var page uint = 1
+	if req.Page != nil && *req.Page > 0 {
+		page = uint(*req.Page)
+	}
+	p := parsePagination(resp.Header, page)
+	res.TotalCount = p.totalCount
+	res.TotalPages = p.totalPages
+	res.NextPage = p.nextPage
+
 	return &res, nil
 }
 
@@ -107,11 +134,7 @@ func (c *Client) AdminGetUser(req types.AdminGetUserRequest) (*types.AdminGetUse
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		fullBody, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("response status code %d", resp.StatusCode)
-		}
-		return nil, fmt.Errorf("response status code %d: %s", resp.StatusCode, fullBody)
+		return nil, responseError(resp)
 	}
 
 	var res types.AdminGetUserResponse
@@ -123,6 +146,87 @@ func (c *Client) AdminGetUser(req types.AdminGetUserRequest) (*types.AdminGetUse
 	return &res, nil
 }
 
+// GET /admin/users?filter={email}
+//
+// Get a user by their email address. The email is compared case
+// insensitively, ignoring surrounding whitespace.
+//
+// Returns *types.ErrUserNotFound if there is no user with the email.
+func (c *Client) AdminGetUserByEmail(req types.AdminGetUserByEmailRequest) (*types.AdminGetUserResponse, error) {
+	email := normalize.Email(req.Email)
+	if email == "" {
+		return nil, &types.ErrUserNotFound{Email: req.Email}
+	}
+
+	// The filter also matches substrings and full names, so check each
+	// result for an exact match.
+	user, err := c.findUser(email, func(u *types.User) bool {
+		return normalize.Email(u.Email) == email
+	})
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, &types.ErrUserNotFound{Email: req.Email}
+	}
+	return &types.AdminGetUserResponse{User: *user}, nil
+}
+
+// GET /admin/users
+//
+// Get a user by their phone number. Formatting such as spaces, dashes,
+// brackets and a leading + is ignored when comparing numbers.
+//
+// Auth cannot filter users by phone number, so this pages through every
+// user. Prefer AdminGetUser or AdminGetUserByEmail where possible.
+//
+// Returns *types.ErrUserNotFound if there is no user with the phone number.
+func (c *Client) AdminGetUserByPhone(req types.AdminGetUserByPhoneRequest) (*types.AdminGetUserResponse, error) {
+	phone := normalize.Phone(req.Phone)
+	if phone == "" {
+		return nil, &types.ErrUserNotFound{Phone: req.Phone}
+	}
+
+	user, err := c.findUser("", func(u *types.User) bool {
+		return normalize.Phone(u.Phone) == phone
+	})
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, &types.ErrUserNotFound{Phone: req.Phone}
+	}
+	return &types.AdminGetUserResponse{User: *user}, nil
+}
+
+const findUserPerPage = 1000
+
+// findUser pages through the users matching filter, and returns the first
+// one for which match returns true, or nil if there is none.
+func (c *Client) findUser(filter string, match func(u *types.User) bool) (*types.User, error) {
+	perPage := findUserPerPage
+	page := 1
+	for {
+		resp, err := c.AdminListUsers(types.AdminListUsersRequest{
+			Page:    &page,
+			PerPage: &perPage,
+			Filter:  filter,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i := range resp.Users {
+			if match(&resp.Users[i]) {
+				return &resp.Users[i], nil
+			}
+		}
+		if resp.NextPage == 0 || int(resp.NextPage) <= page || len(resp.Users) == 0 {
+			return nil, nil
+		}
+		page = int(resp.NextPage)
+	}
+}
+
 // PUT /admin/users/{user_id}
 //
 // Update a user by their user_id.
@@ -145,11 +249,7 @@ func (c *Client) AdminUpdateUser(req types.AdminUpdateUserRequest) (*types.Admin
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		fullBody, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("response status code %d", resp.StatusCode)
-		}
-		return nil, fmt.Errorf("response status code %d: %s", resp.StatusCode, fullBody)
+		return nil, responseError(resp)
 	}
 
 	var res types.AdminUpdateUserResponse
@@ -163,10 +263,16 @@ func (c *Client) AdminUpdateUser(req types.AdminUpdateUserRequest) (*types.Admin
 
 // DELETE /admin/users/{user_id}
 //
-// Delete a user by their user_id.
+// Delete a user by their user_id. Set ShouldSoftDelete to soft delete the
+// user instead.
 func (c *Client) AdminDeleteUser(req types.AdminDeleteUserRequest) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
 	path := fmt.Sprintf("%s/%s", adminUsersPath, req.UserID)
-	r, err := c.newRequest(path, http.MethodDelete, nil)
+	r, err := c.newRequest(path, http.MethodDelete, bytes.NewBuffer(body))
 	if err != nil {
 		return err
 	}
@@ -178,11 +284,7 @@ func (c *Client) AdminDeleteUser(req types.AdminDeleteUserRequest) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		fullBody, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("response status code %d", resp.StatusCode)
-		}
-		return fmt.Errorf("response status code %d: %s", resp.StatusCode, fullBody)
+		return responseError(resp)
 	}
 
 	return nil
@@ -0,0 +1,59 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/tomnomnom/linkheader"
+)
+
+type pagination struct {
+	totalCount int
+	totalPages uint
+	nextPage   uint
+}
+
+// parsePagination reads the X-Total-Count and Link headers returned by
+// paginated endpoints. page is the requested page, used as the total number
+// of pages if the Link header has no 'last' link.
+func parsePagination(header http.Header, page uint) pagination {
+	p := pagination{totalPages: page}
+
+	// Result count should be given in X-Total-Count header.
+	if count := header.Get("X-Total-Count"); count != "" {
+		p.totalCount, _ = strconv.Atoi(count)
+	}
+
+	// Parse Link header from response to get total pages
+	links := linkheader.Parse(header.Get("Link"))
+
+	// Header should only contain one 'last' link
+	if l := links.FilterByRel("last"); len(l) == 1 {
+		if lastPage, ok := linkPage(l[0].URL); ok {
+			p.totalPages = lastPage
+		}
+	}
+
+	// Header may contain one 'next' link
+	if n := links.FilterByRel("next"); len(n) == 1 {
+		if nextPage, ok := linkPage(n[0].URL); ok {
+			p.nextPage = nextPage
+		}
+	}
+
+	return p
+}
+
+// linkPage returns the ?page=X query param of a link.
+func linkPage(link string) (uint, bool) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return 0, false
+	}
+	page, err := strconv.Atoi(u.Query().Get("page"))
+	if err != nil || page < 0 {
+		return 0, false
+	}
+	return uint(page), true
+}
@@ -1,8 +1,6 @@
 package endpoints
 
 import (
-	"fmt"
-	"io"
 	"net/http"
 )
 
@@ -26,11 +24,7 @@ func (c *Client) Reauthenticate() error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		fullBody, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("response status code %d", resp.StatusCode)
-		}
-		return fmt.Errorf("response status code %d: %s", resp.StatusCode, fullBody)
+		return responseError(resp)
 	}
 
 	return nil
@@ -1,8 +1,11 @@
 package endpoints
 
 import (
+	"encoding/json"
 	"io"
 	"net/http"
+
+	"github.com/supabase-community/auth-go/types"
 )
 
 func (c *Client) newRequest(path string, method string, body io.Reader) (*http.Request, error) {
@@ -21,3 +24,20 @@ func (c *Client) newRequest(path string, method string, body io.Reader) (*http.R
 
 	return req, nil
 }
+
+// responseError returns a *types.APIError for a response with an unexpected
+// status code.
+func responseError(resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &types.APIError{StatusCode: resp.StatusCode}
+	}
+	apiErr := &types.APIError{StatusCode: resp.StatusCode, Body: body}
+	var decoded struct {
+		ErrorCode string `json:"error_code"`
+	}
+	if json.Unmarshal(body, &decoded) == nil {
+		apiErr.ErrorCode = decoded.ErrorCode
+	}
+	return apiErr
+}
@@ -0,0 +1,249 @@
+package gdpr
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/types"
+)
+
+var (
+	ErrInvalidSignature = errors.New("erasure evidence signature is invalid")
+	ErrNotErased        = errors.New("user still exists after erasure")
+)
+
+// StepName is a step of an erasure.
+type StepName string
+
+const (
+	StepExport       StepName = "export"
+	StepListFactors  StepName = "list_factors"
+	StepRevokeFactor StepName = "revoke_factor"
+	StepDelete       StepName = "delete"
+	StepSoftDelete   StepName = "soft_delete"
+	// StepVerify checks that the user is gone, or soft deleted.
+	StepVerify StepName = "verify"
+)
+
+type StepStatus string
+
+const (
+	StepOK     StepStatus = "ok"
+	StepFailed StepStatus = "failed"
+)
+
+// Step is a record of one step of an erasure.
+type Step struct {
+	Name   StepName   `json:"name"`
+	At     time.Time  `json:"at"`
+	Status StepStatus `json:"status"`
+	// Subject is what the step acted on, e.g. the factor ID or the digest of
+	// the export archive.
+	Subject string `json:"subject,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Evidence records what an erasure did. It holds no personal data besides
+// the user ID, so it can be kept after the user is gone.
+type Evidence struct {
+	UserID     uuid.UUID `json:"user_id"`
+	Reason     string    `json:"reason,omitempty"`
+	Actor      string    `json:"actor,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Steps      []Step    `json:"steps"`
+	// Completed is true if every step succeeded.
+	Completed bool `json:"completed"`
+
+	// Signature is an Ed25519 signature over the evidence without the
+	// signature.
+	Signature []byte `json:"signature"`
+}
+
+func (e *Evidence) signedBytes() ([]byte, error) {
+	unsigned := *e
+	unsigned.Signature = nil
+	return json.Marshal(unsigned)
+}
+
+// Verify checks the signature of the evidence.
+func (e *Evidence) Verify(key ed25519.PublicKey) error {
+	data, err := e.signedBytes()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, data, e.Signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+type EraseRequest struct {
+	UserID uuid.UUID
+
+	// Export, if set, receives an export archive of the user before anything
+	// is erased. Nothing is erased if the export fails.
+	Export io.Writer
+	// SoftDelete soft deletes the user instead of deleting them.
+	SoftDelete bool
+
+	Reason string
+	Actor  string
+}
+
+// Eraser erases users and signs evidence of each erasure.
+type Eraser struct {
+	client   auth.Client
+	key      ed25519.PrivateKey
+	exporter *Exporter
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// NewEraser returns an Eraser that signs evidence with key. The client must
+// have an admin token set.
+func NewEraser(client auth.Client, key ed25519.PrivateKey) *Eraser {
+	er := &Eraser{
+		client:   client,
+		key:      key,
+		exporter: NewExporter(client),
+	}
+	er.exporter.Now = er.now
+	return er
+}
+
+// Erase exports the user if requested, revokes their MFA factors and deletes
+// them, then checks that they are gone. It stops at the first failed step.
+// The signed evidence is returned even if a step failed, along with the
+// error.
+func (er *Eraser) Erase(req EraseRequest) (*Evidence, error) {
+	ev := &Evidence{
+		UserID:    req.UserID,
+		Reason:    req.Reason,
+		Actor:     req.Actor,
+		StartedAt: er.now(),
+		Steps:     []Step{},
+	}
+	err := er.erase(req, ev)
+	ev.Completed = err == nil
+	ev.FinishedAt = er.now()
+
+	data, signErr := ev.signedBytes()
+	if signErr != nil {
+		return nil, signErr
+	}
+	ev.Signature = ed25519.Sign(er.key, data)
+	return ev, err
+}
+
+func (er *Eraser) erase(req EraseRequest, ev *Evidence) error {
+	step := func(name StepName, subject string, fn func() (string, error)) error {
+		s := Step{Name: name, Subject: subject}
+		result, err := fn()
+		s.At = er.now()
+		if result != "" {
+			s.Subject = result
+		}
+		if err != nil {
+			s.Status = StepFailed
+			s.Error = err.Error()
+			ev.Steps = append(ev.Steps, s)
+			return fmt.Errorf("erasing user %s: %s: %w", req.UserID, name, err)
+		}
+		s.Status = StepOK
+		ev.Steps = append(ev.Steps, s)
+		return nil
+	}
+
+	if req.Export != nil {
+		err := step(StepExport, "", func() (string, error) {
+			m, err := er.exporter.Export(req.UserID, req.Export)
+			if err != nil {
+				return "", err
+			}
+			return "sha256:" + m.ArchiveSHA256, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	var factors []types.Factor
+	err := step(StepListFactors, "", func() (string, error) {
+		resp, err := er.client.AdminListUserFactors(types.AdminListUserFactorsRequest{UserID: req.UserID})
+		if err != nil {
+			return "", err
+		}
+		factors = resp.Factors
+		return "", nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, f := range factors {
+		f := f
+		err := step(StepRevokeFactor, f.ID.String(), func() (string, error) {
+			return "", er.client.AdminDeleteUserFactor(types.AdminDeleteUserFactorRequest{UserID: req.UserID, FactorID: f.ID})
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	name := StepDelete
+	if req.SoftDelete {
+		name = StepSoftDelete
+	}
+	err = step(name, "", func() (string, error) {
+		return "", er.client.AdminDeleteUser(types.AdminDeleteUserRequest{UserID: req.UserID, ShouldSoftDelete: req.SoftDelete})
+	})
+	if err != nil {
+		return err
+	}
+
+	return step(StepVerify, "", func() (string, error) {
+		resp, err := er.client.AdminGetUser(types.AdminGetUserRequest{UserID: req.UserID})
+		if err != nil {
+			var apiErr *types.APIError
+			if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusNotFound || apiErr.ErrorCode == "user_not_found") {
+				return "", nil
+			}
+			return "", err
+		}
+		if req.SoftDelete && softDeleted(&resp.User) {
+			return "", nil
+		}
+		return "", ErrNotErased
+	})
+}
+
+// softDeleted reports whether the user was soft deleted. Auth replaces the
+// email and phone of a soft deleted user with hashes, so they are not
+// checked; its metadata and identity data must be gone.
+func softDeleted(u *types.User) bool {
+	if u.DeletedAt == nil || len(u.UserMetadata) > 0 || len(u.AppMetadata) > 0 {
+		return false
+	}
+	for _, id := range u.Identities {
+		if len(id.IdentityData) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (er *Eraser) now() time.Time {
+	if er.Now != nil {
+		return er.Now().UTC()
+	}
+	return time.Now().UTC()
+}
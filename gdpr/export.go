@@ -0,0 +1,189 @@
+// Package gdpr handles data subject requests: exporting everything Auth
+// holds about a user into an archive, and erasing a user with signed
+// evidence of each step.
+package gdpr
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/audit"
+	"github.com/supabase-community/auth-go/types"
+)
+
+// The files in an export archive.
+const (
+	FileUser       = "user.json"
+	FileIdentities = "identities.json"
+	FileFactors    = "factors.json"
+	FileAudit      = "audit.jsonl"
+	FileTimeline   = "timeline.txt"
+	FileManifest   = "manifest.json"
+)
+
+// ManifestFile is a file in an export archive.
+type ManifestFile struct {
+	Name   string `json:"name"`
+	Bytes  int    `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest describes an export archive, and is saved in it as
+// manifest.json.
+type Manifest struct {
+	UserID     uuid.UUID `json:"user_id"`
+	ExportedAt time.Time `json:"exported_at"`
+	// Files are the files in the archive. The copy saved in the archive
+	// leaves out manifest.json itself.
+	Files []ManifestFile `json:"files"`
+	// AuditEntries is the number of audit log entries in audit.jsonl.
+	AuditEntries int `json:"audit_entries"`
+
+	// ArchiveSHA256 is the digest of the whole archive. It is only set on
+	// the Manifest returned by Export, as the archive cannot contain its own
+	// digest.
+	ArchiveSHA256 string `json:"archive_sha256,omitempty"`
+	ArchiveBytes  int    `json:"archive_bytes,omitempty"`
+}
+
+// Exporter exports everything Auth holds about a user.
+type Exporter struct {
+	client auth.Client
+
+	// PerPage is the page size used to scan the audit log. Defaults to 100.
+	PerPage uint
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// NewExporter returns an Exporter. The client must have an admin token set.
+func NewExporter(client auth.Client) *Exporter {
+	return &Exporter{
+		client:  client,
+		PerPage: 100,
+	}
+}
+
+// Export writes a zip archive with the user, their identities and factors,
+// the audit log entries about them and a readable timeline to w.
+//
+// The audit log is scanned back to when the user was created, so this makes
+// a request per page of the audit log since then.
+func (e *Exporter) Export(userID uuid.UUID, w io.Writer) (*Manifest, error) {
+	builder := audit.NewTimelineBuilder(e.client)
+	builder.PerPage = e.PerPage
+	timeline, err := builder.Build(userID)
+	if err != nil {
+		return nil, err
+	}
+	factors, err := e.client.AdminListUserFactors(types.AdminListUserFactorsRequest{UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []types.AuditLogEntry
+	for _, ev := range timeline.Events {
+		if ev.Entry != nil {
+			entries = append(entries, *ev.Entry)
+		}
+	}
+
+	now := e.now().UTC()
+	m := &Manifest{
+		UserID:       userID,
+		ExportedAt:   now,
+		Files:        []ManifestFile{},
+		AuditEntries: len(entries),
+	}
+	digest := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(w, digest)}
+	zw := zip.NewWriter(counter)
+
+	add := func(name string, data []byte) error {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(data); err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		m.Files = append(m.Files, ManifestFile{Name: name, Bytes: len(data), SHA256: hex.EncodeToString(sum[:])})
+		return nil
+	}
+	addJSON := func(name string, v interface{}) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		return add(name, data)
+	}
+
+	identities := timeline.User.Identities
+	if identities == nil {
+		identities = []types.Identity{}
+	}
+	factorList := factors.Factors
+	if factorList == nil {
+		factorList = []types.Factor{}
+	}
+	var auditLines bytes.Buffer
+	enc := json.NewEncoder(&auditLines)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return nil, err
+		}
+	}
+	var text bytes.Buffer
+	if err := timeline.WriteText(&text); err != nil {
+		return nil, err
+	}
+
+	steps := []func() error{
+		func() error { return addJSON(FileUser, timeline.User) },
+		func() error { return addJSON(FileIdentities, identities) },
+		func() error { return addJSON(FileFactors, factorList) },
+		func() error { return add(FileAudit, auditLines.Bytes()) },
+		func() error { return add(FileTimeline, text.Bytes()) },
+		func() error { return addJSON(FileManifest, m) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return nil, fmt.Errorf("writing export archive: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("writing export archive: %w", err)
+	}
+
+	m.ArchiveSHA256 = hex.EncodeToString(digest.Sum(nil))
+	m.ArchiveBytes = counter.n
+	return m, nil
+}
+
+func (e *Exporter) now() time.Time {
+	if e.Now != nil {
+		return e.Now()
+	}
+	return time.Now()
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
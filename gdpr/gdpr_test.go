@@ -0,0 +1,170 @@
+package gdpr_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supabase-community/auth-go/authtest"
+	"github.com/supabase-community/auth-go/gdpr"
+	"github.com/supabase-community/auth-go/types"
+)
+
+func newUser(t *testing.T, srv *authtest.Server, email string) *types.User {
+	require := require.New(t)
+
+	password := "password"
+	created, err := srv.AdminClient().AdminCreateUser(types.AdminCreateUserRequest{
+		Email:        email,
+		Password:     &password,
+		EmailConfirm: true,
+		UserMetadata: map[string]interface{}{"name": "Ada"},
+	})
+	require.NoError(err)
+	token, err := srv.Client().SignInWithEmailPassword(email, password)
+	require.NoError(err)
+	_, err = srv.Client().WithToken(token.AccessToken).EnrollFactor(types.EnrollFactorRequest{
+		FactorType: types.FactorTypeTOTP,
+	})
+	require.NoError(err)
+	return &created.User
+}
+
+func TestExport(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := authtest.NewServer(authtest.DefaultConfig())
+	defer srv.Close()
+	user := newUser(t, srv, "ada@example.com")
+	newUser(t, srv, "other@example.com")
+
+	var buf bytes.Buffer
+	m, err := gdpr.NewExporter(srv.AdminClient()).Export(user.ID, &buf)
+	require.NoError(err)
+	assert.Equal(user.ID, m.UserID)
+	assert.Equal(buf.Len(), m.ArchiveBytes)
+	sum := sha256.Sum256(buf.Bytes())
+	assert.Equal(hex.EncodeToString(sum[:]), m.ArchiveSHA256)
+	assert.Greater(m.AuditEntries, 1)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(err)
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(err)
+		data, err := io.ReadAll(rc)
+		require.NoError(err)
+		rc.Close()
+		files[f.Name] = data
+	}
+	require.Len(files, 6)
+
+	var exported types.User
+	require.NoError(json.Unmarshal(files[gdpr.FileUser], &exported))
+	assert.Equal("ada@example.com", exported.Email)
+	var factors []types.Factor
+	require.NoError(json.Unmarshal(files[gdpr.FileFactors], &factors))
+	assert.Len(factors, 1)
+	assert.Equal(m.AuditEntries, bytes.Count(files[gdpr.FileAudit], []byte("\n")))
+	assert.NotContains(string(files[gdpr.FileAudit]), "other@example.com")
+	assert.Contains(string(files[gdpr.FileTimeline]), "ada@example.com")
+
+	var saved gdpr.Manifest
+	require.NoError(json.Unmarshal(files[gdpr.FileManifest], &saved))
+	require.Len(saved.Files, 5)
+	for _, f := range saved.Files {
+		sum := sha256.Sum256(files[f.Name])
+		assert.Equal(hex.EncodeToString(sum[:]), f.SHA256, f.Name)
+	}
+}
+
+func TestErase(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := authtest.NewServer(authtest.DefaultConfig())
+	defer srv.Close()
+	client := srv.AdminClient()
+	pub, key, err := ed25519.GenerateKey(nil)
+	require.NoError(err)
+	eraser := gdpr.NewEraser(client, key)
+
+	user := newUser(t, srv, "ada@example.com")
+	var archive bytes.Buffer
+	ev, err := eraser.Erase(gdpr.EraseRequest{UserID: user.ID, Export: &archive, Reason: "article 17 request", Actor: "dpo@example.com"})
+	require.NoError(err)
+	assert.True(ev.Completed)
+	assert.NotZero(archive.Len())
+	names := []gdpr.StepName{}
+	for _, s := range ev.Steps {
+		assert.Equal(gdpr.StepOK, s.Status)
+		names = append(names, s.Name)
+	}
+	assert.Equal([]gdpr.StepName{gdpr.StepExport, gdpr.StepListFactors, gdpr.StepRevokeFactor, gdpr.StepDelete, gdpr.StepVerify}, names)
+	sum := sha256.Sum256(archive.Bytes())
+	assert.Equal("sha256:"+hex.EncodeToString(sum[:]), ev.Steps[0].Subject)
+	_, err = client.AdminGetUser(types.AdminGetUserRequest{UserID: user.ID})
+	assert.ErrorContains(err, "404")
+
+	require.NoError(ev.Verify(pub))
+	tampered := *ev
+	tampered.Reason = "other"
+	assert.ErrorIs(tampered.Verify(pub), gdpr.ErrInvalidSignature)
+
+	// Evidence survives a round trip through JSON.
+	data, err := json.Marshal(ev)
+	require.NoError(err)
+	var decoded gdpr.Evidence
+	require.NoError(json.Unmarshal(data, &decoded))
+	assert.NoError(decoded.Verify(pub))
+
+	user = newUser(t, srv, "bob@example.com")
+	ev, err = eraser.Erase(gdpr.EraseRequest{UserID: user.ID, SoftDelete: true})
+	require.NoError(err)
+	assert.Equal(gdpr.StepSoftDelete, ev.Steps[2].Name)
+	got, err := client.AdminGetUser(types.AdminGetUserRequest{UserID: user.ID})
+	require.NoError(err)
+	assert.NotNil(got.DeletedAt)
+	// Auth obfuscates the email of soft deleted users rather than clearing it.
+	assert.NotEmpty(got.Email)
+	assert.NotContains(got.Email, "bob")
+	assert.Empty(got.UserMetadata)
+	assert.Empty(got.Factors)
+
+	// A failed step stops the erasure, and the evidence records it.
+	ev, err = eraser.Erase(gdpr.EraseRequest{UserID: user.ID, Export: failingWriter{}})
+	assert.Error(err)
+	require.NotNil(ev)
+	assert.False(ev.Completed)
+	require.Len(ev.Steps, 1)
+	assert.Equal(gdpr.StepFailed, ev.Steps[0].Status)
+	assert.NoError(ev.Verify(pub))
+	_, err = client.AdminGetUser(types.AdminGetUserRequest{UserID: user.ID})
+	assert.NoError(err)
+
+	// So does failing to list the factors.
+	ev, err = eraser.Erase(gdpr.EraseRequest{UserID: uuid.New()})
+	assert.Error(err)
+	require.NotNil(ev)
+	require.Len(ev.Steps, 1)
+	assert.Equal(gdpr.StepListFactors, ev.Steps[0].Name)
+	assert.Equal(gdpr.StepFailed, ev.Steps[0].Status)
+	assert.NoError(ev.Verify(pub))
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
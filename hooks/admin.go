@@ -0,0 +1,134 @@
+package hooks
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/types"
+)
+
+var ErrLockoutAdminNoClient = errors.New("lockout admin has no client - a client with an admin token is required to unban users")
+
+type LockoutStatus struct {
+	Kind     AttemptKind `json:"kind"`
+	FactorID uuid.UUID   `json:"factor_id,omitempty"`
+
+	Failures    int        `json:"failures"`
+	Lockouts    int        `json:"lockouts"`
+	LastFailure *time.Time `json:"last_failure,omitempty"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+	Locked      bool       `json:"locked"`
+}
+
+type ResetLockoutRequest struct {
+	UserID uuid.UUID
+
+	// Kind, if set, only resets password or MFA lockouts. FactorID, if set,
+	// only resets the MFA lockout for that factor.
+	Kind     AttemptKind
+	FactorID uuid.UUID
+
+	// Unban also lifts the user's ban with AdminUpdateUser. Use it when a
+	// lockout was escalated to a ban on the Auth server.
+	Unban bool
+}
+
+// LockoutAdmin lets admins inspect and reset the lockout state kept by the
+// verification attempt hooks.
+type LockoutAdmin struct {
+	store  AttemptStore
+	client auth.Client
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// NewLockoutAdmin returns a LockoutAdmin over the store used by the hooks.
+//
+// client is only used to unban users, and may be nil otherwise. It must have
+// an admin token set.
+func NewLockoutAdmin(store AttemptStore, client auth.Client) *LockoutAdmin {
+	return &LockoutAdmin{
+		store:  store,
+		client: client,
+	}
+}
+
+// Status returns the lockout state of every password and MFA factor tracked
+// for the user. Password state is listed first, followed by factors in ID
+// order.
+func (a *LockoutAdmin) Status(userID uuid.UUID) ([]LockoutStatus, error) {
+	records, err := a.store.List(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Key.Kind != records[j].Key.Kind {
+			return records[i].Key.Kind == AttemptKindPassword
+		}
+		return records[i].Key.FactorID.String() < records[j].Key.FactorID.String()
+	})
+
+	at := now(a.Now)
+	statuses := make([]LockoutStatus, 0, len(records))
+	for _, r := range records {
+		s := LockoutStatus{
+			Kind:     r.Key.Kind,
+			FactorID: r.Key.FactorID,
+			Failures: r.State.Failures,
+			Lockouts: r.State.Lockouts,
+			Locked:   r.State.Locked(at),
+		}
+		if !r.State.LastFailure.IsZero() {
+			t := r.State.LastFailure
+			s.LastFailure = &t
+		}
+		if !r.State.LockedUntil.IsZero() {
+			t := r.State.LockedUntil
+			s.LockedUntil = &t
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+// Reset clears failed attempts and lockouts for the user.
+func (a *LockoutAdmin) Reset(req ResetLockoutRequest) error {
+	if req.Unban && a.client == nil {
+		return ErrLockoutAdminNoClient
+	}
+
+	records, err := a.store.List(req.UserID)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if req.Kind != "" && r.Key.Kind != req.Kind {
+			continue
+		}
+		if req.FactorID != uuid.Nil && r.Key.FactorID != req.FactorID {
+			continue
+		}
+		if err := a.store.Delete(r.Key); err != nil {
+			return err
+		}
+	}
+
+	if req.Unban {
+		none := types.BanDurationNone()
+		_, err := a.client.AdminUpdateUser(types.AdminUpdateUserRequest{
+			UserID:      req.UserID,
+			BanDuration: &none,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package hooks
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/supabase-community/auth-go/types"
+)
+
+const defaultLockoutMessage = "Too many failed attempts. Please try again later."
+
+var (
+	_ http.Handler = &PasswordVerificationAttemptHook{}
+	_ http.Handler = &MFAVerificationAttemptHook{}
+)
+
+// PasswordVerificationAttemptHook implements the password verification
+// attempt hook. Failed attempts are counted per user, and once the lockout
+// policy is triggered, every attempt is rejected until the lockout expires.
+//
+// It can be called directly with Handle, or served as an HTTP hook.
+type PasswordVerificationAttemptHook struct {
+	Store  AttemptStore
+	Policy LockoutPolicy
+
+	// Message is returned to the user when an attempt is rejected.
+	Message string
+	// LogoutOnLockout asks Auth to sign the user out of all sessions when an
+	// attempt is rejected.
+	LogoutOnLockout bool
+	// Secret, if set, is used to verify the signature of HTTP hook requests.
+	Secret string
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+func NewPasswordVerificationAttemptHook(store AttemptStore, policy LockoutPolicy) *PasswordVerificationAttemptHook {
+	return &PasswordVerificationAttemptHook{
+		Store:   store,
+		Policy:  policy,
+		Message: defaultLockoutMessage,
+	}
+}
+
+func (h *PasswordVerificationAttemptHook) Handle(in types.PasswordVerificationAttemptInput) (*types.PasswordVerificationAttemptOutput, error) {
+	key := AttemptKey{
+		Kind:   AttemptKindPassword,
+		UserID: in.UserID,
+	}
+	reject, err := record(h.Store, h.Policy, key, in.Valid, now(h.Now))
+	if err != nil {
+		return nil, err
+	}
+	if !reject {
+		return &types.PasswordVerificationAttemptOutput{
+			Decision: types.HookDecisionContinue,
+		}, nil
+	}
+	return &types.PasswordVerificationAttemptOutput{
+		Decision:         types.HookDecisionReject,
+		Message:          h.Message,
+		ShouldLogoutUser: h.LogoutOnLockout,
+	}, nil
+}
+
+func (h *PasswordVerificationAttemptHook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var in types.PasswordVerificationAttemptInput
+	serveHook(w, r, h.Secret, now(h.Now), &in, func() (interface{}, error) {
+		return h.Handle(in)
+	})
+}
+
+// MFAVerificationAttemptHook implements the MFA verification attempt hook.
+// Failed attempts are counted per user and factor, so a lockout on one factor
+// does not prevent the user from verifying with another.
+//
+// It can be called directly with Handle, or served as an HTTP hook.
+type MFAVerificationAttemptHook struct {
+	Store  AttemptStore
+	Policy LockoutPolicy
+
+	// Message is returned to the user when an attempt is rejected.
+	Message string
+	// Secret, if set, is used to verify the signature of HTTP hook requests.
+	Secret string
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+func NewMFAVerificationAttemptHook(store AttemptStore, policy LockoutPolicy) *MFAVerificationAttemptHook {
+	return &MFAVerificationAttemptHook{
+		Store:   store,
+		Policy:  policy,
+		Message: defaultLockoutMessage,
+	}
+}
+
+func (h *MFAVerificationAttemptHook) Handle(in types.MFAVerificationAttemptInput) (*types.MFAVerificationAttemptOutput, error) {
+	key := AttemptKey{
+		Kind:     AttemptKindMFA,
+		UserID:   in.UserID,
+		FactorID: in.FactorID,
+	}
+	reject, err := record(h.Store, h.Policy, key, in.Valid, now(h.Now))
+	if err != nil {
+		return nil, err
+	}
+	if !reject {
+		return &types.MFAVerificationAttemptOutput{
+			Decision: types.HookDecisionContinue,
+		}, nil
+	}
+	return &types.MFAVerificationAttemptOutput{
+		Decision: types.HookDecisionReject,
+		Message:  h.Message,
+	}, nil
+}
+
+func (h *MFAVerificationAttemptHook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var in types.MFAVerificationAttemptInput
+	serveHook(w, r, h.Secret, now(h.Now), &in, func() (interface{}, error) {
+		return h.Handle(in)
+	})
+}
+
+func record(store AttemptStore, policy LockoutPolicy, key AttemptKey, valid bool, at time.Time) (bool, error) {
+	var reject bool
+	_, err := store.Update(key, func(s *AttemptState) error {
+		reject = policy.apply(s, valid, at)
+		return nil
+	})
+	return reject, err
+}
+
+func now(fn func() time.Time) time.Time {
+	if fn == nil {
+		return time.Now()
+	}
+	return fn()
+}
@@ -0,0 +1,244 @@
+package hooks_test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/hooks"
+	"github.com/supabase-community/auth-go/types"
+)
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func TestPasswordVerificationAttemptHook(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c := &clock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := hooks.NewMemoryAttemptStore()
+	h := hooks.NewPasswordVerificationAttemptHook(store, hooks.LockoutPolicy{
+		MaxFailures: 3,
+		Windows:     []time.Duration{time.Minute, time.Hour},
+	})
+	h.Now = c.now
+	h.LogoutOnLockout = true
+
+	userID := uuid.New()
+	attempt := func(valid bool) *types.PasswordVerificationAttemptOutput {
+		out, err := h.Handle(types.PasswordVerificationAttemptInput{UserID: userID, Valid: valid})
+		require.NoError(err)
+		return out
+	}
+
+	// Two failures are allowed, the third locks the user out.
+	assert.Equal(types.HookDecisionContinue, attempt(false).Decision)
+	assert.Equal(types.HookDecisionContinue, attempt(false).Decision)
+	out := attempt(false)
+	assert.Equal(types.HookDecisionReject, out.Decision)
+	assert.True(out.ShouldLogoutUser)
+	assert.NotEmpty(out.Message)
+
+	// Valid credentials are rejected during the lockout.
+	assert.Equal(types.HookDecisionReject, attempt(true).Decision)
+
+	// After the first window, failures lock out for the second window.
+	c.t = c.t.Add(time.Minute)
+	for i := 0; i < 2; i++ {
+		assert.Equal(types.HookDecisionContinue, attempt(false).Decision)
+	}
+	assert.Equal(types.HookDecisionReject, attempt(false).Decision)
+	c.t = c.t.Add(59 * time.Minute)
+	assert.Equal(types.HookDecisionReject, attempt(true).Decision)
+	c.t = c.t.Add(time.Minute)
+
+	// A successful attempt resets the state.
+	assert.Equal(types.HookDecisionContinue, attempt(true).Decision)
+	state, err := store.Get(hooks.AttemptKey{Kind: hooks.AttemptKindPassword, UserID: userID})
+	require.NoError(err)
+	assert.Equal(hooks.AttemptState{}, state)
+}
+
+func TestLockoutPolicyResetAfter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c := &clock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	h := hooks.NewPasswordVerificationAttemptHook(hooks.NewMemoryAttemptStore(), hooks.LockoutPolicy{
+		MaxFailures: 2,
+		Windows:     []time.Duration{time.Minute},
+		ResetAfter:  time.Hour,
+	})
+	h.Now = c.now
+
+	in := types.PasswordVerificationAttemptInput{UserID: uuid.New()}
+	out, err := h.Handle(in)
+	require.NoError(err)
+	assert.Equal(types.HookDecisionContinue, out.Decision)
+
+	// The earlier failure is forgotten.
+	c.t = c.t.Add(time.Hour)
+	out, err = h.Handle(in)
+	require.NoError(err)
+	assert.Equal(types.HookDecisionContinue, out.Decision)
+
+	out, err = h.Handle(in)
+	require.NoError(err)
+	assert.Equal(types.HookDecisionReject, out.Decision)
+}
+
+func TestLockoutPolicyDefaultWindows(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	c := &clock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	h := hooks.NewPasswordVerificationAttemptHook(hooks.NewMemoryAttemptStore(), hooks.LockoutPolicy{MaxFailures: 1})
+	h.Now = c.now
+
+	in := types.PasswordVerificationAttemptInput{UserID: uuid.New()}
+	out, err := h.Handle(in)
+	require.NoError(err)
+	assert.Equal(types.HookDecisionReject, out.Decision)
+
+	// The first default window is a minute.
+	c.t = c.t.Add(59 * time.Second)
+	in.Valid = true
+	out, err = h.Handle(in)
+	require.NoError(err)
+	assert.Equal(types.HookDecisionReject, out.Decision)
+	c.t = c.t.Add(time.Second)
+	out, err = h.Handle(in)
+	require.NoError(err)
+	assert.Equal(types.HookDecisionContinue, out.Decision)
+}
+
+func TestMFAVerificationAttemptHookHTTP(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	key := []byte("super-secret-key")
+	secret := "v1,whsec_" + base64.StdEncoding.EncodeToString(key)
+
+	store := hooks.NewMemoryAttemptStore()
+	h := hooks.NewMFAVerificationAttemptHook(store, hooks.LockoutPolicy{
+		MaxFailures: 1,
+		Windows:     []time.Duration{time.Hour},
+	})
+	h.Secret = secret
+
+	send := func(in types.MFAVerificationAttemptInput, sign bool) *httptest.ResponseRecorder {
+		body, err := json.Marshal(in)
+		require.NoError(err)
+		r := httptest.NewRequest(http.MethodPost, "/hook", bytes.NewReader(body))
+		id := "msg_" + uuid.NewString()
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, key)
+		if !sign {
+			mac = hmac.New(sha256.New, []byte("wrong"))
+		}
+		fmt.Fprintf(mac, "%s.%s.%s", id, ts, body)
+		r.Header.Set("webhook-id", id)
+		r.Header.Set("webhook-timestamp", ts)
+		r.Header.Set("webhook-signature", "v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	userID := uuid.New()
+	factorA := uuid.New()
+	factorB := uuid.New()
+
+	// Invalid signature
+	w := send(types.MFAVerificationAttemptInput{UserID: userID, FactorID: factorA}, false)
+	assert.Equal(http.StatusUnauthorized, w.Code)
+	var hookErr types.HookErrorResponse
+	require.NoError(json.NewDecoder(w.Body).Decode(&hookErr))
+	assert.Equal(http.StatusUnauthorized, hookErr.Error.HTTPCode)
+
+	// Failure on factor A locks it out, factor B is unaffected.
+	w = send(types.MFAVerificationAttemptInput{UserID: userID, FactorID: factorA}, true)
+	require.Equal(http.StatusOK, w.Code)
+	var out types.MFAVerificationAttemptOutput
+	require.NoError(json.NewDecoder(w.Body).Decode(&out))
+	assert.Equal(types.HookDecisionReject, out.Decision)
+
+	w = send(types.MFAVerificationAttemptInput{UserID: userID, FactorID: factorB, Valid: true}, true)
+	require.Equal(http.StatusOK, w.Code)
+	require.NoError(json.NewDecoder(w.Body).Decode(&out))
+	assert.Equal(types.HookDecisionContinue, out.Decision)
+}
+
+func TestLockoutAdmin(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	userID := uuid.New()
+	factorID := uuid.New()
+
+	var unbanned bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Path == "/admin/users/"+userID.String() {
+			var body map[string]interface{}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			unbanned = body["ban_duration"] == "none"
+			_ = json.NewEncoder(w).Encode(types.User{ID: userID})
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	client := auth.New("", "").WithCustomAuthURL(server.URL)
+
+	store := hooks.NewMemoryAttemptStore()
+	policy := hooks.LockoutPolicy{MaxFailures: 1, Windows: []time.Duration{time.Hour}}
+	_, err := hooks.NewPasswordVerificationAttemptHook(store, policy).Handle(types.PasswordVerificationAttemptInput{UserID: userID})
+	require.NoError(err)
+	_, err = hooks.NewMFAVerificationAttemptHook(store, policy).Handle(types.MFAVerificationAttemptInput{UserID: userID, FactorID: factorID})
+	require.NoError(err)
+
+	admin := hooks.NewLockoutAdmin(store, client)
+	statuses, err := admin.Status(userID)
+	require.NoError(err)
+	require.Len(statuses, 2)
+	assert.Equal(hooks.AttemptKindPassword, statuses[0].Kind)
+	assert.True(statuses[0].Locked)
+	assert.Equal(hooks.AttemptKindMFA, statuses[1].Kind)
+	assert.Equal(factorID, statuses[1].FactorID)
+
+	// Reset only the MFA lockout.
+	require.NoError(admin.Reset(hooks.ResetLockoutRequest{UserID: userID, Kind: hooks.AttemptKindMFA}))
+	statuses, err = admin.Status(userID)
+	require.NoError(err)
+	require.Len(statuses, 1)
+	assert.Equal(hooks.AttemptKindPassword, statuses[0].Kind)
+
+	// Reset everything and lift the ban.
+	require.NoError(admin.Reset(hooks.ResetLockoutRequest{UserID: userID, Unban: true}))
+	statuses, err = admin.Status(userID)
+	require.NoError(err)
+	assert.Empty(statuses)
+	assert.True(unbanned)
+
+	err = hooks.NewLockoutAdmin(store, nil).Reset(hooks.ResetLockoutRequest{UserID: userID, Unban: true})
+	assert.ErrorIs(err, hooks.ErrLockoutAdminNoClient)
+}
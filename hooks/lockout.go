@@ -0,0 +1,73 @@
+package hooks
+
+import (
+	"time"
+)
+
+type LockoutPolicy struct {
+	// MaxFailures is the number of consecutive failed attempts that triggers
+	// a lockout.
+	MaxFailures int
+	// Windows are the lockout durations for the first, second, third (and so
+	// on) lockout. The last window is reused once they have all been applied.
+	// If empty, the windows of DefaultLockoutPolicy are used.
+	Windows []time.Duration
+	// ResetAfter forgets failures and previous lockouts once no failed attempt
+	// has been seen for this long. Zero means state is only reset by a
+	// successful attempt.
+	ResetAfter time.Duration
+}
+
+// DefaultLockoutPolicy locks out after 5 consecutive failures, for 1 minute,
+// then 5 minutes, 15 minutes and 1 hour for every lockout after that.
+func DefaultLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		MaxFailures: 5,
+		Windows: []time.Duration{
+			time.Minute,
+			5 * time.Minute,
+			15 * time.Minute,
+			time.Hour,
+		},
+		ResetAfter: 24 * time.Hour,
+	}
+}
+
+func (p LockoutPolicy) window(lockouts int) time.Duration {
+	if len(p.Windows) == 0 {
+		return DefaultLockoutPolicy().window(lockouts)
+	}
+	if lockouts >= len(p.Windows) {
+		return p.Windows[len(p.Windows)-1]
+	}
+	return p.Windows[lockouts]
+}
+
+// apply records an attempt against the state, and returns whether the
+// attempt must be rejected.
+func (p LockoutPolicy) apply(s *AttemptState, valid bool, now time.Time) bool {
+	if !s.Locked(now) && p.ResetAfter > 0 && !s.LastFailure.IsZero() && now.Sub(s.LastFailure) >= p.ResetAfter {
+		*s = AttemptState{}
+	}
+
+	// Attempts made while locked out are rejected, even with the right
+	// credentials, and don't extend the lockout.
+	if s.Locked(now) {
+		return true
+	}
+
+	if valid {
+		*s = AttemptState{}
+		return false
+	}
+
+	s.Failures++
+	s.LastFailure = now
+	if p.MaxFailures > 0 && s.Failures >= p.MaxFailures {
+		s.LockedUntil = now.Add(p.window(s.Lockouts))
+		s.Lockouts++
+		s.Failures = 0
+		return s.Locked(now)
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package hooks
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AttemptKind string
+
+const (
+	AttemptKindPassword AttemptKind = "password"
+	AttemptKindMFA      AttemptKind = "mfa"
+)
+
+// AttemptKey identifies the subject that failed attempts are counted against.
+// Password attempts are tracked per user, MFA attempts per user and factor.
+type AttemptKey struct {
+	Kind     AttemptKind
+	UserID   uuid.UUID
+	FactorID uuid.UUID
+}
+
+type AttemptState struct {
+	// Consecutive failed attempts since the last success or lockout.
+	Failures int
+	// Number of lockouts applied so far, used to pick the next lockout window.
+	Lockouts    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Locked reports whether the state is locked out at the given time.
+func (s AttemptState) Locked(now time.Time) bool {
+	return now.Before(s.LockedUntil)
+}
+
+func (s AttemptState) isZero() bool {
+	return s == AttemptState{}
+}
+
+type AttemptRecord struct {
+	Key   AttemptKey
+	State AttemptState
+}
+
+// AttemptStore persists attempt state. Implementations must be safe for
+// concurrent use, as Auth may call a hook for the same user concurrently.
+type AttemptStore interface {
+	// Update atomically applies fn to the state stored for key and returns the
+	// new state. A zero state is passed to fn if nothing is stored. If fn
+	// returns an error, the stored state must be left unchanged.
+	Update(key AttemptKey, fn func(*AttemptState) error) (AttemptState, error)
+	// Get returns the state stored for key, or a zero state if there is none.
+	Get(key AttemptKey) (AttemptState, error)
+	// Delete removes the state stored for key. Deleting a missing key is not
+	// an error.
+	Delete(key AttemptKey) error
+	// List returns every record stored for the user.
+	List(userID uuid.UUID) ([]AttemptRecord, error)
+}
+
+var _ AttemptStore = &MemoryAttemptStore{}
+
+// MemoryAttemptStore is an AttemptStore that keeps state in memory. State is
+// lost on restart and is not shared between processes, so it is only suitable
+// for a single hook server.
+type MemoryAttemptStore struct {
+	mu     sync.Mutex
+	states map[AttemptKey]AttemptState
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{
+		states: make(map[AttemptKey]AttemptState),
+	}
+}
+
+func (m *MemoryAttemptStore) Update(key AttemptKey, fn func(*AttemptState) error) (AttemptState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state := m.states[key]
+	if err := fn(&state); err != nil {
+		return m.states[key], err
+	}
+	if state.isZero() {
+		delete(m.states, key)
+	} else {
+		m.states[key] = state
+	}
+	return state, nil
+}
+
+func (m *MemoryAttemptStore) Get(key AttemptKey) (AttemptState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.states[key], nil
+}
+
+func (m *MemoryAttemptStore) Delete(key AttemptKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.states, key)
+	return nil
+}
+
+func (m *MemoryAttemptStore) List(userID uuid.UUID) ([]AttemptRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var records []AttemptRecord
+	for k, s := range m.states {
+		if k.UserID == userID {
+			records = append(records, AttemptRecord{Key: k, State: s})
+		}
+	}
+	return records, nil
+}
@@ -0,0 +1,138 @@
+package hooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/supabase-community/auth-go/types"
+)
+
+// Auth signs HTTP hook requests using the Standard Webhooks scheme. Requests
+// older than this are rejected to prevent replays.
+const webhookTolerance = 5 * time.Minute
+
+var ErrInvalidWebhookSignature = errors.New("webhook signature is invalid")
+
+// VerifyWebhook checks the Standard Webhooks signature headers that Auth sends
+// with HTTP hooks, and returns the request body if the signature is valid.
+//
+// secret is the hook secret shown in the Supabase dashboard, in the form
+// v1,whsec_<base64>.
+func VerifyWebhook(secret string, r *http.Request, now time.Time) ([]byte, error) {
+	key, err := decodeWebhookSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	id := r.Header.Get("webhook-id")
+	ts := r.Header.Get("webhook-timestamp")
+	sigs := r.Header.Get("webhook-signature")
+	if id == "" || ts == "" || sigs == "" {
+		return nil, ErrInvalidWebhookSignature
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidWebhookSignature
+	}
+	sent := time.Unix(unix, 0)
+	if now.Sub(sent) > webhookTolerance || sent.Sub(now) > webhookTolerance {
+		return nil, ErrInvalidWebhookSignature
+	}
+
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s.%s.%s", id, ts, body)
+	expected := mac.Sum(nil)
+
+	// The header may hold several space separated signatures, e.g. during
+	// secret rotation.
+	for _, s := range strings.Split(sigs, " ") {
+		version, sig, ok := strings.Cut(s, ",")
+		if !ok || version != "v1" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(sig)
+		if err != nil {
+			continue
+		}
+		if hmac.Equal(decoded, expected) {
+			return body, nil
+		}
+	}
+
+	return nil, ErrInvalidWebhookSignature
+}
+
+func decodeWebhookSecret(secret string) ([]byte, error) {
+	s := strings.TrimPrefix(secret, "v1,")
+	s = strings.TrimPrefix(s, "whsec_")
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook secret: %w", err)
+	}
+	return key, nil
+}
+
+// serveHook decodes the hook payload into in, calls handle and writes its
+// result, or a hook error response that Auth understands.
+func serveHook(w http.ResponseWriter, r *http.Request, secret string, now time.Time, in interface{}, handle func() (interface{}, error)) {
+	if r.Method != http.MethodPost {
+		writeHookError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var body []byte
+	var err error
+	if secret != "" {
+		body, err = VerifyWebhook(secret, r, now)
+		if err != nil {
+			writeHookError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+	} else {
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			writeHookError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if err := json.Unmarshal(body, in); err != nil {
+		writeHookError(w, http.StatusBadRequest, "invalid hook payload")
+		return
+	}
+
+	out, err := handle()
+	if err != nil {
+		writeHookError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func writeHookError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(types.HookErrorResponse{
+		Error: types.HookError{
+			HTTPCode: code,
+			Message:  message,
+		},
+	})
+}
@@ -0,0 +1,23 @@
+// Package normalize puts emails and phone numbers in the form Auth stores
+// them in, so that values typed differently can be compared.
+package normalize
+
+import "strings"
+
+// Email returns email lower cased, without surrounding space.
+func Email(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Phone returns the digits of phone. Auth stores phone numbers as digits
+// only, so formatting such as spaces, dashes, brackets and a leading + is
+// dropped.
+func Phone(phone string) string {
+	var b strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
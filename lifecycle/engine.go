@@ -0,0 +1,246 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/bans"
+	"github.com/supabase-community/auth-go/internal/ratelimit"
+	"github.com/supabase-community/auth-go/types"
+)
+
+var ErrUnknownAction = errors.New("unknown lifecycle action")
+
+// Status is what happened to an entry of a Report.
+type Status string
+
+const (
+	StatusPlanned Status = "planned"
+	StatusDone    Status = "done"
+	StatusFailed  Status = "failed"
+	// StatusSkipped is an entry over its rule's Limit.
+	StatusSkipped Status = "skipped"
+)
+
+// Entry is a user that a rule matched.
+type Entry struct {
+	UserID uuid.UUID `json:"user_id"`
+	Email  string    `json:"email,omitempty"`
+	Phone  string    `json:"phone,omitempty"`
+	Rule   string    `json:"rule"`
+	Action Action    `json:"action"`
+	Status Status    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Report lists the users a policy affects. Plan returns it with entries
+// planned or skipped, and Apply fills in the outcome of each one.
+type Report struct {
+	At time.Time `json:"at"`
+	// Users is the number of users evaluated.
+	Users   int     `json:"users"`
+	Entries []Entry `json:"entries"`
+}
+
+// Count returns the number of entries with the status.
+func (r *Report) Count(status Status) int {
+	n := 0
+	for _, e := range r.Entries {
+		if e.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteText writes the report for review, one line per entry.
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	for _, e := range r.Entries {
+		fmt.Fprintf(&b, "%-8s %-20s %s %s", e.Status, e.Action, e.UserID, contact(e))
+		if e.Rule != "" {
+			fmt.Fprintf(&b, " (%s)", e.Rule)
+		}
+		if e.Error != "" {
+			fmt.Fprintf(&b, ": %s", e.Error)
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "%d users evaluated, %d planned, %d done, %d failed, %d skipped\n",
+		r.Users, r.Count(StatusPlanned), r.Count(StatusDone), r.Count(StatusFailed), r.Count(StatusSkipped))
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func contact(e Entry) string {
+	if e.Email != "" {
+		return e.Email
+	}
+	return e.Phone
+}
+
+// Engine evaluates a Policy against every user and acts on the matches.
+type Engine struct {
+	client auth.Client
+	policy Policy
+	bans   *bans.Manager
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+	// PerPage is the page size used to list users. Defaults to 100.
+	PerPage int
+	// RateLimit is the most actions per second. Zero means no limit.
+	RateLimit float64
+	// BanDuration is how long ActionBan bans users. Defaults to
+	// bans.Indefinitely.
+	BanDuration time.Duration
+	// Actor is recorded as the actor of bans. Defaults to "lifecycle".
+	Actor string
+	// EmailRedirectTo is passed to Resend for confirmation emails.
+	EmailRedirectTo string
+}
+
+// NewEngine returns an Engine for the policy. The client must have an admin
+// token set.
+func NewEngine(client auth.Client, policy Policy) *Engine {
+	e := &Engine{
+		client:  client,
+		policy:  policy,
+		bans:    bans.NewManager(client, nil),
+		PerPage: 100,
+		Actor:   "lifecycle",
+	}
+	e.bans.Now = e.now
+	return e
+}
+
+// Plan evaluates the policy without changing anything, as a dry run.
+func (e *Engine) Plan(ctx context.Context) (*Report, error) {
+	for _, r := range e.policy.Rules {
+		switch r.Action {
+		case ActionResendConfirmation, ActionBan, ActionDelete, ActionSoftDelete:
+		default:
+			return nil, fmt.Errorf("%w %q in rule %q", ErrUnknownAction, r.Action, r.Name)
+		}
+	}
+
+	now := e.now()
+	report := &Report{At: now}
+	matched := make([]int, len(e.policy.Rules))
+	err := auth.NewAdminUsersPaginator(e.client, e.PerPage).Walk(func(u types.User) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		report.Users++
+		for i := range e.policy.Rules {
+			r := &e.policy.Rules[i]
+			if !r.Matches(&u, now) {
+				continue
+			}
+			status := StatusPlanned
+			matched[i]++
+			if r.Limit > 0 && matched[i] > r.Limit {
+				status = StatusSkipped
+			}
+			report.Entries = append(report.Entries, Entry{
+				UserID: u.ID,
+				Email:  u.Email,
+				Phone:  u.Phone,
+				Rule:   r.Name,
+				Action: r.Action,
+				Status: status,
+			})
+			break
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Apply acts on the planned entries of a report from Plan and returns a
+// report with the outcome of each. A failed entry does not stop the others;
+// only ctx being done does.
+func (e *Engine) Apply(ctx context.Context, plan *Report) (*Report, error) {
+	limiter := ratelimit.New(e.RateLimit)
+	report := &Report{At: e.now(), Users: plan.Users}
+	for i, entry := range plan.Entries {
+		if entry.Status != StatusPlanned {
+			report.Entries = append(report.Entries, entry)
+			continue
+		}
+		if err := limiter.Wait(ctx); err != nil {
+			report.Entries = append(report.Entries, plan.Entries[i:]...)
+			return report, err
+		}
+		if err := e.act(entry); err != nil {
+			entry.Status = StatusFailed
+			entry.Error = err.Error()
+		} else {
+			entry.Status = StatusDone
+		}
+		report.Entries = append(report.Entries, entry)
+	}
+	return report, nil
+}
+
+// Run plans the policy and applies it.
+func (e *Engine) Run(ctx context.Context) (*Report, error) {
+	plan, err := e.Plan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return e.Apply(ctx, plan)
+}
+
+func (e *Engine) act(entry Entry) error {
+	switch entry.Action {
+	case ActionResendConfirmation:
+		if entry.Email != "" {
+			return e.client.Resend(types.ResendRequest{
+				Type:            types.VerificationTypeSignup,
+				Email:           entry.Email,
+				EmailRedirectTo: e.EmailRedirectTo,
+			})
+		}
+		return e.client.Resend(types.ResendRequest{
+			Type:  types.VerificationTypeSMS,
+			Phone: entry.Phone,
+		})
+
+	case ActionBan:
+		_, err := e.bans.Ban(bans.BanRequest{
+			UserID:   entry.UserID,
+			Duration: e.BanDuration,
+			Reason:   "lifecycle rule " + entry.Rule,
+			Actor:    e.Actor,
+		})
+		return err
+
+	case ActionDelete, ActionSoftDelete:
+		return e.client.AdminDeleteUser(types.AdminDeleteUserRequest{
+			UserID:           entry.UserID,
+			ShouldSoftDelete: entry.Action == ActionSoftDelete,
+		})
+
+	default:
+		return fmt.Errorf("%w %q", ErrUnknownAction, entry.Action)
+	}
+}
+
+func (e *Engine) now() time.Time {
+	if e.Now != nil {
+		return e.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,182 @@
+package lifecycle_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supabase-community/auth-go/authtest"
+	"github.com/supabase-community/auth-go/lifecycle"
+	"github.com/supabase-community/auth-go/types"
+)
+
+func TestEngine(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	cfg := authtest.DefaultConfig()
+	cfg.Now = func() time.Time { return now }
+	srv := authtest.NewServer(cfg)
+	defer srv.Close()
+	client := srv.AdminClient()
+
+	create := func(at time.Time, req types.AdminCreateUserRequest) *types.User {
+		now = at
+		u, err := client.AdminCreateUser(req)
+		require.NoError(err)
+		return &u.User
+	}
+	today := start.Add(500 * 24 * time.Hour)
+	password := "password"
+
+	inactive := create(start, types.AdminCreateUserRequest{Email: "inactive@example.com", Password: &password, EmailConfirm: true})
+	_, err := srv.Client().SignInWithEmailPassword("inactive@example.com", password)
+	require.NoError(err)
+	create(start, types.AdminCreateUserRequest{Email: "active@example.com", Password: &password, EmailConfirm: true})
+	now = today.Add(-time.Hour)
+	_, err = srv.Client().SignInWithEmailPassword("active@example.com", password)
+	require.NoError(err)
+
+	stale1 := create(today.Add(-15*24*time.Hour), types.AdminCreateUserRequest{Email: "stale1@example.com"})
+	stale2 := create(today.Add(-20*24*time.Hour), types.AdminCreateUserRequest{Email: "stale2@example.com"})
+	create(today.Add(-3*24*time.Hour), types.AdminCreateUserRequest{Email: "reminded@example.com"})
+	remind := create(today.Add(-36*time.Hour), types.AdminCreateUserRequest{Email: "remind@example.com"})
+	remindPhone := create(today.Add(-30*time.Hour), types.AdminCreateUserRequest{Phone: "15550100"})
+	fresh := create(today.Add(-time.Hour), types.AdminCreateUserRequest{Email: "fresh@example.com"})
+	now = today
+
+	policy := lifecycle.DefaultPolicy()
+	policy.Rules[0].Limit = 1
+	engine := lifecycle.NewEngine(client, policy)
+	engine.Now = func() time.Time { return now }
+	engine.PerPage = 3
+
+	plan, err := engine.Plan(context.Background())
+	require.NoError(err)
+	assert.Equal(8, plan.Users)
+	actions := map[string]lifecycle.Status{}
+	for _, e := range plan.Entries {
+		actions[e.UserID.String()+" "+string(e.Action)] = e.Status
+	}
+	assert.Equal(map[string]lifecycle.Status{
+		inactive.ID.String() + " ban":                    lifecycle.StatusPlanned,
+		stale1.ID.String() + " delete":                   lifecycle.StatusPlanned,
+		stale2.ID.String() + " delete":                   lifecycle.StatusSkipped,
+		remind.ID.String() + " resend_confirmation":      lifecycle.StatusPlanned,
+		remindPhone.ID.String() + " resend_confirmation": lifecycle.StatusPlanned,
+	}, actions)
+
+	// The dry run changed nothing.
+	assert.Empty(srv.Messages())
+
+	var b strings.Builder
+	require.NoError(plan.WriteText(&b))
+	assert.Contains(b.String(), "8 users evaluated, 4 planned, 0 done, 0 failed, 1 skipped")
+
+	report, err := engine.Apply(context.Background(), plan)
+	require.NoError(err)
+	assert.Equal(4, report.Count(lifecycle.StatusDone))
+	assert.Equal(1, report.Count(lifecycle.StatusSkipped))
+
+	_, err = client.AdminGetUser(types.AdminGetUserRequest{UserID: stale1.ID})
+	assert.ErrorContains(err, "404")
+	got, err := client.AdminGetUser(types.AdminGetUserRequest{UserID: inactive.ID})
+	require.NoError(err)
+	require.NotNil(got.BannedUntil)
+	assert.Equal("lifecycle", got.AppMetadata["ban"].(map[string]interface{})["actor"])
+
+	_, ok := srv.LastMessage("remind@example.com")
+	assert.True(ok)
+	msg, ok := srv.LastMessage("15550100")
+	require.True(ok)
+	assert.Equal("sms", msg.Type)
+
+	// A day later, the earlier reminders are not sent again, the new user is
+	// reminded and the user over the limit is deleted.
+	now = now.Add(24 * time.Hour)
+	report, err = engine.Run(context.Background())
+	require.NoError(err)
+	assert.Equal(2, report.Count(lifecycle.StatusDone))
+	actions = map[string]lifecycle.Status{}
+	for _, e := range report.Entries {
+		actions[e.UserID.String()+" "+string(e.Action)] = e.Status
+	}
+	assert.Equal(map[string]lifecycle.Status{
+		stale2.ID.String() + " delete":             lifecycle.StatusDone,
+		fresh.ID.String() + " resend_confirmation": lifecycle.StatusDone,
+	}, actions)
+
+	_, err = lifecycle.NewEngine(client, lifecycle.Policy{Rules: []lifecycle.Rule{{Name: "x", Action: "archive"}}}).Plan(context.Background())
+	assert.ErrorIs(err, lifecycle.ErrUnknownAction)
+}
+
+func TestDefaultPolicySkipsAnonymousUsers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	cfg := authtest.DefaultConfig()
+	cfg.AnonymousUsers = true
+	cfg.Now = func() time.Time { return now }
+	srv := authtest.NewServer(cfg)
+	defer srv.Close()
+
+	_, err := srv.Client().Signup(types.SignupRequest{})
+	require.NoError(err)
+	users, err := srv.AdminClient().AdminListUsers(types.AdminListUsersRequest{})
+	require.NoError(err)
+	require.Len(users.Users, 1)
+	require.True(users.Users[0].IsAnonymous)
+
+	now = start.Add(30 * 24 * time.Hour)
+	engine := lifecycle.NewEngine(srv.AdminClient(), lifecycle.DefaultPolicy())
+	engine.Now = func() time.Time { return now }
+	report, err := engine.Run(context.Background())
+	require.NoError(err)
+	assert.Equal(1, report.Users)
+	assert.Empty(report.Entries)
+	assert.Empty(srv.Messages())
+}
+
+func TestSoftDeleteInactive(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	cfg := authtest.DefaultConfig()
+	cfg.Now = func() time.Time { return now }
+	srv := authtest.NewServer(cfg)
+	defer srv.Close()
+	client := srv.AdminClient()
+
+	u, err := client.AdminCreateUser(types.AdminCreateUserRequest{Email: "inactive@example.com", EmailConfirm: true})
+	require.NoError(err)
+
+	now = start.Add(400 * 24 * time.Hour)
+	engine := lifecycle.NewEngine(client, lifecycle.Policy{Rules: []lifecycle.Rule{{
+		Name:        "soft-delete-inactive",
+		Action:      lifecycle.ActionSoftDelete,
+		InactiveFor: 365 * 24 * time.Hour,
+	}}})
+	engine.Now = func() time.Time { return now }
+	report, err := engine.Run(context.Background())
+	require.NoError(err)
+	assert.Equal(1, report.Count(lifecycle.StatusDone))
+
+	got, err := client.AdminGetUser(types.AdminGetUserRequest{UserID: u.ID})
+	require.NoError(err)
+	assert.NotNil(got.DeletedAt)
+
+	// Soft deleted users are not acted on again.
+	report, err = engine.Run(context.Background())
+	require.NoError(err)
+	assert.Empty(report.Entries)
+}
@@ -0,0 +1,140 @@
+// Package lifecycle runs housekeeping on users: reminding users who have not
+// confirmed their account, and deleting, soft deleting or banning users who
+// never confirmed or stopped signing in. What to do is declared as a Policy
+// of rules, which can be planned as a dry run before it is applied.
+package lifecycle
+
+import (
+	"time"
+
+	"github.com/supabase-community/auth-go/types"
+)
+
+// Action is what a rule does to the users it matches.
+type Action string
+
+const (
+	// ActionResendConfirmation resends the signup confirmation email, or the
+	// SMS OTP for users with only a phone.
+	ActionResendConfirmation Action = "resend_confirmation"
+	ActionBan                Action = "ban"
+	ActionDelete             Action = "delete"
+	// ActionSoftDelete removes the user's personal data but keeps the user,
+	// see types.AdminDeleteUserRequest.ShouldSoftDelete.
+	ActionSoftDelete Action = "soft_delete"
+)
+
+// Rule matches users and acts on them. Every condition that is set must
+// hold for a user to match.
+type Rule struct {
+	Name   string
+	Action Action
+
+	// Unconfirmed matches users with an email or phone who have confirmed
+	// neither. Anonymous users have nothing to confirm and never match.
+	Unconfirmed bool
+	// MinAge matches users created at least this long ago.
+	MinAge time.Duration
+	// InactiveFor matches users who have not signed in for at least this
+	// long, counting from when they were created if they never signed in.
+	InactiveFor time.Duration
+	// Within, if set, only matches users whose other conditions started to
+	// hold less than Within ago. A job that runs at least every Within then
+	// acts on each user once, e.g. to send a single reminder.
+	Within time.Duration
+	// Match, if set, is an extra condition.
+	Match func(u *types.User) bool
+
+	// Limit is the most users the rule acts on in one run. Further matches
+	// are reported as skipped. Zero means no limit.
+	Limit int
+}
+
+// Policy is an ordered list of rules. Each user is acted on by the first
+// rule that matches, so stronger actions should come first.
+type Policy struct {
+	Rules []Rule
+}
+
+// DefaultPolicy deletes users who have not confirmed their account within
+// 14 days, reminds users who have not confirmed it after a day, and bans
+// users who have not signed in for a year.
+func DefaultPolicy() Policy {
+	return Policy{Rules: []Rule{
+		{
+			Name:        "delete-unconfirmed",
+			Action:      ActionDelete,
+			Unconfirmed: true,
+			MinAge:      14 * 24 * time.Hour,
+		},
+		{
+			Name:        "remind-unconfirmed",
+			Action:      ActionResendConfirmation,
+			Unconfirmed: true,
+			MinAge:      24 * time.Hour,
+			Within:      24 * time.Hour,
+		},
+		{
+			Name:        "ban-inactive",
+			Action:      ActionBan,
+			InactiveFor: 365 * 24 * time.Hour,
+		},
+	}}
+}
+
+// Matches reports whether the rule matches the user at the given time.
+// Soft deleted users never match.
+func (r *Rule) Matches(u *types.User, now time.Time) bool {
+	if u.DeletedAt != nil {
+		return false
+	}
+	if r.Unconfirmed && !unconfirmed(u) {
+		return false
+	}
+	// since is when all the time-based conditions started to hold.
+	since := u.CreatedAt
+	if r.MinAge > 0 {
+		since = u.CreatedAt.Add(r.MinAge)
+		if now.Before(since) {
+			return false
+		}
+	}
+	if r.InactiveFor > 0 {
+		last := u.CreatedAt
+		if u.LastSignInAt != nil {
+			last = *u.LastSignInAt
+		}
+		inactiveSince := last.Add(r.InactiveFor)
+		if now.Before(inactiveSince) {
+			return false
+		}
+		if inactiveSince.After(since) {
+			since = inactiveSince
+		}
+	}
+	if r.Within > 0 && now.Sub(since) >= r.Within {
+		return false
+	}
+	// Some actions have nothing to do for some users.
+	switch r.Action {
+	case ActionBan:
+		if u.BannedUntil != nil && u.BannedUntil.After(now) {
+			return false
+		}
+	case ActionResendConfirmation:
+		if u.Email == "" && u.Phone == "" {
+			return false
+		}
+	}
+	if r.Match != nil && !r.Match(u) {
+		return false
+	}
+	return true
+}
+
+func unconfirmed(u *types.User) bool {
+	if u.IsAnonymous || (u.Email == "" && u.Phone == "") {
+		return false
+	}
+	return u.EmailConfirmedAt == nil && u.PhoneConfirmedAt == nil
+}
@@ -0,0 +1,112 @@
+// Package metadata decodes user and app metadata into typed structs,
+// validates it against a schema before it is sent, and updates it with a
+// read-modify-write that detects concurrent changes.
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Decode decodes metadata into a T. Keys that T has no field for are
+// ignored; use DecodeStrict to catch them.
+func Decode[T any](m map[string]interface{}) (T, error) {
+	return decode[T](m, false)
+}
+
+// DecodeStrict is like Decode, but fails if the metadata has keys that T has
+// no field for. Use it to notice when a struct has drifted from what the
+// server stores.
+func DecodeStrict[T any](m map[string]interface{}) (T, error) {
+	return decode[T](m, true)
+}
+
+func decode[T any](m map[string]interface{}, strict bool) (T, error) {
+	var v T
+	if m == nil {
+		m = map[string]interface{}{}
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return v, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(&v); err != nil {
+		return v, fmt.Errorf("decoding metadata into %T: %w", v, err)
+	}
+	return v, nil
+}
+
+// Encode encodes v, which must encode to a JSON object, into metadata.
+func Encode(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("encoding %T as metadata: must encode to a JSON object", v)
+	}
+	if m == nil {
+		m = map[string]interface{}{}
+	}
+	return m, nil
+}
+
+// Diff returns the merge that turns old into new when sent to
+// AdminUpdateUser: keys that were added or changed with their new value, and
+// removed keys set to nil. Auth merges metadata at the top level, so nested
+// objects are sent whole.
+func Diff(old, new map[string]interface{}) map[string]interface{} {
+	diff := map[string]interface{}{}
+	for k, v := range new {
+		if ov, ok := old[k]; !ok || !equal(ov, v) {
+			diff[k] = v
+		}
+	}
+	for k := range old {
+		if _, ok := new[k]; !ok {
+			diff[k] = nil
+		}
+	}
+	return diff
+}
+
+// equal compares values by their JSON encoding, so that e.g. an int and the
+// float64 it decodes to are equal.
+func equal(a, b interface{}) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	ab, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ab, bb)
+}
+
+// clone returns a deep copy of m, so that an update function can change it
+// freely.
+func clone(m map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var c map[string]interface{}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c == nil {
+		c = map[string]interface{}{}
+	}
+	return c, nil
+}
@@ -0,0 +1,169 @@
+package metadata_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supabase-community/auth-go/authtest"
+	"github.com/supabase-community/auth-go/metadata"
+	"github.com/supabase-community/auth-go/types"
+)
+
+type profile struct {
+	Name  string   `json:"name"`
+	Tags  []string `json:"tags,omitempty"`
+	Level int      `json:"level"`
+}
+
+func TestDecodeEncode(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	m := map[string]interface{}{"name": "Ada", "level": float64(3), "theme": "dark"}
+	p, err := metadata.Decode[profile](m)
+	require.NoError(err)
+	assert.Equal(profile{Name: "Ada", Level: 3}, p)
+
+	_, err = metadata.DecodeStrict[profile](m)
+	assert.ErrorContains(err, `unknown field "theme"`)
+
+	p, err = metadata.Decode[profile](nil)
+	require.NoError(err)
+	assert.Equal(profile{}, p)
+
+	encoded, err := metadata.Encode(profile{Name: "Ada", Level: 4})
+	require.NoError(err)
+	assert.Equal(map[string]interface{}{"name": "Ada", "level": float64(4)}, encoded)
+
+	_, err = metadata.Encode([]string{"a"})
+	assert.Error(err)
+
+	diff := metadata.Diff(m, map[string]interface{}{"name": "Ada", "level": 4, "plan": "pro"})
+	assert.Equal(map[string]interface{}{"level": 4, "plan": "pro", "theme": nil}, diff)
+}
+
+func TestValidator(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var schema metadata.Schema
+	require.NoError(json.Unmarshal([]byte(`{
+		"type": "object",
+		"required": ["name"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 1, "maxLength": 8},
+			"level": {"type": "integer", "minimum": 0, "maximum": 10},
+			"plan": {"enum": ["free", "pro"]},
+			"tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}}
+		}
+	}`), &schema))
+	v := &metadata.Validator{Schema: &schema}
+
+	assert.NoError(v.Validate(map[string]interface{}{"name": "Ada", "level": 3, "plan": "pro", "tags": []string{"a"}}))
+
+	err := v.Validate(map[string]interface{}{
+		"level": 2.5,
+		"plan":  "team",
+		"tags":  []interface{}{"a", 1, "c"},
+		"extra": true,
+	})
+	var errs metadata.ValidationErrors
+	require.True(errors.As(err, &errs))
+	assert.Equal(metadata.ValidationErrors{
+		{Path: "name", Message: "is required"},
+		{Path: "extra", Message: "is not allowed"},
+		{Path: "level", Message: "must be of type integer, not number"},
+		{Path: "plan", Message: `must be one of "free", "pro"`},
+		{Path: "tags", Message: "must have at most 2 items"},
+		{Path: "tags[1]", Message: "must be of type string, not number"},
+	}, errs)
+
+	v = &metadata.Validator{Limits: metadata.Limits{MaxBytes: 20, MaxKeys: 1, MaxDepth: 2}}
+	err = v.Validate(map[string]interface{}{"a": map[string]interface{}{"b": []interface{}{1}}, "c": "long enough"})
+	require.True(errors.As(err, &errs))
+	assert.Len(errs, 3)
+
+	_, err = v.Encode(profile{Name: "a very long name"})
+	assert.Error(err)
+}
+
+func TestUpdater(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := authtest.DefaultConfig()
+	cfg.Now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	srv := authtest.NewServer(cfg)
+	defer srv.Close()
+	client := srv.AdminClient()
+
+	created, err := client.AdminCreateUser(types.AdminCreateUserRequest{
+		Email:        "a@example.com",
+		UserMetadata: map[string]interface{}{"name": "Ada", "tags": []string{"x"}, "theme": "dark"},
+	})
+	require.NoError(err)
+
+	// A concurrent update during the first call starts the update over on
+	// the new metadata.
+	updater := metadata.NewUpdater(client)
+	calls := 0
+	user, err := metadata.UpdateAs(updater, created.ID, func(p *profile) error {
+		calls++
+		if calls == 1 {
+			_, err := client.AdminUpdateUser(types.AdminUpdateUserRequest{
+				UserID:       created.ID,
+				UserMetadata: map[string]interface{}{"level": 5},
+			})
+			require.NoError(err)
+		}
+		p.Level++
+		p.Tags = nil
+		return nil
+	})
+	require.NoError(err)
+	assert.Equal(2, calls)
+	assert.Equal(map[string]interface{}{"name": "Ada", "level": float64(6), "theme": "dark"}, user.UserMetadata)
+
+	// Invalid metadata is not written.
+	maxLevel := 6.0
+	updater.Validator = &metadata.Validator{Schema: &metadata.Schema{
+		Properties: map[string]*metadata.Schema{"level": {Maximum: &maxLevel}},
+	}}
+	_, err = metadata.UpdateAs(updater, created.ID, func(p *profile) error {
+		p.Level++
+		return nil
+	})
+	assert.ErrorContains(err, "level: must be at most 6")
+
+	updater = metadata.NewUpdater(client)
+	updater.Kind = metadata.KindApp
+	updater.Retries = 0
+	_, err = updater.Update(created.ID, func(m map[string]interface{}) error {
+		_, err := client.AdminUpdateUser(types.AdminUpdateUserRequest{
+			UserID:       created.ID,
+			UserMetadata: map[string]interface{}{"level": 1},
+		})
+		require.NoError(err)
+		m["plan"] = "pro"
+		return nil
+	})
+	assert.ErrorIs(err, metadata.ErrConflict)
+
+	user, err = updater.Update(created.ID, func(m map[string]interface{}) error {
+		m["plan"] = "pro"
+		return nil
+	})
+	require.NoError(err)
+	assert.Equal("pro", user.AppMetadata["plan"])
+	assert.Equal("email", user.AppMetadata["provider"])
+}
@@ -0,0 +1,266 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a subset of JSON Schema that metadata is validated against. It
+// has the same field names, so simple schemas can be loaded from JSON.
+type Schema struct {
+	// Type is one of "object", "array", "string", "number", "integer",
+	// "boolean" or "null". Any type is allowed if it is empty.
+	Type string `json:"type,omitempty"`
+
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	// AdditionalProperties, if false, rejects object keys that are not in
+	// Properties.
+	AdditionalProperties *bool `json:"additionalProperties,omitempty"`
+
+	Items    *Schema `json:"items,omitempty"`
+	MaxItems *int    `json:"maxItems,omitempty"`
+
+	Enum      []interface{} `json:"enum,omitempty"`
+	MinLength *int          `json:"minLength,omitempty"`
+	MaxLength *int          `json:"maxLength,omitempty"`
+	Minimum   *float64      `json:"minimum,omitempty"`
+	Maximum   *float64      `json:"maximum,omitempty"`
+}
+
+// Limits bound the size of metadata. Metadata is copied into every access
+// token, so large metadata makes every request larger. Zero fields are not
+// checked.
+type Limits struct {
+	// MaxBytes is the maximum size of the metadata encoded as JSON.
+	MaxBytes int
+	// MaxKeys is the maximum number of top-level keys.
+	MaxKeys int
+	// MaxDepth is the maximum nesting of objects and arrays, where the
+	// top-level object has depth 1.
+	MaxDepth int
+}
+
+// ValidationError is a value that does not match the schema or limits.
+type ValidationError struct {
+	// Path is the location of the value, e.g. "address.zip" or "tags[2]". It
+	// is empty for the metadata as a whole.
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors are all the problems found in one piece of metadata.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return "invalid metadata: " + strings.Join(msgs, "; ")
+}
+
+// Validator checks metadata before it is sent to Auth.
+type Validator struct {
+	// Schema, if set, is the schema of the metadata object.
+	Schema *Schema
+	Limits Limits
+}
+
+// Validate returns ValidationErrors if m does not match the schema or limits.
+func (v *Validator) Validate(m map[string]interface{}) error {
+	if m == nil {
+		m = map[string]interface{}{}
+	}
+	// Round trip through JSON so that validation sees what the server will.
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	var errs ValidationErrors
+	if v.Limits.MaxBytes > 0 && len(data) > v.Limits.MaxBytes {
+		errs = append(errs, ValidationError{Message: fmt.Sprintf("is %d bytes, more than the limit of %d", len(data), v.Limits.MaxBytes)})
+	}
+	if v.Limits.MaxKeys > 0 && len(m) > v.Limits.MaxKeys {
+		errs = append(errs, ValidationError{Message: fmt.Sprintf("has %d keys, more than the limit of %d", len(m), v.Limits.MaxKeys)})
+	}
+	if v.Limits.MaxDepth > 0 {
+		if d := depth(value); d > v.Limits.MaxDepth {
+			errs = append(errs, ValidationError{Message: fmt.Sprintf("is nested %d deep, more than the limit of %d", d, v.Limits.MaxDepth)})
+		}
+	}
+	if v.Schema != nil {
+		errs = v.Schema.validate("", value, errs)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Encode encodes v as metadata and validates it.
+func (v *Validator) Encode(value interface{}) (map[string]interface{}, error) {
+	m, err := Encode(value)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.Validate(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (s *Schema) validate(path string, value interface{}, errs ValidationErrors) ValidationErrors {
+	fail := func(format string, args ...interface{}) ValidationErrors {
+		return append(errs, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.Type != "" && !hasType(value, s.Type) {
+		return fail("must be of type %s, not %s", s.Type, typeOf(value))
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if equal(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = fail("must be one of %s", formatEnum(s.Enum))
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			errs = fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			errs = fail("must be at most %d characters", *s.MaxLength)
+		}
+
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			errs = fail("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			errs = fail("must be at most %v", *s.Maximum)
+		}
+
+	case []interface{}:
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			errs = fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				errs = s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, ok := v[key]; !ok {
+				errs = append(errs, ValidationError{Path: join(path, key), Message: "is required"})
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			prop, ok := s.Properties[k]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					errs = append(errs, ValidationError{Path: join(path, k), Message: "is not allowed"})
+				}
+				continue
+			}
+			errs = prop.validate(join(path, k), v[k], errs)
+		}
+	}
+	return errs
+}
+
+func hasType(value interface{}, typ string) bool {
+	switch typ {
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == float64(int64(f))
+	default:
+		return typeOf(value) == typ
+	}
+}
+
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func depth(value interface{}) int {
+	max := 0
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if d := depth(item); d > max {
+				max = d
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			if d := depth(item); d > max {
+				max = d
+			}
+		}
+	default:
+		return 0
+	}
+	return max + 1
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func formatEnum(enum []interface{}) string {
+	parts := make([]string, 0, len(enum))
+	for _, e := range enum {
+		data, _ := json.Marshal(e)
+		parts = append(parts, string(data))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,162 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/google/uuid"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/types"
+)
+
+var ErrConflict = errors.New("metadata was changed by another update")
+
+// Kind is the metadata of a user that an Updater changes.
+type Kind string
+
+const (
+	KindUser Kind = "user_metadata"
+	KindApp  Kind = "app_metadata"
+)
+
+// Updater updates a user's metadata with a read-modify-write merge.
+//
+// Auth has no conditional updates, so the Updater reads the user again just
+// before writing and starts over if UpdatedAt changed in the meantime. This
+// narrows the window for lost updates to the time between that read and the
+// write, but does not close it. Only keys that the update changed are sent,
+// so concurrent changes to other keys are kept either way.
+type Updater struct {
+	client auth.Client
+
+	// Kind is the metadata to update. Defaults to KindUser.
+	Kind Kind
+	// Validator, if set, checks the metadata before it is written.
+	Validator *Validator
+	// Retries is how many times to start over after a conflict before
+	// returning ErrConflict. Defaults to 3.
+	Retries int
+}
+
+// NewUpdater returns an Updater. The client must have an admin token set.
+func NewUpdater(client auth.Client) *Updater {
+	return &Updater{
+		client:  client,
+		Kind:    KindUser,
+		Retries: 3,
+	}
+}
+
+// Update applies fn to a copy of the user's metadata and writes back the
+// keys it changed. If fn returns an error, nothing is written. fn may be
+// called more than once if the user changes concurrently.
+func (u *Updater) Update(userID uuid.UUID, fn func(m map[string]interface{}) error) (*types.User, error) {
+	return u.UpdateWith(userID, func(_ *types.User, m map[string]interface{}, _ *types.AdminUpdateUserRequest) error {
+		return fn(m)
+	})
+}
+
+// UpdateWith is like Update, but also passes fn the user the metadata was
+// read from and the request that will be sent, so that other fields can be
+// changed in the same request as the metadata.
+func (u *Updater) UpdateWith(userID uuid.UUID, fn func(user *types.User, m map[string]interface{}, req *types.AdminUpdateUserRequest) error) (*types.User, error) {
+	resp, err := u.client.AdminGetUser(types.AdminGetUserRequest{UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+	user := &resp.User
+
+	for attempt := 0; ; attempt++ {
+		old := u.metadata(user)
+		m, err := clone(old)
+		if err != nil {
+			return nil, err
+		}
+		req := types.AdminUpdateUserRequest{UserID: userID}
+		if err := fn(user, m, &req); err != nil {
+			return nil, err
+		}
+		if u.Validator != nil {
+			if err := u.Validator.Validate(m); err != nil {
+				return nil, err
+			}
+		}
+		diff := Diff(old, m)
+		if len(diff) == 0 && reflect.DeepEqual(req, types.AdminUpdateUserRequest{UserID: userID}) {
+			return user, nil
+		}
+
+		resp, err := u.client.AdminGetUser(types.AdminGetUserRequest{UserID: userID})
+		if err != nil {
+			return nil, err
+		}
+		if !resp.UpdatedAt.Equal(user.UpdatedAt) {
+			if attempt >= u.Retries {
+				return nil, fmt.Errorf("updating %s of user %s: %w", u.kind(), userID, ErrConflict)
+			}
+			user = &resp.User
+			continue
+		}
+
+		if len(diff) > 0 {
+			if u.kind() == KindApp {
+				req.AppMetadata = diff
+			} else {
+				req.UserMetadata = diff
+			}
+		}
+		updated, err := u.client.AdminUpdateUser(req)
+		if err != nil {
+			return nil, err
+		}
+		return &updated.User, nil
+	}
+}
+
+// UpdateAs is like Update, but decodes the metadata into a T for fn and
+// encodes it back afterwards. Keys that T has no field for are kept, and
+// keys that fn left out with omitempty are removed.
+func UpdateAs[T any](u *Updater, userID uuid.UUID, fn func(v *T) error) (*types.User, error) {
+	return u.Update(userID, func(m map[string]interface{}) error {
+		v, err := Decode[T](m)
+		if err != nil {
+			return err
+		}
+		before, err := Encode(v)
+		if err != nil {
+			return err
+		}
+		if err := fn(&v); err != nil {
+			return err
+		}
+		encoded, err := Encode(v)
+		if err != nil {
+			return err
+		}
+		for k := range before {
+			if _, ok := encoded[k]; !ok {
+				delete(m, k)
+			}
+		}
+		for k, val := range encoded {
+			m[k] = val
+		}
+		return nil
+	})
+}
+
+func (u *Updater) kind() Kind {
+	if u.Kind == "" {
+		return KindUser
+	}
+	return u.Kind
+}
+
+func (u *Updater) metadata(user *types.User) map[string]interface{} {
+	if u.kind() == KindApp {
+		return user.AppMetadata
+	}
+	return user.UserMetadata
+}
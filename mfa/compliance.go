@@ -0,0 +1,297 @@
+package mfa
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/rbac"
+	"github.com/supabase-community/auth-go/types"
+)
+
+// Rule requires the users it applies to to have verified MFA factors. Every
+// selector that is set must match for the rule to apply.
+type Rule struct {
+	Name string
+
+	// Roles applies the rule to users who hold any of the roles, either as
+	// their Auth role or as an rbac role, globally or in any tenant.
+	Roles []string
+	// EmailDomains applies the rule to users with an email in any of the
+	// domains.
+	EmailDomains []string
+	// Match, if set, is an extra selector.
+	Match func(u *types.User) bool
+
+	// FactorTypes are the factor types that count, e.g. "totp". Any type
+	// counts if it is empty.
+	FactorTypes []string
+	// MinFactors is how many verified factors are required. Defaults to 1.
+	MinFactors int
+	// GracePeriod gives users created less than this long ago time to enroll
+	// before they count as non-compliant.
+	GracePeriod time.Duration
+}
+
+// ComplianceStatus is the outcome of checking a user against a rule.
+type ComplianceStatus string
+
+const (
+	StatusCompliant    ComplianceStatus = "compliant"
+	StatusNonCompliant ComplianceStatus = "non_compliant"
+	// StatusGrace is a non-compliant user who is still in the rule's grace
+	// period.
+	StatusGrace ComplianceStatus = "grace"
+	// StatusGrantsUnreadable is a user whose rbac grants could not be read,
+	// so whether a rule with Roles applies to them is unknown. They are
+	// reported rather than assumed to hold no roles.
+	StatusGrantsUnreadable ComplianceStatus = "grants_unreadable"
+)
+
+// Finding is a user who does not meet a rule.
+type Finding struct {
+	UserID uuid.UUID        `json:"user_id"`
+	Email  string           `json:"email,omitempty"`
+	Rule   string           `json:"rule"`
+	Status ComplianceStatus `json:"status"`
+	Reason string           `json:"reason"`
+	// Verified is the number of verified factors that count for the rule.
+	Verified int `json:"verified"`
+	// GraceEndsAt is set for users in the grace period.
+	GraceEndsAt *time.Time `json:"grace_ends_at,omitempty"`
+}
+
+// ComplianceReport is the result of a scan.
+type ComplianceReport struct {
+	At time.Time `json:"at"`
+	// Users is the number of users scanned, and Checked the number that at
+	// least one rule applied to.
+	Users     int `json:"users"`
+	Checked   int `json:"checked"`
+	Compliant int `json:"compliant"`
+	// Findings are the users who do not meet a rule, one per user and rule.
+	Findings []Finding `json:"findings"`
+	// Notified is the number of findings passed to Notify without error.
+	Notified     int      `json:"notified"`
+	NotifyErrors []string `json:"notify_errors,omitempty"`
+}
+
+// NonCompliant returns the findings past their grace period, including
+// users whose grants could not be read.
+func (r *ComplianceReport) NonCompliant() []Finding {
+	var findings []Finding
+	for _, f := range r.Findings {
+		if f.Status != StatusGrace {
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// WriteText writes the report for review, one line per finding.
+func (r *ComplianceReport) WriteText(w io.Writer) error {
+	var b strings.Builder
+	for _, f := range r.Findings {
+		fmt.Fprintf(&b, "%-13s %s %s (%s): %s", f.Status, f.UserID, f.Email, f.Rule, f.Reason)
+		if f.GraceEndsAt != nil {
+			fmt.Fprintf(&b, ", grace ends %s", f.GraceEndsAt.Format(time.RFC3339))
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "%d users scanned, %d checked, %d compliant, %d non-compliant, %d in grace\n",
+		r.Users, r.Checked, r.Compliant, len(r.NonCompliant()), len(r.Findings)-len(r.NonCompliant()))
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Scanner checks every user against MFA rules.
+type Scanner struct {
+	client auth.Client
+	rules  []Rule
+
+	// Notify, if set, is called for each non-compliant finding after the
+	// scan, e.g. to email the user. Errors are recorded in the report and do
+	// not stop the scan.
+	Notify func(ctx context.Context, f Finding) error
+	// NotifyGrace also passes findings in their grace period to Notify, e.g.
+	// to remind users to enroll.
+	NotifyGrace bool
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+	// PerPage is the page size used to list users. Defaults to 100.
+	PerPage int
+}
+
+// NewScanner returns a Scanner for the rules. The client must have an admin
+// token set.
+func NewScanner(client auth.Client, rules ...Rule) *Scanner {
+	return &Scanner{
+		client:  client,
+		rules:   rules,
+		PerPage: 100,
+	}
+}
+
+// Scan checks every user and returns a report of those who do not meet the
+// rules that apply to them.
+func (s *Scanner) Scan(ctx context.Context) (*ComplianceReport, error) {
+	now := s.now()
+	report := &ComplianceReport{At: now, Findings: []Finding{}}
+	err := auth.NewAdminUsersPaginator(s.client, s.PerPage).Walk(func(u types.User) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if u.DeletedAt != nil {
+			return nil
+		}
+		report.Users++
+		checked, compliant := false, true
+		for i := range s.rules {
+			r := &s.rules[i]
+			applies, err := r.applies(&u)
+			if err != nil {
+				checked, compliant = true, false
+				report.Findings = append(report.Findings, Finding{
+					UserID: u.ID,
+					Email:  u.Email,
+					Rule:   r.Name,
+					Status: StatusGrantsUnreadable,
+					Reason: err.Error(),
+				})
+				continue
+			}
+			if !applies {
+				continue
+			}
+			checked = true
+			if f, ok := r.check(&u, now); !ok {
+				compliant = false
+				report.Findings = append(report.Findings, f)
+			}
+		}
+		if checked {
+			report.Checked++
+			if compliant {
+				report.Compliant++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Notify != nil {
+		for _, f := range report.Findings {
+			if f.Status == StatusGrace && !s.NotifyGrace {
+				continue
+			}
+			if err := s.Notify(ctx, f); err != nil {
+				report.NotifyErrors = append(report.NotifyErrors, fmt.Sprintf("%s: %s", f.UserID, err))
+				continue
+			}
+			report.Notified++
+		}
+	}
+	return report, nil
+}
+
+// applies reports whether the rule applies to the user. Roles are checked
+// last, so that an error reading the user's grants is only returned when it
+// decides the outcome.
+func (r *Rule) applies(u *types.User) (bool, error) {
+	if len(r.EmailDomains) > 0 {
+		_, domain, ok := strings.Cut(u.Email, "@")
+		if !ok || !containsFold(r.EmailDomains, domain) {
+			return false, nil
+		}
+	}
+	if r.Match != nil && !r.Match(u) {
+		return false, nil
+	}
+	if len(r.Roles) > 0 {
+		return hasAnyRole(u, r.Roles)
+	}
+	return true, nil
+}
+
+// check returns a finding and false if the user does not meet the rule.
+func (r *Rule) check(u *types.User, now time.Time) (Finding, bool) {
+	verified := 0
+	for _, f := range u.Factors {
+		if f.Status != types.FactorStatusVerified {
+			continue
+		}
+		if len(r.FactorTypes) > 0 && !containsFold(r.FactorTypes, f.FactorType) {
+			continue
+		}
+		verified++
+	}
+	min := r.MinFactors
+	if min <= 0 {
+		min = 1
+	}
+	if verified >= min {
+		return Finding{}, true
+	}
+
+	kind := "verified factors"
+	if len(r.FactorTypes) > 0 {
+		kind = "verified " + strings.Join(r.FactorTypes, " or ") + " factors"
+	}
+	f := Finding{
+		UserID:   u.ID,
+		Email:    u.Email,
+		Rule:     r.Name,
+		Status:   StatusNonCompliant,
+		Reason:   fmt.Sprintf("has %d %s, requires %d", verified, kind, min),
+		Verified: verified,
+	}
+	if graceEnds := u.CreatedAt.Add(r.GracePeriod); r.GracePeriod > 0 && now.Before(graceEnds) {
+		f.Status = StatusGrace
+		f.GraceEndsAt = &graceEnds
+	}
+	return f, false
+}
+
+func hasAnyRole(u *types.User, roles []string) (bool, error) {
+	if containsFold(roles, u.Role) {
+		return true, nil
+	}
+	g, err := rbac.GrantsFromAppMetadata(u.AppMetadata)
+	if err != nil {
+		return false, err
+	}
+	held := append([]string(nil), g.Roles...)
+	for _, tenantRoles := range g.Tenants {
+		held = append(held, tenantRoles...)
+	}
+	for _, role := range held {
+		if containsFold(roles, role) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Scanner) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,254 @@
+package mfa_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supabase-community/auth-go/authtest"
+	"github.com/supabase-community/auth-go/mfa"
+	"github.com/supabase-community/auth-go/rbac"
+	"github.com/supabase-community/auth-go/types"
+)
+
+func newUserWithFactors(t *testing.T, srv *authtest.Server, email string, names ...string) *types.User {
+	require := require.New(t)
+
+	password := "password"
+	created, err := srv.AdminClient().AdminCreateUser(types.AdminCreateUserRequest{
+		Email:        email,
+		Password:     &password,
+		EmailConfirm: true,
+	})
+	require.NoError(err)
+	token, err := srv.Client().SignInWithEmailPassword(email, password)
+	require.NoError(err)
+	client := srv.Client().WithToken(token.AccessToken)
+	for _, name := range names {
+		_, err = client.EnrollFactor(types.EnrollFactorRequest{
+			FactorType:   types.FactorTypeTOTP,
+			FriendlyName: name,
+		})
+		require.NoError(err)
+	}
+	return &created.User
+}
+
+func TestReset(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := authtest.NewServer(authtest.DefaultConfig())
+	defer srv.Close()
+	client := srv.AdminClient()
+	user := newUserWithFactors(t, srv, "ada@example.com", "phone", "laptop")
+	factors, err := client.AdminListUserFactors(types.AdminListUserFactorsRequest{UserID: user.ID})
+	require.NoError(err)
+	require.Len(factors.Factors, 2)
+	phone := factors.Factors[0]
+	if phone.FriendlyName != "phone" {
+		phone = factors.Factors[1]
+	}
+
+	resetter := mfa.NewResetter(client)
+	_, err = resetter.Reset(mfa.ResetRequest{UserID: user.ID, Reason: " "})
+	assert.ErrorIs(err, mfa.ErrReasonRequired)
+	_, err = resetter.Reset(mfa.ResetRequest{UserID: user.ID, Reason: "lost phone", FactorIDs: []uuid.UUID{uuid.New()}})
+	assert.ErrorIs(err, mfa.ErrUnknownFactor)
+
+	var approved []types.Factor
+	resetter.Approve = func(req mfa.ResetRequest, factors []types.Factor) (*mfa.Approval, error) {
+		approved = factors
+		switch req.Actor {
+		case "agent@example.com":
+			return &mfa.Approval{Approver: "lead@example.com", Note: "checked ID"}, nil
+		case "self@example.com":
+			return &mfa.Approval{Approver: "SELF@example.com"}, nil
+		default:
+			return nil, errors.New("refused")
+		}
+	}
+	_, err = resetter.Reset(mfa.ResetRequest{UserID: user.ID, Reason: "lost phone", Actor: "other@example.com"})
+	assert.ErrorIs(err, mfa.ErrNotApproved)
+	_, err = resetter.Reset(mfa.ResetRequest{UserID: user.ID, Reason: "lost phone", Actor: "self@example.com"})
+	assert.ErrorIs(err, mfa.ErrSelfApproval)
+	// Without an actor, any approver could be the person asking for the reset.
+	approved = nil
+	_, err = resetter.Reset(mfa.ResetRequest{UserID: user.ID, Reason: "lost phone"})
+	assert.ErrorIs(err, mfa.ErrActorRequired)
+	assert.Nil(approved)
+
+	summary, err := resetter.Reset(mfa.ResetRequest{
+		UserID:    user.ID,
+		FactorIDs: []uuid.UUID{phone.ID},
+		Reason:    "ticket 42: lost phone",
+		Actor:     "agent@example.com",
+	})
+	require.NoError(err)
+	require.Len(approved, 1)
+	require.Len(summary.Removed, 1)
+	assert.Equal(phone.ID, summary.Removed[0].ID)
+	require.Len(summary.Kept, 1)
+	assert.Equal("laptop", summary.Kept[0].FriendlyName)
+	assert.False(summary.Banned)
+	assert.Equal("lead@example.com", summary.Record.Approval.Approver)
+
+	resetter.Approve = nil
+	summary, err = resetter.Reset(mfa.ResetRequest{
+		UserID:             user.ID,
+		Reason:             "ticket 43: lost laptop",
+		Actor:              "agent@example.com",
+		BanUntilReverified: true,
+	})
+	require.NoError(err)
+	assert.Len(summary.Removed, 1)
+	assert.Empty(summary.Kept)
+	assert.True(summary.Banned)
+
+	factors, err = client.AdminListUserFactors(types.AdminListUserFactorsRequest{UserID: user.ID})
+	require.NoError(err)
+	assert.Empty(factors.Factors)
+	_, err = srv.Client().SignInWithEmailPassword("ada@example.com", "password")
+	assert.Error(err)
+
+	resets, err := resetter.Resets(user.ID)
+	require.NoError(err)
+	require.Len(resets, 2)
+	assert.Equal("ticket 42: lost phone", resets[0].Reason)
+	assert.Equal([]uuid.UUID{phone.ID}, resets[0].Factors)
+	assert.Equal("checked ID", resets[0].Approval.Note)
+	assert.True(resets[1].Banned)
+	assert.Nil(resets[1].Approval)
+
+	_, err = resetter.Reverified(user.ID, "agent@example.com")
+	require.NoError(err)
+	_, err = srv.Client().SignInWithEmailPassword("ada@example.com", "password")
+	assert.NoError(err)
+
+	entries, err := client.AdminAudit(types.AdminAuditRequest{
+		Query: &types.AuditQuery{Column: types.AuditQueryColumnAction, Value: "factor_deleted"},
+	})
+	require.NoError(err)
+	assert.Equal(2, entries.TotalCount)
+}
+
+func TestCompliance(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := authtest.NewServer(authtest.DefaultConfig())
+	defer srv.Close()
+	client := srv.AdminClient()
+	policy, err := rbac.NewPolicy(map[string]rbac.Role{"admin": {Permissions: []string{"*"}}})
+	require.NoError(err)
+	roles := rbac.NewManager(client, policy)
+
+	// ada is an admin with a verified TOTP factor.
+	password := "password"
+	ada, err := client.AdminCreateUser(types.AdminCreateUserRequest{Email: "ada@example.com", Password: &password, EmailConfirm: true})
+	require.NoError(err)
+	token, err := srv.Client().SignInWithEmailPassword("ada@example.com", password)
+	require.NoError(err)
+	user := srv.Client().WithToken(token.AccessToken)
+	enrolled, err := user.EnrollFactor(types.EnrollFactorRequest{FactorType: types.FactorTypeTOTP})
+	require.NoError(err)
+	challenge, err := user.ChallengeFactor(types.ChallengeFactorRequest{FactorID: enrolled.ID})
+	require.NoError(err)
+	code, err := authtest.TOTP(enrolled.TOTP.Secret, time.Now())
+	require.NoError(err)
+	_, err = user.VerifyFactor(types.VerifyFactorRequest{FactorID: enrolled.ID, ChallengeID: challenge.ID, Code: code})
+	require.NoError(err)
+	_, err = roles.Assign(ada.ID, "", "admin")
+	require.NoError(err)
+
+	// bob is an admin in one tenant whose factor was never verified.
+	bob := newUserWithFactors(t, srv, "bob@example.com", "phone")
+	_, err = roles.Assign(bob.ID, "acme", "admin")
+	require.NoError(err)
+
+	carol := newUserWithFactors(t, srv, "carol@corp.example.com")
+	newUserWithFactors(t, srv, "dave@example.com")
+
+	now := time.Now().Add(48 * time.Hour)
+	scanner := mfa.NewScanner(client,
+		mfa.Rule{Name: "admins", Roles: []string{"admin"}, FactorTypes: []string{"totp"}, GracePeriod: 24 * time.Hour},
+		mfa.Rule{Name: "corp", EmailDomains: []string{"corp.example.com"}, GracePeriod: 7 * 24 * time.Hour},
+	)
+	scanner.Now = func() time.Time { return now }
+	var notified []mfa.Finding
+	scanner.Notify = func(ctx context.Context, f mfa.Finding) error {
+		if f.UserID == carol.ID {
+			return errors.New("mail down")
+		}
+		notified = append(notified, f)
+		return nil
+	}
+
+	report, err := scanner.Scan(context.Background())
+	require.NoError(err)
+	assert.Equal(4, report.Users)
+	assert.Equal(3, report.Checked)
+	assert.Equal(1, report.Compliant)
+	require.Len(report.Findings, 2)
+	nonCompliant := report.NonCompliant()
+	require.Len(nonCompliant, 1)
+	assert.Equal(bob.ID, nonCompliant[0].UserID)
+	assert.Equal("admins", nonCompliant[0].Rule)
+	assert.Equal(0, nonCompliant[0].Verified)
+	assert.Equal(1, report.Notified)
+	require.Len(notified, 1)
+	assert.Equal(bob.ID, notified[0].UserID)
+	assert.Empty(report.NotifyErrors)
+
+	var grace mfa.Finding
+	for _, f := range report.Findings {
+		if f.Status == mfa.StatusGrace {
+			grace = f
+		}
+	}
+	assert.Equal(carol.ID, grace.UserID)
+	require.NotNil(grace.GraceEndsAt)
+	assert.True(grace.GraceEndsAt.After(now))
+
+	// Findings in their grace period are only notified if asked for.
+	scanner.NotifyGrace = true
+	notified = nil
+	report, err = scanner.Scan(context.Background())
+	require.NoError(err)
+	assert.Equal(1, report.Notified)
+	assert.Len(report.NotifyErrors, 1)
+
+	var text bytes.Buffer
+	require.NoError(report.WriteText(&text))
+	assert.Contains(text.String(), "bob@example.com (admins)")
+	assert.Contains(text.String(), "1 non-compliant, 1 in grace")
+
+	// A user whose grants can't be read is reported, not assumed to hold no
+	// roles.
+	erin, err := client.AdminCreateUser(types.AdminCreateUserRequest{
+		Email:       "erin@example.com",
+		AppMetadata: map[string]interface{}{"roles": "admin"},
+	})
+	require.NoError(err)
+	scanner.Notify = nil
+	report, err = scanner.Scan(context.Background())
+	require.NoError(err)
+	assert.Equal(4, report.Checked)
+	nonCompliant = report.NonCompliant()
+	require.Len(nonCompliant, 2)
+	var unreadable mfa.Finding
+	for _, f := range nonCompliant {
+		if f.UserID == erin.ID {
+			unreadable = f
+		}
+	}
+	assert.Equal(mfa.StatusGrantsUnreadable, unreadable.Status)
+	assert.Equal("admins", unreadable.Rule)
+	assert.Contains(unreadable.Reason, "reading grants")
+}
@@ -0,0 +1,274 @@
+// Package mfa helps admins manage users' MFA factors: resetting the factors
+// of users who lost their authenticator, and reporting users who do not have
+// the factors that policy requires.
+package mfa
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/bans"
+	"github.com/supabase-community/auth-go/metadata"
+	"github.com/supabase-community/auth-go/types"
+)
+
+// ResetsKey is the app_metadata key that MFA resets are recorded under.
+const ResetsKey = "mfa_resets"
+
+var (
+	ErrReasonRequired = errors.New("an MFA reset requires a reason")
+	ErrNotApproved    = errors.New("MFA reset was not approved")
+	ErrSelfApproval   = errors.New("MFA reset must be approved by someone other than the actor")
+	ErrActorRequired  = errors.New("an approved MFA reset requires an actor")
+	ErrUnknownFactor  = errors.New("factor does not belong to the user")
+)
+
+type ResetRequest struct {
+	UserID uuid.UUID
+	// FactorIDs, if set, are the factors to remove. Every factor is removed
+	// if it is empty.
+	FactorIDs []uuid.UUID
+
+	// Reason is why the factors are reset, e.g. a support ticket. Required.
+	Reason string
+	// Actor is who reset the factors, e.g. a support agent's email. Required
+	// if the Resetter has an Approve func, so that the approver can be told
+	// apart from the actor.
+	Actor string
+
+	// BanUntilReverified bans the user until Reverified is called, e.g. once
+	// support has verified their identity again.
+	BanUntilReverified bool
+}
+
+// Approval is a second person's sign-off on a reset.
+type Approval struct {
+	Approver string    `json:"approver"`
+	At       time.Time `json:"at"`
+	Note     string    `json:"note,omitempty"`
+}
+
+// ApproveFunc asks a second person to approve a reset of the given factors.
+// It returns an error, or a nil Approval, to refuse it.
+type ApproveFunc func(req ResetRequest, factors []types.Factor) (*Approval, error)
+
+// ResetRecord is an MFA reset, as recorded in the user's app_metadata.
+type ResetRecord struct {
+	At       time.Time   `json:"at"`
+	Actor    string      `json:"actor,omitempty"`
+	Reason   string      `json:"reason"`
+	Approval *Approval   `json:"approval,omitempty"`
+	Factors  []uuid.UUID `json:"factors"`
+	Banned   bool        `json:"banned,omitempty"`
+	// Error is set if the reset stopped part way.
+	Error string `json:"error,omitempty"`
+}
+
+// ResetSummary is the outcome of a reset.
+type ResetSummary struct {
+	UserID uuid.UUID
+	// Removed are the factors that were removed.
+	Removed []types.Factor
+	// Kept are the user's factors that were not selected for removal, or
+	// could not be removed.
+	Kept   []types.Factor
+	Banned bool
+	Record ResetRecord
+}
+
+// Resetter resets users' MFA factors, replacing calls to
+// AdminListUserFactors and AdminDeleteUserFactor by hand.
+type Resetter struct {
+	client  auth.Client
+	updater *metadata.Updater
+	bans    *bans.Manager
+
+	// Approve, if set, must approve every reset before anything is changed.
+	Approve ApproveFunc
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+	// HistoryLimit is how many resets are kept per user, oldest dropped
+	// first. Defaults to 20.
+	HistoryLimit int
+}
+
+// NewResetter returns a Resetter. The client must have an admin token set.
+func NewResetter(client auth.Client) *Resetter {
+	updater := metadata.NewUpdater(client)
+	updater.Kind = metadata.KindApp
+	r := &Resetter{
+		client:       client,
+		updater:      updater,
+		bans:         bans.NewManager(client, nil),
+		HistoryLimit: 20,
+	}
+	r.bans.Now = r.now
+	return r
+}
+
+// Reset removes the selected factors, bans the user if requested and
+// records the reset in app_metadata.
+//
+// If removing a factor fails, Reset stops, records what it did with the
+// error, and returns the summary along with the error.
+func (r *Resetter) Reset(req ResetRequest) (*ResetSummary, error) {
+	if strings.TrimSpace(req.Reason) == "" {
+		return nil, ErrReasonRequired
+	}
+	if r.Approve != nil && strings.TrimSpace(req.Actor) == "" {
+		return nil, ErrActorRequired
+	}
+	resp, err := r.client.AdminListUserFactors(types.AdminListUserFactorsRequest{UserID: req.UserID})
+	if err != nil {
+		return nil, err
+	}
+	selected, kept, err := selectFactors(resp.Factors, req.FactorIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &ResetSummary{
+		UserID: req.UserID,
+		Kept:   kept,
+		Record: ResetRecord{Actor: req.Actor, Reason: req.Reason, Factors: []uuid.UUID{}},
+	}
+	if r.Approve != nil {
+		approval, err := r.Approve(req, selected)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrNotApproved, err)
+		}
+		if approval == nil {
+			return nil, ErrNotApproved
+		}
+		approver := strings.TrimSpace(approval.Approver)
+		if approver == "" || strings.EqualFold(approver, strings.TrimSpace(req.Actor)) {
+			return nil, ErrSelfApproval
+		}
+		if approval.At.IsZero() {
+			approval.At = r.now()
+		}
+		summary.Record.Approval = approval
+	}
+
+	resetErr := r.reset(req, selected, summary)
+	summary.Record.At = r.now()
+	if resetErr != nil {
+		summary.Record.Error = resetErr.Error()
+	}
+	if err := r.record(req.UserID, summary.Record); err != nil {
+		if resetErr != nil {
+			return summary, resetErr
+		}
+		return summary, err
+	}
+	return summary, resetErr
+}
+
+func (r *Resetter) reset(req ResetRequest, selected []types.Factor, summary *ResetSummary) error {
+	for i, f := range selected {
+		err := r.client.AdminDeleteUserFactor(types.AdminDeleteUserFactorRequest{UserID: req.UserID, FactorID: f.ID})
+		if err != nil {
+			summary.Kept = append(summary.Kept, selected[i:]...)
+			return fmt.Errorf("removing factor %s: %w", f.ID, err)
+		}
+		summary.Removed = append(summary.Removed, f)
+		summary.Record.Factors = append(summary.Record.Factors, f.ID)
+	}
+
+	if req.BanUntilReverified {
+		_, err := r.bans.Ban(bans.BanRequest{
+			UserID: req.UserID,
+			Reason: "MFA reset, pending re-verification: " + req.Reason,
+			Actor:  req.Actor,
+		})
+		if err != nil {
+			return fmt.Errorf("banning user: %w", err)
+		}
+		summary.Banned = true
+		summary.Record.Banned = true
+	}
+	return nil
+}
+
+func (r *Resetter) record(userID uuid.UUID, rec ResetRecord) error {
+	_, err := r.updater.Update(userID, func(m map[string]interface{}) error {
+		history, err := readResets(m)
+		if err != nil {
+			return err
+		}
+		history = append(history, rec)
+		if limit := r.historyLimit(); len(history) > limit {
+			history = history[len(history)-limit:]
+		}
+		m[ResetsKey] = history
+		return nil
+	})
+	return err
+}
+
+// Reverified lifts the ban of a user who was banned until re-verification.
+func (r *Resetter) Reverified(userID uuid.UUID, actor string) (*types.User, error) {
+	return r.bans.Unban(bans.UnbanRequest{UserID: userID, Reason: "re-verified after MFA reset", Actor: actor})
+}
+
+// Resets returns the MFA resets recorded for the user, oldest first.
+func (r *Resetter) Resets(userID uuid.UUID) ([]ResetRecord, error) {
+	resp, err := r.client.AdminGetUser(types.AdminGetUserRequest{UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+	return readResets(resp.AppMetadata)
+}
+
+func readResets(m map[string]interface{}) ([]ResetRecord, error) {
+	h, err := metadata.Decode[struct {
+		Resets []ResetRecord `json:"resets"`
+	}](map[string]interface{}{"resets": m[ResetsKey]})
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", ResetsKey, err)
+	}
+	return h.Resets, nil
+}
+
+func selectFactors(factors []types.Factor, ids []uuid.UUID) (selected, kept []types.Factor, err error) {
+	if len(ids) == 0 {
+		return factors, nil, nil
+	}
+	want := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		want[id] = true
+	}
+	for _, f := range factors {
+		if want[f.ID] {
+			selected = append(selected, f)
+			delete(want, f.ID)
+		} else {
+			kept = append(kept, f)
+		}
+	}
+	for _, id := range ids {
+		if want[id] {
+			return nil, nil, fmt.Errorf("%w: %s", ErrUnknownFactor, id)
+		}
+	}
+	return selected, kept, nil
+}
+
+func (r *Resetter) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+func (r *Resetter) historyLimit() int {
+	if r.HistoryLimit <= 0 {
+		return 20
+	}
+	return r.HistoryLimit
+}
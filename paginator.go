@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/supabase-community/auth-go/types"
+)
+
+// ErrStopWalk can be returned from the function passed to Paginator.Walk to
+// stop walking without an error.
+var ErrStopWalk = errors.New("stop walk")
+
+// Page is one page of results from a paginated endpoint.
+type Page[T any] struct {
+	Items []T
+	// NextPage is the number of the next page, or 0 if this is the last page.
+	NextPage uint
+	// TotalCount is the total number of results across all pages.
+	TotalCount int
+}
+
+// PageFunc fetches a page of results. Pages are numbered from 1.
+type PageFunc[T any] func(page uint) (*Page[T], error)
+
+// Paginator iterates over every result of a paginated endpoint, fetching
+// pages as they are needed. Only one page is held in memory at a time.
+//
+// Use Next to iterate:
+//
+//	p := auth.NewAdminUsersPaginator(client, 100)
+//	for p.Next() {
+//		user := p.Value()
+//		...
+//	}
+//	if err := p.Err(); err != nil {
+//		...
+//	}
+//
+// or Walk or Stream. A Paginator can only be used once, and is not safe for
+// concurrent use.
+type Paginator[T any] struct {
+	fetch PageFunc[T]
+
+	page       uint
+	items      []T
+	current    T
+	totalCount int
+	err        error
+	done       bool
+}
+
+// NewPaginator returns a paginator that calls fetch for each page, starting
+// from page 1.
+func NewPaginator[T any](fetch PageFunc[T]) *Paginator[T] {
+	return &Paginator[T]{
+		fetch: fetch,
+		page:  1,
+	}
+}
+
+// NewAdminUsersPaginator returns a paginator over all users. perPage sets the
+// page size, or uses the server default if 0.
+func NewAdminUsersPaginator(c Client, perPage int) *Paginator[types.User] {
+	return NewPaginator(func(page uint) (*Page[types.User], error) {
+		p := int(page)
+		req := types.AdminListUsersRequest{Page: &p}
+		if perPage > 0 {
+			req.PerPage = &perPage
+		}
+		resp, err := c.AdminListUsers(req)
+		if err != nil {
+			return nil, err
+		}
+		return &Page[types.User]{
+			Items:      resp.Users,
+			NextPage:   resp.NextPage,
+			TotalCount: resp.TotalCount,
+		}, nil
+	})
+}
+
+// NewAdminAuditPaginator returns a paginator over all audit log entries
+// matching the query, which may be nil. perPage sets the page size, or
+// uses the server default if 0.
+func NewAdminAuditPaginator(c Client, query *types.AuditQuery, perPage uint) *Paginator[types.AuditLogEntry] {
+	if perPage == 0 {
+		perPage = 50
+	}
+	return NewPaginator(func(page uint) (*Page[types.AuditLogEntry], error) {
+		resp, err := c.AdminAudit(types.AdminAuditRequest{
+			Query:   query,
+			Page:    page,
+			PerPage: perPage,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &Page[types.AuditLogEntry]{
+			Items:      resp.Logs,
+			NextPage:   resp.NextPage,
+			TotalCount: resp.TotalCount,
+		}, nil
+	})
+}
+
+// Next advances to the next result, fetching the next page if needed. It
+// returns false when there are no more results or a page could not be
+// fetched; check Err to tell which.
+func (p *Paginator[T]) Next() bool {
+	for len(p.items) == 0 {
+		if p.done || p.err != nil {
+			return false
+		}
+		p.fetchPage()
+	}
+
+	p.current = p.items[0]
+	p.items = p.items[1:]
+	return true
+}
+
+func (p *Paginator[T]) fetchPage() {
+	page, err := p.fetch(p.page)
+	if err != nil {
+		p.err = err
+		return
+	}
+
+	p.items = page.Items
+	p.totalCount = page.TotalCount
+	// Stop on an empty page too, so a server that keeps returning a next
+	// link can't loop forever.
+	if page.NextPage == 0 || page.NextPage <= p.page || len(page.Items) == 0 {
+		p.done = true
+		return
+	}
+	p.page = page.NextPage
+}
+
+// Value returns the current result.
+func (p *Paginator[T]) Value() T {
+	return p.current
+}
+
+// Err returns the error that stopped iteration, if any.
+func (p *Paginator[T]) Err() error {
+	return p.err
+}
+
+// TotalCount returns the total number of results reported by the server.
+// It is 0 until the first page has been fetched.
+func (p *Paginator[T]) TotalCount() int {
+	return p.totalCount
+}
+
+// Walk calls fn for each remaining result. It stops at the first error from
+// fn, and returns it, unless it is ErrStopWalk.
+func (p *Paginator[T]) Walk(fn func(T) error) error {
+	for p.Next() {
+		if err := fn(p.Value()); err != nil {
+			if errors.Is(err, ErrStopWalk) {
+				return nil
+			}
+			return err
+		}
+	}
+	return p.Err()
+}
+
+// Stream sends each remaining result on the returned channel, which holds up
+// to buffer results. Pages are only fetched as the receiver keeps up. Once
+// the results channel is closed, the error channel receives the error that
+// stopped iteration, or nil, and is closed.
+//
+// Cancelling ctx stops the stream, with ctx.Err() as the error. The caller
+// must either receive every result or cancel ctx.
+func (p *Paginator[T]) Stream(ctx context.Context, buffer int) (<-chan T, <-chan error) {
+	results := make(chan T, buffer)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(errc)
+		defer close(results)
+
+		for {
+			if err := ctx.Err(); err != nil {
+				errc <- err
+				return
+			}
+			if !p.Next() {
+				errc <- p.Err()
+				return
+			}
+			select {
+			case results <- p.Value():
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return results, errc
+}
@@ -0,0 +1,146 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/authtest"
+	"github.com/supabase-community/auth-go/types"
+)
+
+func newServerWithUsers(t *testing.T, n int) (*authtest.Server, auth.Client) {
+	srv := authtest.NewServer(authtest.DefaultConfig())
+	t.Cleanup(srv.Close)
+	client := srv.AdminClient()
+	for i := 0; i < n; i++ {
+		_, err := client.AdminCreateUser(types.AdminCreateUserRequest{
+			Email: fmt.Sprintf("user%d@example.com", i),
+		})
+		require.NoError(t, err)
+	}
+	return srv, client
+}
+
+func TestAdminListUsersPagination(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	_, client := newServerWithUsers(t, 7)
+
+	page, perPage := 2, 3
+	resp, err := client.AdminListUsers(types.AdminListUsersRequest{Page: &page, PerPage: &perPage})
+	require.NoError(err)
+	assert.Len(resp.Users, 3)
+	assert.Equal(7, resp.TotalCount)
+	assert.Equal(uint(3), resp.TotalPages)
+	assert.Equal(uint(3), resp.NextPage)
+
+	page = 3
+	resp, err = client.AdminListUsers(types.AdminListUsersRequest{Page: &page, PerPage: &perPage})
+	require.NoError(err)
+	assert.Len(resp.Users, 1)
+	assert.Equal(uint(0), resp.NextPage)
+}
+
+func TestPaginatorNext(t *testing.T) {
+	assert := assert.New(t)
+
+	_, client := newServerWithUsers(t, 7)
+
+	p := auth.NewAdminUsersPaginator(client, 3)
+	seen := map[string]bool{}
+	for p.Next() {
+		seen[p.Value().Email] = true
+	}
+	assert.NoError(p.Err())
+	assert.Len(seen, 7)
+	assert.Equal(7, p.TotalCount())
+	assert.False(p.Next())
+}
+
+func TestPaginatorWalk(t *testing.T) {
+	assert := assert.New(t)
+
+	srv, client := newServerWithUsers(t, 4)
+
+	var count int
+	err := auth.NewAdminAuditPaginator(client, &types.AuditQuery{
+		Column: types.AuditQueryColumnAction,
+		Value:  "user_signedup",
+	}, 1).Walk(func(e types.AuditLogEntry) error {
+		count++
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal(4, count)
+
+	count = 0
+	err = auth.NewAdminUsersPaginator(client, 1).Walk(func(u types.User) error {
+		count++
+		if count == 2 {
+			return auth.ErrStopWalk
+		}
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal(2, count)
+
+	// Errors fetching a page stop the walk.
+	srv.Close()
+	err = auth.NewAdminUsersPaginator(client, 1).Walk(func(u types.User) error {
+		return nil
+	})
+	assert.Error(err)
+}
+
+func TestPaginatorStream(t *testing.T) {
+	assert := assert.New(t)
+
+	_, client := newServerWithUsers(t, 5)
+
+	results, errc := auth.NewAdminUsersPaginator(client, 2).Stream(context.Background(), 0)
+	var count int
+	for range results {
+		count++
+	}
+	assert.NoError(<-errc)
+	assert.Equal(5, count)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results, errc = auth.NewAdminUsersPaginator(client, 2).Stream(ctx, 0)
+	<-results
+	cancel()
+	for range results {
+	}
+	assert.ErrorIs(<-errc, context.Canceled)
+}
+
+func TestPaginatorStopsOnEmptyPage(t *testing.T) {
+	assert := assert.New(t)
+
+	var fetched []uint
+	p := auth.NewPaginator(func(page uint) (*auth.Page[int], error) {
+		fetched = append(fetched, page)
+		switch page {
+		case 1:
+			return &auth.Page[int]{Items: []int{1, 2}, NextPage: 2}, nil
+		case 2:
+			return &auth.Page[int]{NextPage: 3}, nil
+		}
+		return nil, errors.New("unexpected page")
+	})
+
+	var items []int
+	for p.Next() {
+		items = append(items, p.Value())
+	}
+	assert.NoError(p.Err())
+	assert.Equal([]int{1, 2}, items)
+	assert.Equal([]uint{1, 2}, fetched)
+}
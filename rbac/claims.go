@@ -0,0 +1,166 @@
+package rbac
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"sort"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+
+	"github.com/supabase-community/auth-go/metadata"
+)
+
+// The app_metadata keys that grants are stored under.
+const (
+	RolesKey       = "roles"
+	TenantRolesKey = "tenant_roles"
+)
+
+var ErrInvalidToken = errors.New("invalid access token")
+
+// Grants are the roles held by a user, as stored in app_metadata:
+//
+//	{"roles": ["admin"], "tenant_roles": {"acme": ["editor"]}}
+type Grants struct {
+	// Roles are global roles, which apply in every tenant.
+	Roles []string `json:"roles,omitempty"`
+	// Tenants are the roles held in each tenant.
+	Tenants map[string][]string `json:"tenant_roles,omitempty"`
+}
+
+// GrantsFromAppMetadata reads the grants from a user's app_metadata.
+func GrantsFromAppMetadata(m map[string]interface{}) (Grants, error) {
+	g, err := metadata.Decode[Grants](map[string]interface{}{
+		RolesKey:       m[RolesKey],
+		TenantRolesKey: m[TenantRolesKey],
+	})
+	if err != nil {
+		return Grants{}, fmt.Errorf("reading grants from app_metadata: %w", err)
+	}
+	return g, nil
+}
+
+// RolesIn returns the global roles and the roles held in the tenant.
+func (g Grants) RolesIn(tenant string) []string {
+	roles := append([]string(nil), g.Roles...)
+	if tenant != "" {
+		roles = append(roles, g.Tenants[tenant]...)
+	}
+	return roles
+}
+
+// Has reports whether the role is held in the tenant, or globally if tenant
+// is empty. Global roles do not count as held in a tenant.
+func (g Grants) Has(tenant, role string) bool {
+	roles := g.Roles
+	if tenant != "" {
+		roles = g.Tenants[tenant]
+	}
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Grants) add(tenant, role string) bool {
+	if g.Has(tenant, role) {
+		return false
+	}
+	if tenant == "" {
+		g.Roles = append(g.Roles, role)
+		sort.Strings(g.Roles)
+		return true
+	}
+	if g.Tenants == nil {
+		g.Tenants = map[string][]string{}
+	}
+	g.Tenants[tenant] = append(g.Tenants[tenant], role)
+	sort.Strings(g.Tenants[tenant])
+	return true
+}
+
+func (g *Grants) remove(tenant, role string) bool {
+	if !g.Has(tenant, role) {
+		return false
+	}
+	without := func(roles []string) []string {
+		var kept []string
+		for _, r := range roles {
+			if r != role {
+				kept = append(kept, r)
+			}
+		}
+		return kept
+	}
+	if tenant == "" {
+		g.Roles = without(g.Roles)
+		return true
+	}
+	g.Tenants[tenant] = without(g.Tenants[tenant])
+	if len(g.Tenants[tenant]) == 0 {
+		delete(g.Tenants, tenant)
+	}
+	return true
+}
+
+// Subject is the user an access token was issued to, with their grants.
+type Subject struct {
+	UserID uuid.UUID
+	Grants
+}
+
+// SubjectFromClaims reads the subject from the claims of an access token
+// that has already been verified. Auth copies app_metadata into every access
+// token, so grants changed since the token was issued only apply once it is
+// refreshed.
+func SubjectFromClaims(claims map[string]interface{}) (*Subject, error) {
+	sub, _ := claims["sub"].(string)
+	id, err := uuid.Parse(sub)
+	if err != nil {
+		return nil, fmt.Errorf("%w: sub claim is not a user ID", ErrInvalidToken)
+	}
+	appMetadata, _ := claims["app_metadata"].(map[string]interface{})
+	g, err := GrantsFromAppMetadata(appMetadata)
+	if err != nil {
+		return nil, err
+	}
+	return &Subject{UserID: id, Grants: g}, nil
+}
+
+// Audience is the aud claim of the access tokens Auth issues to users.
+const Audience = "authenticated"
+
+// VerifyToken verifies an access token and returns its subject. key is the
+// JWT secret as a []byte for HS256 tokens, an *rsa.PublicKey for RS256 tokens
+// or an *ecdsa.PublicKey for ES256 tokens; tokens signed with any other
+// method are rejected, so a public key can't be used as an HMAC secret. The
+// token's aud claim must be Audience.
+func VerifyToken(token string, key interface{}) (*Subject, error) {
+	var method string
+	switch key.(type) {
+	case []byte:
+		method = jwt.SigningMethodHS256.Alg()
+	case *rsa.PublicKey:
+		method = jwt.SigningMethodRS256.Alg()
+	case *ecdsa.PublicKey:
+		method = jwt.SigningMethodES256.Alg()
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return key, nil
+	}, jwt.WithValidMethods([]string{method}))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+	if !claims.VerifyAudience(Audience, true) {
+		return nil, fmt.Errorf("%w: aud claim is not %q", ErrInvalidToken, Audience)
+	}
+	return SubjectFromClaims(claims)
+}
@@ -0,0 +1,110 @@
+package rbac
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/metadata"
+	"github.com/supabase-community/auth-go/types"
+)
+
+// Manager grants and revokes roles by updating app_metadata.
+//
+// Only the roles and tenant_roles keys are written, and they are changed
+// with a metadata.Updater, so a concurrent change to a user's grants is
+// retried instead of being overwritten.
+type Manager struct {
+	client  auth.Client
+	policy  *Policy
+	updater *metadata.Updater
+
+	// PerPage is the page size used to list users. Defaults to 100.
+	PerPage int
+}
+
+// NewManager returns a Manager that grants roles defined by the policy. The
+// client must have an admin token set.
+func NewManager(client auth.Client, policy *Policy) *Manager {
+	updater := metadata.NewUpdater(client)
+	updater.Kind = metadata.KindApp
+	return &Manager{
+		client:  client,
+		policy:  policy,
+		updater: updater,
+		PerPage: 100,
+	}
+}
+
+// Assign grants the role to the user in the tenant, or globally if tenant
+// is empty. Assigning a role the user already holds is not an error.
+func (m *Manager) Assign(userID uuid.UUID, tenant, role string) (*types.User, error) {
+	if !m.policy.HasRole(role) {
+		return nil, fmt.Errorf("%w %q", ErrUnknownRole, role)
+	}
+	return m.update(userID, func(g *Grants) bool {
+		return g.add(tenant, role)
+	})
+}
+
+// Revoke removes the role from the user in the tenant, or globally if
+// tenant is empty. Revoking a role the user does not hold is not an error.
+func (m *Manager) Revoke(userID uuid.UUID, tenant, role string) (*types.User, error) {
+	return m.update(userID, func(g *Grants) bool {
+		return g.remove(tenant, role)
+	})
+}
+
+// Grants returns the user's current grants.
+func (m *Manager) Grants(userID uuid.UUID) (Grants, error) {
+	resp, err := m.client.AdminGetUser(types.AdminGetUserRequest{UserID: userID})
+	if err != nil {
+		return Grants{}, err
+	}
+	return GrantsFromAppMetadata(resp.AppMetadata)
+}
+
+func (m *Manager) update(userID uuid.UUID, fn func(g *Grants) bool) (*types.User, error) {
+	return m.updater.Update(userID, func(md map[string]interface{}) error {
+		g, err := GrantsFromAppMetadata(md)
+		if err != nil {
+			return err
+		}
+		if !fn(&g) {
+			return nil
+		}
+		if len(g.Roles) > 0 {
+			md[RolesKey] = g.Roles
+		} else {
+			delete(md, RolesKey)
+		}
+		if len(g.Tenants) > 0 {
+			md[TenantRolesKey] = g.Tenants
+		} else {
+			delete(md, TenantRolesKey)
+		}
+		return nil
+	})
+}
+
+// UsersWithRole lists the users holding the role in the tenant, or globally
+// if tenant is empty. It pages through every user, as Auth cannot filter on
+// app_metadata.
+func (m *Manager) UsersWithRole(tenant, role string) ([]types.User, error) {
+	var users []types.User
+	err := auth.NewAdminUsersPaginator(m.client, m.PerPage).Walk(func(u types.User) error {
+		g, err := GrantsFromAppMetadata(u.AppMetadata)
+		if err != nil {
+			return fmt.Errorf("user %s: %w", u.ID, err)
+		}
+		if g.Has(tenant, role) {
+			users = append(users, u)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
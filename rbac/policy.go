@@ -0,0 +1,148 @@
+// Package rbac keeps role-based access control in app_metadata. Roles are
+// granted with merges that leave other app_metadata keys alone, and
+// permissions are checked against the claims of a verified access token
+// without a request to Auth.
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrUnknownRole = errors.New("unknown role")
+	ErrRoleCycle   = errors.New("roles inherit from each other in a cycle")
+)
+
+// Role is a named set of permissions.
+//
+// Permissions are strings such as "posts:read". A permission ending in ":*"
+// covers every permission with that prefix, and "*" covers everything.
+type Role struct {
+	Permissions []string `json:"permissions"`
+	// Inherits are roles whose permissions this role also has.
+	Inherits []string `json:"inherits,omitempty"`
+}
+
+// Policy defines the roles that can be granted and what they allow.
+type Policy struct {
+	roles map[string]Role
+	// permissions are the resolved permissions of each role, including
+	// inherited ones.
+	permissions map[string][]string
+}
+
+// NewPolicy returns a policy with the given roles. It fails if a role
+// inherits from a role that is not defined, or if inheritance has a cycle.
+func NewPolicy(roles map[string]Role) (*Policy, error) {
+	p := &Policy{
+		roles:       roles,
+		permissions: make(map[string][]string, len(roles)),
+	}
+	for name := range roles {
+		if _, err := p.resolve(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (p *Policy) resolve(name string, path []string) ([]string, error) {
+	if perms, ok := p.permissions[name]; ok {
+		return perms, nil
+	}
+	for _, n := range path {
+		if n == name {
+			return nil, fmt.Errorf("%w: %s", ErrRoleCycle, strings.Join(append(path, name), " -> "))
+		}
+	}
+	role, ok := p.roles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q inherited by %q", ErrUnknownRole, name, path[len(path)-1])
+	}
+
+	seen := map[string]bool{}
+	var perms []string
+	add := func(list []string) {
+		for _, perm := range list {
+			if !seen[perm] {
+				seen[perm] = true
+				perms = append(perms, perm)
+			}
+		}
+	}
+	add(role.Permissions)
+	for _, parent := range role.Inherits {
+		inherited, err := p.resolve(parent, append(path, name))
+		if err != nil {
+			return nil, err
+		}
+		add(inherited)
+	}
+	sort.Strings(perms)
+	p.permissions[name] = perms
+	return perms, nil
+}
+
+// HasRole reports whether the role is defined.
+func (p *Policy) HasRole(name string) bool {
+	_, ok := p.roles[name]
+	return ok
+}
+
+// Roles returns the names of the defined roles, sorted.
+func (p *Policy) Roles() []string {
+	names := make([]string, 0, len(p.roles))
+	for name := range p.roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Permissions returns the permissions of the roles, including inherited
+// ones, sorted. Roles that are not defined are ignored.
+func (p *Policy) Permissions(roles ...string) []string {
+	seen := map[string]bool{}
+	var perms []string
+	for _, role := range roles {
+		for _, perm := range p.permissions[role] {
+			if !seen[perm] {
+				seen[perm] = true
+				perms = append(perms, perm)
+			}
+		}
+	}
+	sort.Strings(perms)
+	return perms
+}
+
+// Allows reports whether any of the roles has the permission.
+func (p *Policy) Allows(roles []string, permission string) bool {
+	for _, role := range roles {
+		for _, perm := range p.permissions[role] {
+			if covers(perm, permission) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Can reports whether the grants allow the permission in the tenant. Global
+// roles apply in every tenant. An empty tenant only checks global roles.
+func (p *Policy) Can(g Grants, tenant, permission string) bool {
+	return p.Allows(g.RolesIn(tenant), permission)
+}
+
+func covers(granted, permission string) bool {
+	if granted == "*" || granted == permission {
+		return true
+	}
+	if prefix := strings.TrimSuffix(granted, "*"); prefix != granted && strings.HasSuffix(prefix, ":") {
+		return strings.HasPrefix(permission, prefix)
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package rbac_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supabase-community/auth-go/authtest"
+	"github.com/supabase-community/auth-go/rbac"
+	"github.com/supabase-community/auth-go/types"
+)
+
+func newPolicy(t *testing.T) *rbac.Policy {
+	policy, err := rbac.NewPolicy(map[string]rbac.Role{
+		"viewer": {Permissions: []string{"posts:read"}},
+		"editor": {Permissions: []string{"posts:write"}, Inherits: []string{"viewer"}},
+		"admin":  {Permissions: []string{"users:*"}, Inherits: []string{"editor"}},
+	})
+	require.NoError(t, err)
+	return policy
+}
+
+func TestPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	policy := newPolicy(t)
+	assert.Equal([]string{"admin", "editor", "viewer"}, policy.Roles())
+	assert.Equal([]string{"posts:read", "posts:write", "users:*"}, policy.Permissions("admin"))
+	assert.True(policy.Allows([]string{"editor"}, "posts:read"))
+	assert.False(policy.Allows([]string{"editor"}, "users:delete"))
+	assert.True(policy.Allows([]string{"admin"}, "users:delete"))
+	assert.False(policy.Allows([]string{"admin"}, "users"))
+	assert.False(policy.Allows([]string{"unknown"}, "posts:read"))
+
+	g := rbac.Grants{Roles: []string{"viewer"}, Tenants: map[string][]string{"acme": {"editor"}}}
+	assert.True(policy.Can(g, "acme", "posts:write"))
+	assert.False(policy.Can(g, "other", "posts:write"))
+	assert.True(policy.Can(g, "other", "posts:read"))
+	assert.False(policy.Can(g, "", "posts:write"))
+
+	_, err := rbac.NewPolicy(map[string]rbac.Role{"a": {Inherits: []string{"b"}}})
+	assert.ErrorIs(err, rbac.ErrUnknownRole)
+
+	_, err = rbac.NewPolicy(map[string]rbac.Role{
+		"a": {Inherits: []string{"b"}},
+		"b": {Inherits: []string{"a"}},
+	})
+	assert.ErrorIs(err, rbac.ErrRoleCycle)
+}
+
+func TestManager(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	srv := authtest.NewServer(authtest.DefaultConfig())
+	defer srv.Close()
+	client := srv.AdminClient()
+	manager := rbac.NewManager(client, newPolicy(t))
+	manager.PerPage = 1
+
+	password := "password"
+	alice, err := client.AdminCreateUser(types.AdminCreateUserRequest{
+		Email:        "alice@example.com",
+		Password:     &password,
+		EmailConfirm: true,
+		AppMetadata:  map[string]interface{}{"plan": "pro"},
+	})
+	require.NoError(err)
+	bob, err := client.AdminCreateUser(types.AdminCreateUserRequest{Email: "bob@example.com"})
+	require.NoError(err)
+
+	_, err = manager.Assign(alice.ID, "", "owner")
+	assert.ErrorIs(err, rbac.ErrUnknownRole)
+
+	_, err = manager.Assign(alice.ID, "", "viewer")
+	require.NoError(err)
+	user, err := manager.Assign(alice.ID, "acme", "editor")
+	require.NoError(err)
+	assert.Equal("pro", user.AppMetadata["plan"])
+	assert.Equal([]interface{}{"viewer"}, user.AppMetadata["roles"])
+
+	_, err = manager.Assign(bob.ID, "acme", "editor")
+	require.NoError(err)
+	_, err = manager.Assign(bob.ID, "acme", "editor")
+	require.NoError(err)
+
+	users, err := manager.UsersWithRole("acme", "editor")
+	require.NoError(err)
+	assert.Len(users, 2)
+	users, err = manager.UsersWithRole("", "viewer")
+	require.NoError(err)
+	require.Len(users, 1)
+	assert.Equal(alice.ID, users[0].ID)
+
+	user, err = manager.Revoke(bob.ID, "acme", "editor")
+	require.NoError(err)
+	assert.NotContains(user.AppMetadata, "tenant_roles")
+	g, err := manager.Grants(bob.ID)
+	require.NoError(err)
+	assert.Equal(rbac.Grants{}, g)
+
+	// Permissions are checked against the token, without calling Auth.
+	token, err := srv.Client().SignInWithEmailPassword("alice@example.com", password)
+	require.NoError(err)
+	subject, err := rbac.VerifyToken(token.AccessToken, []byte(authtest.DefaultConfig().JWTSecret))
+	require.NoError(err)
+	assert.Equal(alice.ID, subject.UserID)
+	assert.Equal([]string{"editor"}, subject.Tenants["acme"])
+	policy := newPolicy(t)
+	assert.True(policy.Can(subject.Grants, "acme", "posts:write"))
+	assert.False(policy.Can(subject.Grants, "", "posts:write"))
+
+	_, err = rbac.VerifyToken(token.AccessToken, []byte("wrong"))
+	assert.ErrorIs(err, rbac.ErrInvalidToken)
+}
+
+func TestVerifyTokenRejects(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	secret := []byte("secret")
+	claims := jwt.MapClaims{"sub": uuid.NewString(), "aud": rbac.Audience}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	require.NoError(err)
+	_, err = rbac.VerifyToken(token, secret)
+	assert.NoError(err)
+
+	claims["aud"] = "service"
+	token, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	require.NoError(err)
+	_, err = rbac.VerifyToken(token, secret)
+	assert.ErrorIs(err, rbac.ErrInvalidToken)
+
+	// An HS256 token must not verify against a public key used as the secret.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	claims["aud"] = rbac.Audience
+	token, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	require.NoError(err)
+	_, err = rbac.VerifyToken(token, &key.PublicKey)
+	assert.ErrorIs(err, rbac.ErrInvalidToken)
+
+	token, err = jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(key)
+	require.NoError(err)
+	_, err = rbac.VerifyToken(token, &key.PublicKey)
+	assert.NoError(err)
+	_, err = rbac.VerifyToken(token, secret)
+	assert.ErrorIs(err, rbac.ErrInvalidToken)
+
+	_, err = rbac.VerifyToken(token, "secret")
+	assert.Error(err)
+}
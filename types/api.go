@@ -23,8 +23,41 @@ func (e *ErrInvalidGenerateLinkRequest) Error() string {
 	return fmt.Sprintf("generate link request is invalid - %s", e.message)
 }
 
+// ErrUserNotFound is returned by AdminGetUserByEmail and AdminGetUserByPhone
+// when no user matches.
+type ErrUserNotFound struct {
+	Email string
+	Phone string
+}
+
+func (e *ErrUserNotFound) Error() string {
+	if e.Phone != "" {
+		return fmt.Sprintf("user not found with phone %s", e.Phone)
+	}
+	return fmt.Sprintf("user not found with email %s", e.Email)
+}
+
+// APIError is returned for a response with an unexpected status code. Use
+// errors.As to inspect it.
+type APIError struct {
+	StatusCode int
+	// ErrorCode is the error_code of the response body, e.g.
+	// "user_not_found", if it has one.
+	ErrorCode string
+	// Body is the response body, or nil if it could not be read.
+	Body []byte
+}
+
+func (e *APIError) Error() string {
+	if e.Body == nil {
+		return fmt.Sprintf("response status code %d", e.StatusCode)
+	}
+	return fmt.Sprintf("response status code %d: %s", e.StatusCode, e.Body)
+}
+
 var (
 	ErrInvalidAdminAuditRequest        = errors.New("admin audit request is invalid - if Query is not nil, then query Column must be author, action or type, and value must be given")
+	ErrInvalidAdminListUsersRequest    = errors.New("admin list users request is invalid - sort field must be created_at, and direction must be asc, desc or empty")
 	ErrInvalidAdminUpdateFactorRequest = errors.New("admin update factor request is invalid - nothing to update")
 	ErrInvalidTokenRequest             = errors.New("token request is invalid - grant_type must be either one of password, refresh_token, or pkce, email and password must be provided for grant_type=password, refresh_token must be provided for grant_type=refresh_token, auth_code and code_verifier must be provided for grant_type=pkce")
 	ErrInvalidVerifyRequest            = errors.New("verify request is invalid - type, token and redirect_to must be provided, and email or phone must be provided to VerifyForUser")
@@ -102,29 +135,61 @@ type AdminGenerateLinkResponse struct {
 }
 
 type AdminCreateUserRequest struct {
+	ID           *uuid.UUID             `json:"id,omitempty"` // A random ID is used if not set
 	Aud          string                 `json:"aud,omitempty"`
 	Role         string                 `json:"role,omitempty"`
 	Email        string                 `json:"email,omitempty"`
 	Phone        string                 `json:"phone,omitempty"`
-	Password     *string                `json:"password,omitempty"` // Only if type = signup
+	Password     *string                `json:"password,omitempty"`      // Only if type = signup
+	PasswordHash string                 `json:"password_hash,omitempty"` // A bcrypt or argon2 hash, instead of Password
 	EmailConfirm bool                   `json:"email_confirm,omitempty"`
 	PhoneConfirm bool                   `json:"phone_confirm,omitempty"`
 	UserMetadata map[string]interface{} `json:"user_metadata,omitempty"`
 	AppMetadata  map[string]interface{} `json:"app_metadata,omitempty"`
-	BanDuration  time.Duration          `json:"ban_duration,omitempty"` // Cannot be "none" when creating a user, so just set it or leave it empty
+	BanDuration  time.Duration          `json:"ban_duration,omitempty"` // Cannot be "none" when creating a user, so just set it or leave it empty. Sent as a duration string, e.g. "24h0m0s"
 }
 
 type AdminCreateUserResponse struct {
 	User
 }
 
+type SortDirection string
+
+const (
+	SortAscending  SortDirection = "asc"
+	SortDescending SortDirection = "desc"
+)
+
+type UserSortField string
+
+const (
+	UserSortFieldCreatedAt UserSortField = "created_at"
+)
+
+type UserSort struct {
+	Field UserSortField
+	// Direction defaults to descending if empty.
+	Direction SortDirection
+}
+
 type AdminListUsersRequest struct {
 	Page    *int
 	PerPage *int
+
+	// Filter, if provided, only returns users whose email or full name
+	// contains the value. The match is case insensitive.
+	Filter string
+	// Sort orders the users. By default, the newest users are returned first.
+	Sort []UserSort
 }
 
 type AdminListUsersResponse struct {
 	Users []User `json:"users"`
+
+	// Pagination
+	TotalCount int  `json:"-"`
+	TotalPages uint `json:"-"`
+	NextPage   uint `json:"-"`
 }
 
 type AdminGetUserRequest struct {
@@ -135,6 +200,14 @@ type AdminGetUserResponse struct {
 	User
 }
 
+type AdminGetUserByEmailRequest struct {
+	Email string
+}
+
+type AdminGetUserByPhoneRequest struct {
+	Phone string
+}
+
 type AdminUpdateUserRequest struct {
 	UserID uuid.UUID `json:"-"`
 
@@ -148,6 +221,10 @@ type AdminUpdateUserRequest struct {
 	UserMetadata map[string]interface{} `json:"user_metadata,omitempty"`
 	AppMetadata  map[string]interface{} `json:"app_metadata,omitempty"`
 	BanDuration  *BanDuration           `json:"ban_duration,omitempty"`
+
+	// Patch fields are sent even if empty, and take precedence over the
+	// fields above.
+	Patch AdminUserPatch `json:"-"`
 }
 
 type AdminUpdateUserResponse struct {
@@ -155,7 +232,12 @@ type AdminUpdateUserResponse struct {
 }
 
 type AdminDeleteUserRequest struct {
-	UserID uuid.UUID
+	UserID uuid.UUID `json:"-"`
+
+	// ShouldSoftDelete keeps the user with their personal data removed and
+	// DeletedAt set, instead of deleting them. The ID stays reserved and
+	// audit log entries still refer to it.
+	ShouldSoftDelete bool `json:"should_soft_delete,omitempty"`
 }
 
 type AdminListUserFactorsRequest struct {
@@ -403,9 +485,12 @@ type RecoverRequest struct {
 }
 
 type ResendRequest struct {
-	Email           string `json:"email,omitempty"`
-	Phone           string `json:"phone,omitempty"`
-	EmailRedirectTo string `json:"-"`
+	// Type is the message to resend: signup or email_change for emails, sms
+	// or phone_change for phones.
+	Type            VerificationType `json:"type,omitempty"`
+	Email           string           `json:"email,omitempty"`
+	Phone           string           `json:"phone,omitempty"`
+	EmailRedirectTo string           `json:"-"`
 }
 
 type ExternalProviders struct {
@@ -520,6 +605,10 @@ type UpdateUserRequest struct {
 	Data     map[string]interface{} `json:"data,omitempty"`
 	AppData  map[string]interface{} `json:"app_metadata,omitempty"`
 	Phone    string                 `json:"phone,omitempty"`
+
+	// Patch fields are sent even if empty, and take precedence over the
+	// fields above.
+	Patch UserPatch `json:"-"`
 }
 
 type UpdateUserResponse struct {
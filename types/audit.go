@@ -0,0 +1,155 @@
+package types
+
+// AuditAction is the action recorded in an audit log entry. Actions not
+// listed here are kept as they are, so new server versions don't lose
+// information.
+type AuditAction string
+
+const (
+	AuditActionLogin                       AuditAction = "login"
+	AuditActionLogout                      AuditAction = "logout"
+	AuditActionInviteAccepted              AuditAction = "invite_accepted"
+	AuditActionUserSignedUp                AuditAction = "user_signedup"
+	AuditActionUserInvited                 AuditAction = "user_invited"
+	AuditActionUserDeleted                 AuditAction = "user_deleted"
+	AuditActionUserModified                AuditAction = "user_modified"
+	AuditActionUserRecoveryRequested       AuditAction = "user_recovery_requested"
+	AuditActionUserReauthenticateRequested AuditAction = "user_reauthenticate_requested"
+	AuditActionUserConfirmationRequested   AuditAction = "user_confirmation_requested"
+	AuditActionUserRepeatedSignUp          AuditAction = "user_repeated_signup"
+	AuditActionUserUpdatedPassword         AuditAction = "user_updated_password"
+	AuditActionTokenRevoked                AuditAction = "token_revoked"
+	AuditActionTokenRefreshed              AuditAction = "token_refreshed"
+	AuditActionGenerateRecoveryCodes       AuditAction = "generate_recovery_codes"
+	AuditActionFactorInProgress            AuditAction = "factor_in_progress"
+	AuditActionFactorUnenrolled            AuditAction = "factor_unenrolled"
+	AuditActionChallengeCreated            AuditAction = "challenge_created"
+	AuditActionVerificationAttempted       AuditAction = "verification_attempted"
+	AuditActionFactorDeleted               AuditAction = "factor_deleted"
+	AuditActionFactorUpdated               AuditAction = "factor_updated"
+	AuditActionMFACodeLogin                AuditAction = "mfa_code_login"
+	AuditActionIdentityUnlinked            AuditAction = "identity_unlinked"
+)
+
+// AuditLogType groups audit actions.
+type AuditLogType string
+
+const (
+	AuditLogTypeAccount       AuditLogType = "account"
+	AuditLogTypeTeam          AuditLogType = "team"
+	AuditLogTypeToken         AuditLogType = "token"
+	AuditLogTypeUser          AuditLogType = "user"
+	AuditLogTypeFactor        AuditLogType = "factor"
+	AuditLogTypeRecoveryCodes AuditLogType = "recovery_codes"
+)
+
+var auditActionLogTypes = map[AuditAction]AuditLogType{
+	AuditActionLogin:                       AuditLogTypeAccount,
+	AuditActionLogout:                      AuditLogTypeAccount,
+	AuditActionInviteAccepted:              AuditLogTypeAccount,
+	AuditActionUserSignedUp:                AuditLogTypeTeam,
+	AuditActionUserInvited:                 AuditLogTypeTeam,
+	AuditActionUserDeleted:                 AuditLogTypeTeam,
+	AuditActionUserModified:                AuditLogTypeUser,
+	AuditActionUserRecoveryRequested:       AuditLogTypeUser,
+	AuditActionUserReauthenticateRequested: AuditLogTypeUser,
+	AuditActionUserConfirmationRequested:   AuditLogTypeUser,
+	AuditActionUserRepeatedSignUp:          AuditLogTypeUser,
+	AuditActionUserUpdatedPassword:         AuditLogTypeUser,
+	AuditActionTokenRevoked:                AuditLogTypeToken,
+	AuditActionTokenRefreshed:              AuditLogTypeToken,
+	AuditActionGenerateRecoveryCodes:       AuditLogTypeUser,
+	AuditActionFactorInProgress:            AuditLogTypeFactor,
+	AuditActionFactorUnenrolled:            AuditLogTypeFactor,
+	AuditActionChallengeCreated:            AuditLogTypeFactor,
+	AuditActionVerificationAttempted:       AuditLogTypeFactor,
+	AuditActionFactorDeleted:               AuditLogTypeFactor,
+	AuditActionFactorUpdated:               AuditLogTypeFactor,
+	AuditActionMFACodeLogin:                AuditLogTypeFactor,
+	AuditActionIdentityUnlinked:            AuditLogTypeAccount,
+}
+
+// Known reports whether the action is one of the actions listed above.
+func (a AuditAction) Known() bool {
+	_, ok := auditActionLogTypes[a]
+	return ok
+}
+
+// LogType returns the log type Auth records with the action, or "" if the
+// action is not known.
+func (a AuditAction) LogType() AuditLogType {
+	return auditActionLogTypes[a]
+}
+
+// AuditPayload is the decoded payload of an audit log entry.
+type AuditPayload struct {
+	Action  AuditAction
+	LogType AuditLogType
+
+	// ActorID is the ID of the user who took the action. For actions taken
+	// with an admin token, it is the subject of the token, which may be
+	// empty.
+	ActorID       string
+	ActorUsername string
+	ActorName     string
+	ActorViaSSO   bool
+
+	// Traits holds details that depend on the action, such as the provider
+	// used to log in.
+	Traits map[string]interface{}
+}
+
+// ParsePayload decodes the entry's payload. Missing or mistyped fields are
+// left empty.
+func (e AuditLogEntry) ParsePayload() AuditPayload {
+	p := AuditPayload{
+		Action:        AuditAction(payloadString(e.Payload, "action")),
+		LogType:       AuditLogType(payloadString(e.Payload, "log_type")),
+		ActorID:       payloadString(e.Payload, "actor_id"),
+		ActorUsername: payloadString(e.Payload, "actor_username"),
+		ActorName:     payloadString(e.Payload, "actor_name"),
+	}
+	p.ActorViaSSO, _ = e.Payload["actor_via_sso"].(bool)
+	p.Traits, _ = e.Payload["traits"].(map[string]interface{})
+	return p
+}
+
+// Action returns the action recorded in the entry.
+func (e AuditLogEntry) Action() AuditAction {
+	return AuditAction(payloadString(e.Payload, "action"))
+}
+
+// Trait returns a string trait, or "" if it is not set.
+func (p AuditPayload) Trait(key string) string {
+	return payloadString(p.Traits, key)
+}
+
+// Provider returns the provider trait recorded with logins and signups,
+// e.g. email, phone or google.
+func (p AuditPayload) Provider() string {
+	return p.Trait("provider")
+}
+
+func payloadString(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+// AuditQueryByAction returns a query for audit log entries with the action.
+//
+// Auth matches the value as a case insensitive substring, so querying for
+// login also returns mfa_code_login entries.
+func AuditQueryByAction(action AuditAction) *AuditQuery {
+	return &AuditQuery{Column: AuditQueryColumnAction, Value: string(action)}
+}
+
+// AuditQueryByType returns a query for audit log entries with the log type.
+func AuditQueryByType(logType AuditLogType) *AuditQuery {
+	return &AuditQuery{Column: AuditQueryColumnType, Value: string(logType)}
+}
+
+// AuditQueryByAuthor returns a query for audit log entries whose actor
+// username or name contains author.
+func AuditQueryByAuthor(author string) *AuditQuery {
+	return &AuditQuery{Column: AuditQueryColumnAuthor, Value: author}
+}
@@ -0,0 +1,65 @@
+package types_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supabase-community/auth-go/types"
+)
+
+func TestAuditLogEntryParsePayload(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var entry types.AuditLogEntry
+	require.NoError(json.Unmarshal([]byte(`{
+		"id": "8c6b7a4e-1d3f-4b8a-9e2d-5f6a7b8c9d0e",
+		"payload": {
+			"action": "login",
+			"actor_id": "3f2a1b0c-9d8e-4f7a-8b6c-5d4e3f2a1b0c",
+			"actor_username": "user@example.com",
+			"actor_via_sso": false,
+			"log_type": "account",
+			"traits": {"provider": "email"}
+		},
+		"created_at": "2024-01-01T00:00:00Z",
+		"ip_address": "127.0.0.1"
+	}`), &entry))
+
+	p := entry.ParsePayload()
+	assert.Equal(types.AuditActionLogin, p.Action)
+	assert.Equal(types.AuditActionLogin, entry.Action())
+	assert.Equal(types.AuditLogTypeAccount, p.LogType)
+	assert.Equal("3f2a1b0c-9d8e-4f7a-8b6c-5d4e3f2a1b0c", p.ActorID)
+	assert.Equal("user@example.com", p.ActorUsername)
+	assert.Equal("email", p.Provider())
+	assert.Equal("", p.Trait("missing"))
+}
+
+func TestAuditActionUnknown(t *testing.T) {
+	assert := assert.New(t)
+
+	entry := types.AuditLogEntry{Payload: map[string]interface{}{
+		"action":   "passkey_registered",
+		"log_type": 3,
+	}}
+	p := entry.ParsePayload()
+	assert.Equal(types.AuditAction("passkey_registered"), p.Action)
+	assert.False(p.Action.Known())
+	assert.Equal(types.AuditLogType(""), p.Action.LogType())
+	assert.Equal(types.AuditLogType(""), p.LogType)
+
+	assert.True(types.AuditActionTokenRefreshed.Known())
+	assert.Equal(types.AuditLogTypeToken, types.AuditActionTokenRefreshed.LogType())
+}
+
+func TestAuditQueryBuilders(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(&types.AuditQuery{Column: types.AuditQueryColumnAction, Value: "user_signedup"}, types.AuditQueryByAction(types.AuditActionUserSignedUp))
+	assert.Equal(&types.AuditQuery{Column: types.AuditQueryColumnType, Value: "factor"}, types.AuditQueryByType(types.AuditLogTypeFactor))
+	assert.Equal(&types.AuditQuery{Column: types.AuditQueryColumnAuthor, Value: "admin"}, types.AuditQueryByAuthor("admin"))
+}
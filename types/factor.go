@@ -14,3 +14,10 @@ type Factor struct {
 	FriendlyName string    `json:"friendly_name,omitempty"`
 	FactorType   string    `json:"factor_type"`
 }
+
+// Factor statuses. A factor is unverified until the user verifies a code
+// from it for the first time.
+const (
+	FactorStatusUnverified = "unverified"
+	FactorStatusVerified   = "verified"
+)
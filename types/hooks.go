@@ -0,0 +1,48 @@
+package types
+
+import (
+	"github.com/google/uuid"
+)
+
+type HookDecision string
+
+const (
+	HookDecisionContinue HookDecision = "continue"
+	HookDecisionReject   HookDecision = "reject"
+)
+
+// Payload sent by Auth to the password verification attempt hook.
+type PasswordVerificationAttemptInput struct {
+	UserID uuid.UUID `json:"user_id"`
+	Valid  bool      `json:"valid"`
+}
+
+type PasswordVerificationAttemptOutput struct {
+	Decision         HookDecision `json:"decision"`
+	Message          string       `json:"message,omitempty"`
+	ShouldLogoutUser bool         `json:"should_logout_user,omitempty"`
+}
+
+// Payload sent by Auth to the MFA verification attempt hook.
+type MFAVerificationAttemptInput struct {
+	UserID     uuid.UUID  `json:"user_id"`
+	FactorID   uuid.UUID  `json:"factor_id"`
+	FactorType FactorType `json:"factor_type"`
+	Valid      bool       `json:"valid"`
+}
+
+type MFAVerificationAttemptOutput struct {
+	Decision HookDecision `json:"decision"`
+	Message  string       `json:"message,omitempty"`
+}
+
+// HookError is returned by a hook to make Auth fail the request with the
+// given HTTP status code and message.
+type HookError struct {
+	HTTPCode int    `json:"http_code"`
+	Message  string `json:"message"`
+}
+
+type HookErrorResponse struct {
+	Error HookError `json:"error"`
+}
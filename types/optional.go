@@ -0,0 +1,142 @@
+package types
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Optional is a request field that tells "unchanged" apart from an empty
+// value. The zero Optional is unset and is left out of the request; a set
+// Optional is always sent, even if it holds "", false or nil.
+type Optional[T any] struct {
+	value T
+	set   bool
+}
+
+// Set returns an Optional holding v.
+func Set[T any](v T) Optional[T] {
+	return Optional[T]{value: v, set: true}
+}
+
+// IsSet reports whether the field holds a value.
+func (o Optional[T]) IsSet() bool {
+	return o.set
+}
+
+// Get returns the value and whether it was set.
+func (o Optional[T]) Get() (T, bool) {
+	return o.value, o.set
+}
+
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if !o.set {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.value)
+}
+
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	o.value = v
+	o.set = true
+	return nil
+}
+
+// AdminUserPatch holds fields of an AdminUpdateUserRequest that are sent
+// whenever they are set, even to an empty value.
+//
+// Sending a value does not mean Auth applies it. Auth ignores an empty email
+// or phone and a false email_confirm or phone_confirm, so Set("") does not
+// clear a phone number or email and Set(false) does not un-confirm one.
+// These are limits of the Auth admin API, and this package has no way
+// around them.
+//
+// AdminCreateUserRequest has no patch: a new user has nothing to leave
+// unchanged, so its zero values are left out of the request as before.
+type AdminUserPatch struct {
+	Aud          Optional[string]                 `json:"aud"`
+	Role         Optional[string]                 `json:"role"`
+	Email        Optional[string]                 `json:"email"`
+	Phone        Optional[string]                 `json:"phone"`
+	Password     Optional[string]                 `json:"password"`
+	EmailConfirm Optional[bool]                   `json:"email_confirm"`
+	PhoneConfirm Optional[bool]                   `json:"phone_confirm"`
+	UserMetadata Optional[map[string]interface{}] `json:"user_metadata"`
+	AppMetadata  Optional[map[string]interface{}] `json:"app_metadata"`
+	BanDuration  Optional[BanDuration]            `json:"ban_duration"`
+}
+
+// UserPatch holds fields of an UpdateUserRequest that are sent whenever they
+// are set.
+type UserPatch struct {
+	Email    Optional[string]                 `json:"email"`
+	Phone    Optional[string]                 `json:"phone"`
+	Password Optional[string]                 `json:"password"`
+	Nonce    Optional[string]                 `json:"nonce"`
+	Data     Optional[map[string]interface{}] `json:"data"`
+	AppData  Optional[map[string]interface{}] `json:"app_metadata"`
+}
+
+type optional interface {
+	IsSet() bool
+}
+
+// marshalPatched marshals v and then overrides its fields with the set
+// fields of patch, which must be a struct of Optional fields.
+func marshalPatched(v interface{}, patch interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	pv := reflect.ValueOf(patch)
+	pt := pv.Type()
+	patched := false
+	for i := 0; i < pt.NumField(); i++ {
+		o, ok := pv.Field(i).Interface().(optional)
+		if !ok || !o.IsSet() {
+			continue
+		}
+		name, _, _ := strings.Cut(pt.Field(i).Tag.Get("json"), ",")
+		value, err := json.Marshal(o)
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = value
+		patched = true
+	}
+	if !patched {
+		return data, nil
+	}
+	return json.Marshal(fields)
+}
+
+func (r AdminCreateUserRequest) MarshalJSON() ([]byte, error) {
+	type request AdminCreateUserRequest
+	var banDuration string
+	if r.BanDuration != 0 {
+		banDuration = r.BanDuration.String()
+	}
+	return json.Marshal(struct {
+		request
+		BanDuration string `json:"ban_duration,omitempty"`
+	}{request(r), banDuration})
+}
+
+func (r AdminUpdateUserRequest) MarshalJSON() ([]byte, error) {
+	type request AdminUpdateUserRequest
+	return marshalPatched(request(r), r.Patch)
+}
+
+func (r UpdateUserRequest) MarshalJSON() ([]byte, error) {
+	type request UpdateUserRequest
+	return marshalPatched(request(r), r.Patch)
+}
@@ -0,0 +1,67 @@
+package types_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/supabase-community/auth-go/types"
+)
+
+func TestOptional(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var o types.Optional[bool]
+	assert.False(o.IsSet())
+	o = types.Set(false)
+	v, ok := o.Get()
+	assert.True(ok)
+	assert.False(v)
+
+	var decoded struct {
+		Email types.Optional[string] `json:"email"`
+		Phone types.Optional[string] `json:"phone"`
+	}
+	require.NoError(json.Unmarshal([]byte(`{"email":""}`), &decoded))
+	assert.True(decoded.Email.IsSet())
+	assert.False(decoded.Phone.IsSet())
+
+	id := uuid.MustParse("3f1b4b5e-8f64-4a4f-9d8e-2b7b0f4b9c11")
+	b, err := json.Marshal(types.AdminUpdateUserRequest{
+		UserID: id,
+		Email:  "a@example.com",
+		Role:   "admin",
+		Patch: types.AdminUserPatch{
+			Phone:        types.Set(""),
+			EmailConfirm: types.Set(false),
+			Role:         types.Set(""),
+			BanDuration:  types.Set(types.BanDurationNone()),
+		},
+	})
+	require.NoError(err)
+	assert.JSONEq(`{"email":"a@example.com","role":"","phone":"","email_confirm":false,"ban_duration":"none"}`, string(b))
+
+	b, err = json.Marshal(types.AdminUpdateUserRequest{UserID: id, EmailConfirm: true})
+	require.NoError(err)
+	assert.JSONEq(`{"email_confirm":true}`, string(b))
+
+	b, err = json.Marshal(types.UpdateUserRequest{
+		Data:  map[string]interface{}{"name": "a"},
+		Patch: types.UserPatch{Nonce: types.Set("")},
+	})
+	require.NoError(err)
+	assert.JSONEq(`{"data":{"name":"a"},"nonce":""}`, string(b))
+
+	b, err = json.Marshal(types.AdminCreateUserRequest{Email: "a@example.com", BanDuration: 24 * time.Hour})
+	require.NoError(err)
+	assert.JSONEq(`{"email":"a@example.com","ban_duration":"24h0m0s"}`, string(b))
+
+	b, err = json.Marshal(&types.AdminCreateUserRequest{Email: "a@example.com"})
+	require.NoError(err)
+	assert.JSONEq(`{"email":"a@example.com"}`, string(b))
+}
@@ -41,6 +41,10 @@ type User struct {
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
 	BannedUntil *time.Time `json:"banned_until,omitempty"`
+	// DeletedAt is set for users that were soft deleted.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// IsAnonymous is set for users created by an anonymous sign-in.
+	IsAnonymous bool `json:"is_anonymous"`
 
 	// ConfirmedAt is deprecated. Use EmailConfirmedAt or PhoneConfirmedAt instead.
 	ConfirmedAt time.Time `json:"confirmed_at"`
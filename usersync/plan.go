@@ -0,0 +1,123 @@
+package usersync
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/supabase-community/auth-go/types"
+)
+
+// ChangeKind is what a change does to the target project.
+type ChangeKind string
+
+const (
+	ChangeCreate ChangeKind = "create"
+	ChangeUpdate ChangeKind = "update"
+	ChangeDelete ChangeKind = "delete"
+)
+
+// FieldDiff is a field that differs between the source and target. Metadata
+// keys are compared one at a time, as "user_metadata.<key>".
+type FieldDiff struct {
+	Field  string      `json:"field"`
+	Source interface{} `json:"source"`
+	Target interface{} `json:"target"`
+}
+
+// UserChange is a change to a user in the target project.
+type UserChange struct {
+	Kind ChangeKind `json:"kind"`
+	// Key is the email, or the phone for users without an email, that the
+	// users were matched on.
+	Key string `json:"key"`
+	// Source is the user after mapping rules, or nil for deletes.
+	Source *types.User `json:"source,omitempty"`
+	// Target is the matched user, or nil for creates.
+	Target *types.User `json:"target,omitempty"`
+	Diff   []FieldDiff `json:"diff,omitempty"`
+}
+
+// ProviderChange is a change to an SSO provider in the target project.
+type ProviderChange struct {
+	Kind ChangeKind `json:"kind"`
+	// Key is the SAML entity ID the providers were matched on.
+	Key    string             `json:"key"`
+	Source *types.SSOProvider `json:"source,omitempty"`
+	Target *types.SSOProvider `json:"target,omitempty"`
+	Diff   []FieldDiff        `json:"diff,omitempty"`
+}
+
+// Conflict is a difference the Syncer did not resolve, which is left for a
+// person to fix.
+type Conflict struct {
+	Key    string      `json:"key"`
+	Reason string      `json:"reason"`
+	Diff   []FieldDiff `json:"diff,omitempty"`
+}
+
+// Plan lists the changes that Apply would make to the target project.
+type Plan struct {
+	Users     []UserChange     `json:"users"`
+	Providers []ProviderChange `json:"providers"`
+	Conflicts []Conflict       `json:"conflicts"`
+	// Unchanged is the number of matched users that are already in sync.
+	Unchanged int `json:"unchanged"`
+}
+
+// Empty reports whether the plan has no changes to apply.
+func (p *Plan) Empty() bool {
+	return len(p.Users) == 0 && len(p.Providers) == 0
+}
+
+var changeSymbols = map[ChangeKind]string{
+	ChangeCreate: "+",
+	ChangeUpdate: "~",
+	ChangeDelete: "-",
+}
+
+// WriteText writes the plan for review, one line per change: + for creates,
+// ~ for updates, - for deletes and ! for conflicts.
+func (p *Plan) WriteText(w io.Writer) error {
+	var b strings.Builder
+	for _, c := range p.Providers {
+		fmt.Fprintf(&b, "%s sso provider %s%s\n", changeSymbols[c.Kind], c.Key, formatDiff(c.Diff))
+	}
+	for _, c := range p.Users {
+		fmt.Fprintf(&b, "%s user %s%s\n", changeSymbols[c.Kind], c.Key, formatDiff(c.Diff))
+	}
+	for _, c := range p.Conflicts {
+		fmt.Fprintf(&b, "! conflict %s: %s%s\n", c.Key, c.Reason, formatDiff(c.Diff))
+	}
+	fmt.Fprintf(&b, "%d user changes, %d provider changes, %d conflicts, %d unchanged\n",
+		len(p.Users), len(p.Providers), len(p.Conflicts), p.Unchanged)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func formatDiff(diff []FieldDiff) string {
+	if len(diff) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(diff))
+	for _, d := range diff {
+		parts = append(parts, fmt.Sprintf("%s %s -> %s", d.Field, formatValue(d.Target), formatValue(d.Source)))
+	}
+	return " (" + strings.Join(parts, "; ") + ")"
+}
+
+func formatValue(v interface{}) string {
+	if v == nil {
+		return "<unset>"
+	}
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
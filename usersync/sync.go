@@ -0,0 +1,647 @@
+// Package usersync copies and reconciles users and SSO providers between two
+// Auth projects, such as staging and production.
+package usersync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/internal/normalize"
+	"github.com/supabase-community/auth-go/internal/ratelimit"
+	"github.com/supabase-community/auth-go/types"
+)
+
+// ConflictPolicy decides what happens when a matched user or provider has a
+// different value in the target project.
+type ConflictPolicy string
+
+const (
+	// ConflictSourceWins overwrites target values with source values.
+	ConflictSourceWins ConflictPolicy = "source_wins"
+	// ConflictTargetWins only fills in values that are unset in the target.
+	ConflictTargetWins ConflictPolicy = "target_wins"
+	// ConflictSkip leaves users and providers with differing values alone,
+	// and lists them as conflicts in the plan. Unset values are still filled
+	// in for users and providers without differing values.
+	ConflictSkip ConflictPolicy = "skip"
+)
+
+// Rule maps a source user before it is compared with the target, e.g. to
+// rewrite emails or drop metadata. It returns false to leave the user out of
+// the sync.
+type Rule func(u *types.User) bool
+
+// OnlyEmailDomains is a Rule that only syncs users with an email at one of
+// the domains.
+func OnlyEmailDomains(domains ...string) Rule {
+	return func(u *types.User) bool {
+		_, domain, ok := strings.Cut(normalize.Email(u.Email), "@")
+		if !ok {
+			return false
+		}
+		for _, d := range domains {
+			if strings.EqualFold(domain, d) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// RewriteEmailDomain is a Rule that moves emails at domain from to domain to,
+// e.g. to keep production addresses out of staging.
+func RewriteEmailDomain(from, to string) Rule {
+	return func(u *types.User) bool {
+		local, domain, ok := strings.Cut(u.Email, "@")
+		if ok && strings.EqualFold(domain, from) {
+			u.Email = local + "@" + to
+		}
+		return true
+	}
+}
+
+// DropUserMetadata is a Rule that leaves the keys out of user metadata.
+func DropUserMetadata(keys ...string) Rule {
+	return func(u *types.User) bool {
+		u.UserMetadata = without(u.UserMetadata, keys)
+		return true
+	}
+}
+
+// DropAppMetadata is a Rule that leaves the keys out of app metadata.
+func DropAppMetadata(keys ...string) Rule {
+	return func(u *types.User) bool {
+		u.AppMetadata = without(u.AppMetadata, keys)
+		return true
+	}
+}
+
+func without(m map[string]interface{}, keys []string) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	for _, k := range keys {
+		delete(out, k)
+	}
+	return out
+}
+
+// managedAppMetadata are app metadata keys that Auth maintains itself.
+var managedAppMetadata = []string{"provider", "providers"}
+
+// Syncer makes the users and, optionally, the SSO providers of a target
+// project match a source project.
+//
+// Users are matched by email, or by phone for users without an email. A
+// user whose email and phone match different target users, or whose phone
+// matches a target user when its email matches none, is a conflict. Only
+// fields that can be set through the admin API are synced: email, phone,
+// role, confirmations and metadata. Passwords and identities are not, so
+// created users must reset their password or sign in another way. Metadata
+// keys are synced one at a time, and keys only in the target are kept.
+type Syncer struct {
+	source auth.Client
+	target auth.Client
+
+	// Rules are applied to each source user in order.
+	Rules []Rule
+	// Filter selects the target users the sync manages. Target users it
+	// rejects are never matched, updated or deleted. If nil, every target
+	// user is managed.
+	Filter func(u types.User) bool
+	// OnConflict defaults to ConflictSourceWins.
+	OnConflict ConflictPolicy
+	// Delete removes managed target users, and SSO providers if SSO is set,
+	// that have no match in the source.
+	Delete bool
+	// SSO also syncs SAML SSO providers, matched by entity ID.
+	SSO bool
+	// PreserveIDs creates users with the same ID as in the source.
+	PreserveIDs bool
+	// PerPage is the page size used to list users. Defaults to the server
+	// default.
+	PerPage int
+	// RateLimit is the maximum number of requests per second made by Apply.
+	// If zero, requests are not limited.
+	RateLimit float64
+}
+
+// NewSyncer returns a Syncer from source to target. Both clients must have
+// an admin token; the source is only read.
+func NewSyncer(source, target auth.Client) *Syncer {
+	return &Syncer{source: source, target: target}
+}
+
+// Plan compares the projects and returns the changes Apply would make,
+// without changing anything.
+func (s *Syncer) Plan() (*Plan, error) {
+	plan := &Plan{
+		Users:     []UserChange{},
+		Providers: []ProviderChange{},
+		Conflicts: []Conflict{},
+	}
+	if err := s.planUsers(plan); err != nil {
+		return nil, err
+	}
+	if s.SSO {
+		if err := s.planProviders(plan); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+func (s *Syncer) listUsers(c auth.Client) ([]types.User, error) {
+	var users []types.User
+	seen := make(map[string]bool)
+	err := auth.NewAdminUsersPaginator(c, s.PerPage).Walk(func(u types.User) error {
+		if !seen[u.ID.String()] {
+			seen[u.ID.String()] = true
+			users = append(users, u)
+		}
+		return nil
+	})
+	return users, err
+}
+
+func (s *Syncer) planUsers(plan *Plan) error {
+	sources, err := s.listUsers(s.source)
+	if err != nil {
+		return fmt.Errorf("failed to list source users: %w", err)
+	}
+	targets, err := s.listUsers(s.target)
+	if err != nil {
+		return fmt.Errorf("failed to list target users: %w", err)
+	}
+
+	byEmail := make(map[string]*types.User)
+	byPhone := make(map[string]*types.User)
+	for i := range targets {
+		t := &targets[i]
+		if s.Filter != nil && !s.Filter(*t) {
+			continue
+		}
+		if email := normalize.Email(t.Email); email != "" {
+			byEmail[email] = t
+		}
+		if phone := normalize.Phone(t.Phone); phone != "" {
+			byPhone[phone] = t
+		}
+	}
+
+	matched := make(map[*types.User]bool)
+	for i := range sources {
+		src := sources[i]
+		src.UserMetadata = without(src.UserMetadata, nil)
+		src.AppMetadata = without(src.AppMetadata, managedAppMetadata)
+		if !s.applyRules(&src) {
+			continue
+		}
+
+		key := normalize.Email(src.Email)
+		target := byEmail[key]
+		if key == "" {
+			key = normalize.Phone(src.Phone)
+			target = byPhone[key]
+		}
+		if key == "" {
+			continue
+		}
+		if byPhone := byPhone[normalize.Phone(src.Phone)]; byPhone != nil && byPhone != target {
+			reason := fmt.Sprintf("email matches no user but phone matches user %s", byPhone.ID)
+			if target != nil {
+				reason = fmt.Sprintf("email matches user %s but phone matches user %s", target.ID, byPhone.ID)
+				matched[target] = true
+			}
+			plan.Conflicts = append(plan.Conflicts, Conflict{Key: key, Reason: reason})
+			matched[byPhone] = true
+			continue
+		}
+
+		if target == nil {
+			plan.Users = append(plan.Users, UserChange{Kind: ChangeCreate, Key: key, Source: &src})
+			continue
+		}
+		matched[target] = true
+
+		diff, conflict := s.resolve(diffUsers(&src, target))
+		switch {
+		case conflict:
+			plan.Conflicts = append(plan.Conflicts, Conflict{Key: key, Reason: "user differs in the target", Diff: diffUsers(&src, target)})
+		case len(diff) == 0:
+			plan.Unchanged++
+		default:
+			plan.Users = append(plan.Users, UserChange{Kind: ChangeUpdate, Key: key, Source: &src, Target: target, Diff: diff})
+		}
+	}
+
+	if s.Delete {
+		for i := range targets {
+			t := &targets[i]
+			if matched[t] || (s.Filter != nil && !s.Filter(*t)) {
+				continue
+			}
+			key := normalize.Email(t.Email)
+			if key == "" {
+				key = normalize.Phone(t.Phone)
+			}
+			if key == "" {
+				key = t.ID.String()
+			}
+			plan.Users = append(plan.Users, UserChange{Kind: ChangeDelete, Key: key, Target: t})
+		}
+	}
+	sortChanges(plan.Users)
+	sort.SliceStable(plan.Conflicts, func(i, j int) bool {
+		return plan.Conflicts[i].Key < plan.Conflicts[j].Key
+	})
+	return nil
+}
+
+var changeOrder = map[ChangeKind]int{ChangeCreate: 0, ChangeUpdate: 1, ChangeDelete: 2}
+
+// sortChanges orders changes by kind, then key, so plans are easy to review
+// and compare.
+func sortChanges(changes []UserChange) {
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Kind != changes[j].Kind {
+			return changeOrder[changes[i].Kind] < changeOrder[changes[j].Kind]
+		}
+		return changes[i].Key < changes[j].Key
+	})
+}
+
+func (s *Syncer) applyRules(u *types.User) bool {
+	for _, rule := range s.Rules {
+		if !rule(u) {
+			return false
+		}
+	}
+	return true
+}
+
+// resolve applies the conflict policy to a diff, returning the fields to
+// change, or true if the difference is a conflict to skip.
+func (s *Syncer) resolve(diff []FieldDiff) ([]FieldDiff, bool) {
+	if s.OnConflict == "" || s.OnConflict == ConflictSourceWins {
+		return diff, false
+	}
+	var fill []FieldDiff
+	for _, d := range diff {
+		if isUnset(d.Target) {
+			fill = append(fill, d)
+		} else if s.OnConflict == ConflictSkip {
+			return nil, true
+		}
+	}
+	return fill, false
+}
+
+func isUnset(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Slice, reflect.Map:
+		return rv.Len() == 0
+	}
+	return false
+}
+
+func diffUsers(src, target *types.User) []FieldDiff {
+	var diff []FieldDiff
+	add := func(field string, s, t interface{}) {
+		if !reflect.DeepEqual(s, t) {
+			diff = append(diff, FieldDiff{Field: field, Source: s, Target: t})
+		}
+	}
+	if src.Email != "" {
+		add("email", normalize.Email(src.Email), normalize.Email(target.Email))
+	}
+	if src.Phone != "" {
+		add("phone", normalize.Phone(src.Phone), normalize.Phone(target.Phone))
+	}
+	if src.Role != "" {
+		add("role", src.Role, target.Role)
+	}
+	// Confirmations can't be undone through the admin API.
+	if src.EmailConfirmedAt != nil && target.EmailConfirmedAt == nil {
+		add("email_confirmed", true, false)
+	}
+	if src.PhoneConfirmedAt != nil && target.PhoneConfirmedAt == nil {
+		add("phone_confirmed", true, false)
+	}
+	diff = append(diff, diffMetadata("user_metadata", src.UserMetadata, target.UserMetadata)...)
+	diff = append(diff, diffMetadata("app_metadata", src.AppMetadata, target.AppMetadata)...)
+	return diff
+}
+
+func diffMetadata(field string, src, target map[string]interface{}) []FieldDiff {
+	keys := make([]string, 0, len(src))
+	for k := range src {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var diff []FieldDiff
+	for _, k := range keys {
+		s, t := normalizeJSON(src[k]), normalizeJSON(target[k])
+		if !reflect.DeepEqual(s, t) {
+			diff = append(diff, FieldDiff{Field: field + "." + k, Source: s, Target: t})
+		}
+	}
+	return diff
+}
+
+// normalizeJSON converts a value to the types encoding/json decodes into, so
+// values set by rules compare equal to values read from Auth.
+func normalizeJSON(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+func (s *Syncer) planProviders(plan *Plan) error {
+	sources, err := s.source.AdminListSSOProviders()
+	if err != nil {
+		return fmt.Errorf("failed to list source SSO providers: %w", err)
+	}
+	targets, err := s.target.AdminListSSOProviders()
+	if err != nil {
+		return fmt.Errorf("failed to list target SSO providers: %w", err)
+	}
+
+	byEntityID := make(map[string]*types.SSOProvider)
+	for i := range targets.Providers {
+		t := &targets.Providers[i]
+		byEntityID[t.SAMLProvider.EntityID] = t
+	}
+
+	matched := make(map[*types.SSOProvider]bool)
+	for i := range sources.Providers {
+		src := &sources.Providers[i]
+		key := src.SAMLProvider.EntityID
+		target := byEntityID[key]
+		if target == nil {
+			plan.Providers = append(plan.Providers, ProviderChange{Kind: ChangeCreate, Key: key, Source: src})
+			continue
+		}
+		matched[target] = true
+
+		diff, conflict := s.resolve(diffProviders(src, target))
+		switch {
+		case conflict:
+			plan.Conflicts = append(plan.Conflicts, Conflict{Key: key, Reason: "SSO provider differs in the target", Diff: diffProviders(src, target)})
+		case len(diff) == 0:
+		default:
+			plan.Providers = append(plan.Providers, ProviderChange{Kind: ChangeUpdate, Key: key, Source: src, Target: target, Diff: diff})
+		}
+	}
+
+	if s.Delete {
+		for i := range targets.Providers {
+			t := &targets.Providers[i]
+			if !matched[t] {
+				plan.Providers = append(plan.Providers, ProviderChange{Kind: ChangeDelete, Key: t.SAMLProvider.EntityID, Target: t})
+			}
+		}
+	}
+	return nil
+}
+
+func diffProviders(src, target *types.SSOProvider) []FieldDiff {
+	var diff []FieldDiff
+	add := func(field string, s, t interface{}) {
+		if !reflect.DeepEqual(s, t) {
+			diff = append(diff, FieldDiff{Field: field, Source: s, Target: t})
+		}
+	}
+	add("domains", domains(src), domains(target))
+	add("metadata_url", metadataURL(src), metadataURL(target))
+	if metadataURL(src) == "" {
+		add("metadata_xml", src.SAMLProvider.MetadataXML, target.SAMLProvider.MetadataXML)
+	}
+	add("attribute_mapping", normalizeJSON(src.SAMLProvider.AttributeMapping), normalizeJSON(target.SAMLProvider.AttributeMapping))
+	return diff
+}
+
+func domains(p *types.SSOProvider) []string {
+	out := make([]string, 0, len(p.SSODomains))
+	for _, d := range p.SSODomains {
+		out = append(out, strings.ToLower(d.Domain))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func metadataURL(p *types.SSOProvider) string {
+	if p.SAMLProvider.MetadataURL == nil {
+		return ""
+	}
+	return *p.SAMLProvider.MetadataURL
+}
+
+// Result is the outcome of Apply.
+type Result struct {
+	Applied int
+	Errors  []*ChangeError
+}
+
+// ChangeError is a change that Apply could not make.
+type ChangeError struct {
+	// Object is "user" or "sso provider".
+	Object string
+	Kind   ChangeKind
+	Key    string
+	Err    error
+}
+
+func (e *ChangeError) Error() string {
+	return fmt.Sprintf("failed to %s %s %s: %v", e.Kind, e.Object, e.Key, e.Err)
+}
+
+func (e *ChangeError) Unwrap() error {
+	return e.Err
+}
+
+// Apply makes the changes in the plan. A change that fails doesn't stop the
+// others; it is recorded in the result. Apply returns an error only if ctx
+// is cancelled.
+//
+// SSO providers are created and updated first, so users of their domains
+// can be matched to them, and deleted last.
+func (s *Syncer) Apply(ctx context.Context, plan *Plan) (*Result, error) {
+	limiter := ratelimit.New(s.RateLimit)
+	result := &Result{}
+	record := func(object string, kind ChangeKind, key string, err error) {
+		if err != nil {
+			result.Errors = append(result.Errors, &ChangeError{Object: object, Kind: kind, Key: key, Err: err})
+		} else {
+			result.Applied++
+		}
+	}
+
+	for _, c := range plan.Providers {
+		if c.Kind == ChangeDelete {
+			continue
+		}
+		if err := limiter.Wait(ctx); err != nil {
+			return result, err
+		}
+		record("sso provider", c.Kind, c.Key, s.applyProvider(c))
+	}
+	for _, c := range plan.Users {
+		if err := limiter.Wait(ctx); err != nil {
+			return result, err
+		}
+		record("user", c.Kind, c.Key, s.applyUser(c))
+	}
+	for _, c := range plan.Providers {
+		if c.Kind != ChangeDelete {
+			continue
+		}
+		if err := limiter.Wait(ctx); err != nil {
+			return result, err
+		}
+		record("sso provider", c.Kind, c.Key, s.applyProvider(c))
+	}
+	return result, nil
+}
+
+func (s *Syncer) applyUser(c UserChange) error {
+	switch c.Kind {
+	case ChangeCreate:
+		src := c.Source
+		req := types.AdminCreateUserRequest{
+			Email:        src.Email,
+			Phone:        src.Phone,
+			Role:         src.Role,
+			EmailConfirm: src.EmailConfirmedAt != nil,
+			PhoneConfirm: src.PhoneConfirmedAt != nil,
+			UserMetadata: src.UserMetadata,
+			AppMetadata:  src.AppMetadata,
+		}
+		if s.PreserveIDs {
+			id := src.ID
+			req.ID = &id
+		}
+		_, err := s.target.AdminCreateUser(req)
+		return err
+
+	case ChangeUpdate:
+		req := types.AdminUpdateUserRequest{UserID: c.Target.ID}
+		for _, d := range c.Diff {
+			switch {
+			case d.Field == "email":
+				req.Email = c.Source.Email
+			case d.Field == "phone":
+				req.Phone = c.Source.Phone
+			case d.Field == "role":
+				req.Role = c.Source.Role
+			case d.Field == "email_confirmed":
+				req.EmailConfirm = true
+			case d.Field == "phone_confirmed":
+				req.PhoneConfirm = true
+			case strings.HasPrefix(d.Field, "user_metadata."):
+				req.UserMetadata = setKey(req.UserMetadata, strings.TrimPrefix(d.Field, "user_metadata."), d.Source)
+			case strings.HasPrefix(d.Field, "app_metadata."):
+				req.AppMetadata = setKey(req.AppMetadata, strings.TrimPrefix(d.Field, "app_metadata."), d.Source)
+			}
+		}
+		_, err := s.target.AdminUpdateUser(req)
+		return err
+
+	case ChangeDelete:
+		return s.target.AdminDeleteUser(types.AdminDeleteUserRequest{UserID: c.Target.ID})
+	}
+	return fmt.Errorf("unknown change kind %q", c.Kind)
+}
+
+func setKey(m map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	if m == nil {
+		m = make(map[string]interface{})
+	}
+	m[key] = value
+	return m
+}
+
+func (s *Syncer) applyProvider(c ProviderChange) error {
+	switch c.Kind {
+	case ChangeCreate:
+		src := c.Source
+		req := types.AdminCreateSSOProviderRequest{
+			Type:             "saml",
+			MetadataURL:      metadataURL(src),
+			Domains:          domains(src),
+			AttributeMapping: src.SAMLProvider.AttributeMapping,
+		}
+		if req.MetadataURL == "" {
+			req.MetadataXML = src.SAMLProvider.MetadataXML
+		}
+		if src.ResourceID != nil {
+			req.ResourceID = *src.ResourceID
+		}
+		_, err := s.target.AdminCreateSSOProvider(req)
+		return err
+
+	case ChangeUpdate:
+		// Start from the target so that fields without a diff, such as
+		// those the conflict policy kept, are left as they are.
+		src, target := c.Source, c.Target
+		req := types.AdminUpdateSSOProviderRequest{
+			ProviderID:       target.ID,
+			Type:             "saml",
+			MetadataURL:      metadataURL(target),
+			MetadataXML:      target.SAMLProvider.MetadataXML,
+			Domains:          domains(target),
+			AttributeMapping: target.SAMLProvider.AttributeMapping,
+		}
+		for _, d := range c.Diff {
+			switch d.Field {
+			case "domains":
+				req.Domains = domains(src)
+			case "metadata_url":
+				req.MetadataURL = metadataURL(src)
+			case "metadata_xml":
+				req.MetadataXML = src.SAMLProvider.MetadataXML
+			case "attribute_mapping":
+				req.AttributeMapping = src.SAMLProvider.AttributeMapping
+			}
+		}
+		if req.MetadataURL != "" {
+			req.MetadataXML = ""
+		}
+		if src.ResourceID != nil {
+			req.ResourceID = *src.ResourceID
+		} else if target.ResourceID != nil {
+			req.ResourceID = *target.ResourceID
+		}
+		_, err := s.target.AdminUpdateSSOProvider(req)
+		return err
+
+	case ChangeDelete:
+		_, err := s.target.AdminDeleteSSOProvider(types.AdminDeleteSSOProviderRequest{ProviderID: c.Target.ID})
+		return err
+	}
+	return fmt.Errorf("unknown change kind %q", c.Kind)
+}
@@ -0,0 +1,213 @@
+package usersync_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	auth "github.com/supabase-community/auth-go"
+	"github.com/supabase-community/auth-go/authtest"
+	"github.com/supabase-community/auth-go/types"
+	"github.com/supabase-community/auth-go/usersync"
+)
+
+func newAdmin(t *testing.T) auth.Client {
+	srv := authtest.NewServer(authtest.DefaultConfig())
+	t.Cleanup(srv.Close)
+	return srv.AdminClient()
+}
+
+func createUsers(t *testing.T, c auth.Client, reqs ...types.AdminCreateUserRequest) {
+	for _, req := range reqs {
+		_, err := c.AdminCreateUser(req)
+		require.NoError(t, err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	source, target := newAdmin(t), newAdmin(t)
+	createUsers(t, source,
+		types.AdminCreateUserRequest{
+			Email:        "alice@example.com",
+			EmailConfirm: true,
+			UserMetadata: map[string]interface{}{"plan": "pro", "secret": "x"},
+		},
+		types.AdminCreateUserRequest{Email: "bob@example.com", UserMetadata: map[string]interface{}{"plan": "free"}},
+		types.AdminCreateUserRequest{Phone: "447700900123", PhoneConfirm: true},
+	)
+	_, err := source.AdminCreateSSOProvider(types.AdminCreateSSOProviderRequest{
+		Type:        "saml",
+		MetadataURL: "https://idp.example.com/metadata",
+		Domains:     []string{"example.com"},
+	})
+	require.NoError(err)
+
+	createUsers(t, target,
+		types.AdminCreateUserRequest{Email: "bob@example.com", UserMetadata: map[string]interface{}{"plan": "basic", "theme": "dark"}},
+		types.AdminCreateUserRequest{Email: "dave@example.com"},
+		types.AdminCreateUserRequest{Email: "ops@other.org"},
+	)
+
+	s := usersync.NewSyncer(source, target)
+	s.Rules = []usersync.Rule{usersync.DropUserMetadata("secret")}
+	s.Filter = func(u types.User) bool {
+		return u.Phone != "" || strings.HasSuffix(u.Email, "@example.com")
+	}
+	s.Delete = true
+	s.SSO = true
+
+	plan, err := s.Plan()
+	require.NoError(err)
+
+	var text bytes.Buffer
+	require.NoError(plan.WriteText(&text))
+	assert.Equal(strings.Join([]string{
+		"+ sso provider https://idp.example.com/metadata",
+		"+ user 447700900123",
+		"+ user alice@example.com",
+		`~ user bob@example.com (user_metadata.plan "basic" -> "free")`,
+		"- user dave@example.com",
+		"4 user changes, 1 provider changes, 0 conflicts, 0 unchanged",
+	}, "\n")+"\n", text.String())
+
+	result, err := s.Apply(context.Background(), plan)
+	require.NoError(err)
+	assert.Empty(result.Errors)
+	assert.Equal(5, result.Applied)
+
+	bob, err := target.AdminGetUserByEmail(types.AdminGetUserByEmailRequest{Email: "bob@example.com"})
+	require.NoError(err)
+	assert.Equal("free", bob.UserMetadata["plan"])
+	assert.Equal("dark", bob.UserMetadata["theme"])
+
+	alice, err := target.AdminGetUserByEmail(types.AdminGetUserByEmailRequest{Email: "alice@example.com"})
+	require.NoError(err)
+	assert.NotNil(alice.EmailConfirmedAt)
+	assert.NotContains(alice.UserMetadata, "secret")
+
+	_, err = target.AdminGetUserByEmail(types.AdminGetUserByEmailRequest{Email: "dave@example.com"})
+	assert.Error(err)
+	_, err = target.AdminGetUserByEmail(types.AdminGetUserByEmailRequest{Email: "ops@other.org"})
+	assert.NoError(err)
+
+	providers, err := target.AdminListSSOProviders()
+	require.NoError(err)
+	require.Len(providers.Providers, 1)
+	assert.Equal("example.com", providers.Providers[0].SSODomains[0].Domain)
+
+	plan, err = s.Plan()
+	require.NoError(err)
+	assert.True(plan.Empty())
+	assert.Equal(3, plan.Unchanged)
+}
+
+func TestSyncConflicts(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	source, target := newAdmin(t), newAdmin(t)
+	createUsers(t, source,
+		types.AdminCreateUserRequest{Email: "bob@example.com", UserMetadata: map[string]interface{}{"plan": "free", "theme": "light"}},
+		types.AdminCreateUserRequest{Email: "carol@example.com", Phone: "447700900123"},
+		types.AdminCreateUserRequest{Email: "dan@example.com", Phone: "447700900456"},
+	)
+	createUsers(t, target,
+		types.AdminCreateUserRequest{Email: "bob@example.com", UserMetadata: map[string]interface{}{"plan": "basic"}},
+		types.AdminCreateUserRequest{Email: "carol@example.com"},
+		types.AdminCreateUserRequest{Email: "other@example.com", Phone: "447700900123"},
+		types.AdminCreateUserRequest{Email: "daniel@example.com", Phone: "447700900456"},
+	)
+
+	s := usersync.NewSyncer(source, target)
+	s.OnConflict = usersync.ConflictTargetWins
+	s.Delete = true
+	plan, err := s.Plan()
+	require.NoError(err)
+	require.Len(plan.Users, 1)
+	assert.Equal([]usersync.FieldDiff{{Field: "user_metadata.theme", Source: "light"}}, plan.Users[0].Diff)
+	require.Len(plan.Conflicts, 2)
+	assert.Equal("carol@example.com", plan.Conflicts[0].Key)
+	assert.Equal("dan@example.com", plan.Conflicts[1].Key)
+	assert.Contains(plan.Conflicts[1].Reason, "email matches no user but phone matches user")
+
+	s.OnConflict = usersync.ConflictSkip
+	plan, err = s.Plan()
+	require.NoError(err)
+	assert.True(plan.Empty())
+	require.Len(plan.Conflicts, 3)
+	assert.Equal("bob@example.com", plan.Conflicts[0].Key)
+}
+
+func TestSyncEmptyRole(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	source, target := newAdmin(t), newAdmin(t)
+	createUsers(t, source, types.AdminCreateUserRequest{Email: "bob@example.com", Role: "editor"})
+	createUsers(t, target, types.AdminCreateUserRequest{Email: "bob@example.com", Role: "editor"})
+
+	s := usersync.NewSyncer(source, target)
+	s.Rules = []usersync.Rule{func(u *types.User) bool {
+		u.Role = ""
+		return true
+	}}
+	plan, err := s.Plan()
+	require.NoError(err)
+	assert.True(plan.Empty())
+	assert.Equal(1, plan.Unchanged)
+}
+
+func TestSyncProvidersTargetWins(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	source, target := newAdmin(t), newAdmin(t)
+	_, err := source.AdminCreateSSOProvider(types.AdminCreateSSOProviderRequest{
+		Type:        "saml",
+		MetadataURL: "https://idp.example.com/metadata",
+		Domains:     []string{"example.com"},
+		AttributeMapping: types.SAMLAttributeMapping{Keys: map[string]types.SAMLAttribute{
+			"email": {Name: "mail"},
+		}},
+	})
+	require.NoError(err)
+	_, err = target.AdminCreateSSOProvider(types.AdminCreateSSOProviderRequest{
+		Type:        "saml",
+		MetadataURL: "https://idp.example.com/metadata",
+		AttributeMapping: types.SAMLAttributeMapping{Keys: map[string]types.SAMLAttribute{
+			"email": {Name: "email_address"},
+		}},
+	})
+	require.NoError(err)
+
+	s := usersync.NewSyncer(source, target)
+	s.SSO = true
+	s.OnConflict = usersync.ConflictTargetWins
+	plan, err := s.Plan()
+	require.NoError(err)
+	require.Len(plan.Providers, 1)
+	assert.Equal([]usersync.FieldDiff{{Field: "domains", Source: []string{"example.com"}, Target: []string{}}}, plan.Providers[0].Diff)
+
+	result, err := s.Apply(context.Background(), plan)
+	require.NoError(err)
+	assert.Empty(result.Errors)
+
+	providers, err := target.AdminListSSOProviders()
+	require.NoError(err)
+	require.Len(providers.Providers, 1)
+	p := providers.Providers[0]
+	require.Len(p.SSODomains, 1)
+	assert.Equal("example.com", p.SSODomains[0].Domain)
+	assert.Equal("email_address", p.SAMLProvider.AttributeMapping.Keys["email"].Name)
+
+	plan, err = s.Plan()
+	require.NoError(err)
+	assert.Empty(plan.Providers)
+}